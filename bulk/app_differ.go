@@ -3,6 +3,7 @@ package bulk
 import (
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
 )
 
@@ -16,23 +17,37 @@ type AppDiffer interface {
 	Missing() <-chan []cc_messages.CCDesiredAppFingerprint
 
 	Deleted() <-chan []string
+
+	Drifted() <-chan []cc_messages.CCDesiredAppFingerprint
 }
 
 type appDiffer struct {
 	existingSchedulingInfos map[string]*models.DesiredLRPSchedulingInfo
+	recipeVersions          map[string]struct{}
 
 	stale   chan []cc_messages.CCDesiredAppFingerprint
 	missing chan []cc_messages.CCDesiredAppFingerprint
 	deleted chan []string
+	drifted chan []cc_messages.CCDesiredAppFingerprint
 }
 
-func NewAppDiffer(existing map[string]*models.DesiredLRPSchedulingInfo) AppDiffer {
+// NewAppDiffer compares CC's fingerprints against the existing LRPs. When
+// recipeVersions is non-empty, up-to-date LRPs whose recorded recipe version is
+// not one of them are reported on Drifted; otherwise nothing is.
+func NewAppDiffer(existing map[string]*models.DesiredLRPSchedulingInfo, recipeVersions []string) AppDiffer {
+	versions := make(map[string]struct{}, len(recipeVersions))
+	for _, version := range recipeVersions {
+		versions[version] = struct{}{}
+	}
+
 	return &appDiffer{
 		existingSchedulingInfos: copySchedulingInfoMap(existing),
+		recipeVersions:          versions,
 
 		stale:   make(chan []cc_messages.CCDesiredAppFingerprint, 1),
 		missing: make(chan []cc_messages.CCDesiredAppFingerprint, 1),
 		deleted: make(chan []string, 1),
+		drifted: make(chan []cc_messages.CCDesiredAppFingerprint, 1),
 	}
 }
 
@@ -50,6 +65,7 @@ func (d *appDiffer) Diff(
 			close(d.missing)
 			close(d.stale)
 			close(d.deleted)
+			close(d.drifted)
 			close(errc)
 		}()
 
@@ -69,6 +85,7 @@ func (d *appDiffer) Diff(
 
 				missing := []cc_messages.CCDesiredAppFingerprint{}
 				stale := []cc_messages.CCDesiredAppFingerprint{}
+				drifted := []cc_messages.CCDesiredAppFingerprint{}
 
 				for _, fingerprint := range batch {
 					desiredLRP, found := d.existingSchedulingInfos[fingerprint.ProcessGuid]
@@ -91,6 +108,16 @@ func (d *appDiffer) Diff(
 						})
 
 						stale = append(stale, fingerprint)
+						continue
+					}
+
+					if d.hasDrifted(desiredLRP) {
+						logger.Info("found-drifted-lrp", lager.Data{
+							"guid": fingerprint.ProcessGuid,
+							"etag": fingerprint.ETag,
+						})
+
+						drifted = append(drifted, fingerprint)
 					}
 				}
 
@@ -109,6 +136,14 @@ func (d *appDiffer) Diff(
 						return
 					}
 				}
+
+				if len(drifted) > 0 {
+					select {
+					case d.drifted <- drifted:
+					case <-cancel:
+						return
+					}
+				}
 			}
 		}
 	}()
@@ -116,6 +151,20 @@ func (d *appDiffer) Diff(
 	return errc
 }
 
+func (d *appDiffer) hasDrifted(schedulingInfo *models.DesiredLRPSchedulingInfo) bool {
+	if len(d.recipeVersions) == 0 {
+		return false
+	}
+
+	version, ok := recipebuilder.RecipeVersion(schedulingInfo.Routes)
+	if !ok {
+		return true
+	}
+
+	_, current := d.recipeVersions[version]
+	return !current
+}
+
 func copySchedulingInfoMap(schedulingInfoMap map[string]*models.DesiredLRPSchedulingInfo) map[string]*models.DesiredLRPSchedulingInfo {
 	clone := map[string]*models.DesiredLRPSchedulingInfo{}
 	for k, v := range schedulingInfoMap {
@@ -144,3 +193,7 @@ func (d *appDiffer) Missing() <-chan []cc_messages.CCDesiredAppFingerprint {
 func (d *appDiffer) Deleted() <-chan []string {
 	return d.deleted
 }
+
+func (d *appDiffer) Drifted() <-chan []cc_messages.CCDesiredAppFingerprint {
+	return d.drifted
+}
@@ -1,9 +1,12 @@
 package bulk_test
 
 import (
+	"encoding/json"
+
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nsync/bulk"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
 
 	. "github.com/onsi/ginkgo"
@@ -22,8 +25,10 @@ var _ = Describe("Differ", func() {
 		staleChan   <-chan []cc_messages.CCDesiredAppFingerprint
 		missingChan <-chan []cc_messages.CCDesiredAppFingerprint
 		deletedChan <-chan []string
+		driftedChan <-chan []cc_messages.CCDesiredAppFingerprint
 
-		errorsChan <-chan error
+		recipeVersions []string
+		errorsChan     <-chan error
 
 		logger *lagertest.TestLogger
 		differ bulk.AppDiffer
@@ -43,6 +48,7 @@ var _ = Describe("Differ", func() {
 			ETag:        existingSchedulingInfo.Annotation,
 		}
 
+		recipeVersions = nil
 		desiredChan = make(chan []cc_messages.CCDesiredAppFingerprint, 1)
 		cancelChan = make(chan struct{})
 	})
@@ -51,11 +57,12 @@ var _ = Describe("Differ", func() {
 		existingSchedulingInfoMap = map[string]*models.DesiredLRPSchedulingInfo{
 			existingSchedulingInfo.ProcessGuid: existingSchedulingInfo,
 		}
-		differ = bulk.NewAppDiffer(existingSchedulingInfoMap)
+		differ = bulk.NewAppDiffer(existingSchedulingInfoMap, recipeVersions)
 
 		staleChan = differ.Stale()
 		missingChan = differ.Missing()
 		deletedChan = differ.Deleted()
+		driftedChan = differ.Drifted()
 
 		errorsChan = differ.Diff(logger, cancelChan, desiredChan)
 	})
@@ -65,6 +72,7 @@ var _ = Describe("Differ", func() {
 		Eventually(staleChan).Should(BeClosed())
 		Eventually(missingChan).Should(BeClosed())
 		Eventually(deletedChan).Should(BeClosed())
+		Eventually(driftedChan).Should(BeClosed())
 		Eventually(errorsChan).Should(BeClosed())
 	})
 
@@ -154,6 +162,85 @@ var _ = Describe("Differ", func() {
 				Consistently(deletedChan).ShouldNot(Receive())
 			})
 		})
+
+		Context("and the current recipe versions are known", func() {
+			BeforeEach(func() {
+				recipeVersions = []string{"buildpack-v2", "docker-v2"}
+			})
+
+			Context("and an up-to-date LRP was built by an older recipe", func() {
+				BeforeEach(func() {
+					version := json.RawMessage(`"buildpack-v1"`)
+					existingSchedulingInfo.Routes = models.Routes{
+						recipebuilder.RecipeVersionRouteKey: &version,
+					}
+
+					desiredChan <- desiredAppFingerprints
+					close(desiredChan)
+				})
+
+				It("sends its fingerprint on the drifted channel", func() {
+					Eventually(driftedChan).Should(Receive(ConsistOf(existingAppFingerprint)))
+
+					Consistently(staleChan).ShouldNot(Receive())
+				})
+			})
+
+			Context("and an up-to-date LRP has no recipe version", func() {
+				BeforeEach(func() {
+					desiredChan <- desiredAppFingerprints
+					close(desiredChan)
+				})
+
+				It("sends its fingerprint on the drifted channel", func() {
+					Eventually(driftedChan).Should(Receive(ConsistOf(existingAppFingerprint)))
+				})
+			})
+
+			Context("and an up-to-date LRP was built by a current recipe", func() {
+				BeforeEach(func() {
+					version := json.RawMessage(`"docker-v2"`)
+					existingSchedulingInfo.Routes = models.Routes{
+						recipebuilder.RecipeVersionRouteKey: &version,
+					}
+
+					desiredChan <- desiredAppFingerprints
+					close(desiredChan)
+				})
+
+				It("sends nothing on the drifted channel", func() {
+					Consistently(driftedChan).ShouldNot(Receive())
+				})
+			})
+
+			Context("and a drifted LRP also has a stale ETag", func() {
+				var fingerprint cc_messages.CCDesiredAppFingerprint
+
+				BeforeEach(func() {
+					fingerprint = existingAppFingerprint
+					fingerprint.ETag = "updated-etag"
+
+					desiredChan <- []cc_messages.CCDesiredAppFingerprint{fingerprint}
+					close(desiredChan)
+				})
+
+				It("only reports it as stale", func() {
+					Eventually(staleChan).Should(Receive(ConsistOf(fingerprint)))
+					Consistently(driftedChan).ShouldNot(Receive())
+				})
+			})
+		})
+
+		Context("and the current recipe versions are not known", func() {
+			BeforeEach(func() {
+				desiredChan <- desiredAppFingerprints
+				close(desiredChan)
+			})
+
+			It("never reports drift", func() {
+				Consistently(driftedChan).ShouldNot(Receive())
+			})
+		})
 	})
 
 	Context("while the desired app channel remains open", func() {
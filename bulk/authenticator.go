@@ -0,0 +1,199 @@
+package bulk
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o fakes/fake_authenticator.go . Authenticator
+
+// Authenticator adds credentials to the requests made to CC's internal API.
+type Authenticator interface {
+	Authenticate(logger lager.Logger, req *http.Request) error
+}
+
+// clientCertificateProvider is implemented by authenticators that identify
+// nsync to CC at the TLS layer; NewCCHTTPClient presents their certificate.
+type clientCertificateProvider interface {
+	ClientCertificate() tls.Certificate
+}
+
+type BasicAuthenticator struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuthenticator) Authenticate(logger lager.Logger, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+var ErrClientCertRequiresTLS = errors.New("client certificate authentication requires an https url")
+
+type ClientCertAuthenticator struct {
+	certificate tls.Certificate
+}
+
+func NewClientCertAuthenticator(certFile, keyFile string) (*ClientCertAuthenticator, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientCertAuthenticator{certificate: certificate}, nil
+}
+
+func (a *ClientCertAuthenticator) ClientCertificate() tls.Certificate {
+	return a.certificate
+}
+
+func (a *ClientCertAuthenticator) Authenticate(logger lager.Logger, req *http.Request) error {
+	if req.URL.Scheme != "https" {
+		logger.Error("refusing-to-send-request-without-tls", ErrClientCertRequiresTLS, lager.Data{"url": req.URL.String()})
+		return ErrClientCertRequiresTLS
+	}
+	return nil
+}
+
+// tokenInvalidator is implemented by authenticators that cache a token; a
+// request CC rejects as unauthorized invalidates it.
+type tokenInvalidator interface {
+	InvalidateToken()
+}
+
+const maxTokenRefreshMargin = 30 * time.Second
+
+type uaaTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// UAATokenAuthenticator fetches OAuth tokens with the client credentials
+// grant and reuses them until shortly before they expire.
+type UAATokenAuthenticator struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+	clock        clock.Clock
+
+	lock      sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewUAATokenAuthenticator(
+	tokenURL string,
+	clientID string,
+	clientSecret string,
+	httpClient *http.Client,
+	clock clock.Clock,
+) *UAATokenAuthenticator {
+	return &UAATokenAuthenticator{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+		clock:        clock,
+	}
+}
+
+func (a *UAATokenAuthenticator) Authenticate(logger lager.Logger, req *http.Request) error {
+	token, err := a.currentToken(logger)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "bearer "+token)
+	return nil
+}
+
+// InvalidateToken drops the cached token, so that the next request fetches a
+// new one. CC may stop accepting a token before it expires, for instance when
+// UAA rotates its signing keys.
+func (a *UAATokenAuthenticator) InvalidateToken() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.token = ""
+	a.expiresAt = time.Time{}
+}
+
+func (a *UAATokenAuthenticator) currentToken(logger lager.Logger) (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := a.clock.Now()
+	if a.token != "" && now.Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	logger = logger.Session("fetch-uaa-token")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	response, err := a.fetchToken()
+	if err != nil {
+		logger.Error("failed-to-fetch-token", err)
+		return "", err
+	}
+
+	lifetime := time.Duration(response.ExpiresIn) * time.Second
+	margin := lifetime / 2
+	if margin > maxTokenRefreshMargin {
+		margin = maxTokenRefreshMargin
+	}
+
+	a.token = response.AccessToken
+	a.expiresAt = now.Add(lifetime - margin)
+
+	logger.Debug("fetched-token", lager.Data{"expires-in": response.ExpiresIn})
+
+	return a.token, nil
+}
+
+func (a *UAATokenAuthenticator) fetchToken() (uaaTokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+
+	req, err := http.NewRequest("POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return uaaTokenResponse{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(a.clientID, a.clientSecret)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return uaaTokenResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return uaaTokenResponse{}, fmt.Errorf("invalid response code %d from token endpoint", resp.StatusCode)
+	}
+
+	var response uaaTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return uaaTokenResponse{}, err
+	}
+
+	if response.AccessToken == "" {
+		return uaaTokenResponse{}, errors.New("token endpoint returned an empty access token")
+	}
+
+	return response, nil
+}
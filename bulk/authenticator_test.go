@@ -0,0 +1,213 @@
+package bulk_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/bulk"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Authenticators", func() {
+	var (
+		logger *lagertest.TestLogger
+		req    *http.Request
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = lagertest.NewTestLogger("test")
+
+		req, err = http.NewRequest("GET", "https://cc.example.com/internal/bulk/apps", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("BasicAuthenticator", func() {
+		It("sets basic auth credentials on the request", func() {
+			authenticator := &bulk.BasicAuthenticator{Username: "the-username", Password: "the-password"}
+
+			err := authenticator.Authenticate(logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			username, password, ok := req.BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("the-username"))
+			Expect(password).To(Equal("the-password"))
+		})
+	})
+
+	Describe("ClientCertAuthenticator", func() {
+		var authenticator *bulk.ClientCertAuthenticator
+
+		BeforeEach(func() {
+			var err error
+			authenticator, err = bulk.NewClientCertAuthenticator("../fixtures/certs/client.crt", "../fixtures/certs/client.key")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("fails to load a missing key pair", func() {
+			_, err := bulk.NewClientCertAuthenticator("missing.crt", "missing.key")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("refuses to authenticate requests that are not sent over https", func() {
+			req.URL.Scheme = "http"
+
+			err := authenticator.Authenticate(logger, req)
+			Expect(err).To(Equal(bulk.ErrClientCertRequiresTLS))
+		})
+
+		It("presents the client certificate from the CC http client", func() {
+			caCert, err := ioutil.ReadFile("../fixtures/certs/ca.crt")
+			Expect(err).NotTo(HaveOccurred())
+			clientCAs := x509.NewCertPool()
+			Expect(clientCAs.AppendCertsFromPEM(caCert)).To(BeTrue())
+
+			serverCert, err := tls.LoadX509KeyPair("../fixtures/certs/server.crt", "../fixtures/certs/server.key")
+			Expect(err).NotTo(HaveOccurred())
+
+			var peerCommonName string
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				peerCommonName = r.TLS.PeerCertificates[0].Subject.CommonName
+			}))
+			server.TLS = &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    clientCAs,
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			req, err := http.NewRequest("GET", server.URL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authenticator.Authenticate(logger, req)).To(Succeed())
+
+			resp, err := bulk.NewCCHTTPClient(true, authenticator).Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(peerCommonName).To(Equal("nsync-client"))
+		})
+	})
+
+	Describe("UAATokenAuthenticator", func() {
+		var (
+			fakeUAA       *ghttp.Server
+			fakeClock     *fakeclock.FakeClock
+			authenticator *bulk.UAATokenAuthenticator
+		)
+
+		respondWithToken := func(token string, expiresIn int) http.HandlerFunc {
+			return ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/oauth/token"),
+				ghttp.VerifyBasicAuth("nsync", "secret"),
+				ghttp.VerifyContentType("application/x-www-form-urlencoded"),
+				ghttp.VerifyFormKV("grant_type", "client_credentials"),
+				ghttp.RespondWithJSONEncoded(200, map[string]interface{}{
+					"access_token": token,
+					"token_type":   "bearer",
+					"expires_in":   expiresIn,
+				}),
+			)
+		}
+
+		BeforeEach(func() {
+			fakeUAA = ghttp.NewServer()
+			fakeClock = fakeclock.NewFakeClock(time.Now())
+
+			authenticator = bulk.NewUAATokenAuthenticator(
+				fakeUAA.URL()+"/oauth/token",
+				"nsync",
+				"secret",
+				&http.Client{Timeout: time.Second},
+				fakeClock,
+			)
+		})
+
+		AfterEach(func() {
+			fakeUAA.Close()
+		})
+
+		Context("when the token server hands out tokens", func() {
+			BeforeEach(func() {
+				fakeUAA.AppendHandlers(
+					respondWithToken("first-token", 600),
+					respondWithToken("second-token", 600),
+				)
+			})
+
+			It("sets a bearer token on the request", func() {
+				err := authenticator.Authenticate(logger, req)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(req.Header.Get("Authorization")).To(Equal("bearer first-token"))
+			})
+
+			It("reuses the token until it is about to expire", func() {
+				Expect(authenticator.Authenticate(logger, req)).To(Succeed())
+
+				fakeClock.Increment(5 * time.Minute)
+				Expect(authenticator.Authenticate(logger, req)).To(Succeed())
+				Expect(req.Header.Get("Authorization")).To(Equal("bearer first-token"))
+				Expect(fakeUAA.ReceivedRequests()).To(HaveLen(1))
+
+				fakeClock.Increment(5 * time.Minute)
+				Expect(authenticator.Authenticate(logger, req)).To(Succeed())
+				Expect(req.Header.Get("Authorization")).To(Equal("bearer second-token"))
+				Expect(fakeUAA.ReceivedRequests()).To(HaveLen(2))
+			})
+		})
+
+		Context("when the token is invalidated", func() {
+			BeforeEach(func() {
+				fakeUAA.AppendHandlers(
+					respondWithToken("first-token", 600),
+					respondWithToken("second-token", 600),
+				)
+			})
+
+			It("fetches a new token for the next request", func() {
+				Expect(authenticator.Authenticate(logger, req)).To(Succeed())
+
+				authenticator.InvalidateToken()
+
+				Expect(authenticator.Authenticate(logger, req)).To(Succeed())
+				Expect(req.Header.Get("Authorization")).To(Equal("bearer second-token"))
+				Expect(fakeUAA.ReceivedRequests()).To(HaveLen(2))
+			})
+		})
+
+		Context("when the token server rejects the client", func() {
+			BeforeEach(func() {
+				fakeUAA.AppendHandlers(ghttp.RespondWith(401, `{"error":"unauthorized"}`))
+			})
+
+			It("returns an error and does not set a token", func() {
+				err := authenticator.Authenticate(logger, req)
+				Expect(err).To(MatchError(ContainSubstring("401")))
+
+				Expect(req.Header.Get("Authorization")).To(BeEmpty())
+			})
+		})
+
+		Context("when the token server returns an empty token", func() {
+			BeforeEach(func() {
+				fakeUAA.AppendHandlers(respondWithToken("", 600))
+			})
+
+			It("returns an error", func() {
+				err := authenticator.Authenticate(logger, req)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
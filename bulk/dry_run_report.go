@@ -0,0 +1,64 @@
+package bulk
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type dryRunReport struct {
+	mutex     sync.Mutex
+	creates   []string
+	updates   []string
+	deletes   []string
+	recreates []string
+}
+
+func newDryRunReport() *dryRunReport {
+	return &dryRunReport{
+		creates:   []string{},
+		updates:   []string{},
+		deletes:   []string{},
+		recreates: []string{},
+	}
+}
+
+func (r *dryRunReport) recordCreate(processGuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.creates = append(r.creates, processGuid)
+}
+
+func (r *dryRunReport) recordUpdate(processGuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.updates = append(r.updates, processGuid)
+}
+
+func (r *dryRunReport) recordDeletes(processGuids []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.deletes = append(r.deletes, processGuids...)
+}
+
+func (r *dryRunReport) recordRecreate(processGuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.recreates = append(r.recreates, processGuid)
+}
+
+func (r *dryRunReport) emit(logger lager.Logger) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	logger.Info("dry-run-report", lager.Data{
+		"num-to-create":     len(r.creates),
+		"num-to-update":     len(r.updates),
+		"num-to-delete":     len(r.deletes),
+		"num-to-recreate":   len(r.recreates),
+		"guids-to-create":   r.creates,
+		"guids-to-update":   r.updates,
+		"guids-to-delete":   r.deletes,
+		"guids-to-recreate": r.recreates,
+	})
+}
@@ -38,6 +38,12 @@ type FakeAppDiffer struct {
 	deletedReturns     struct {
 		result1 <-chan []string
 	}
+	DriftedStub        func() <-chan []cc_messages.CCDesiredAppFingerprint
+	driftedMutex       sync.RWMutex
+	driftedArgsForCall []struct{}
+	driftedReturns     struct {
+		result1 <-chan []cc_messages.CCDesiredAppFingerprint
+	}
 }
 
 func (fake *FakeAppDiffer) Diff(logger lager.Logger, cancel <-chan struct{}, fingerprints <-chan []cc_messages.CCDesiredAppFingerprint) <-chan error {
@@ -146,4 +152,28 @@ func (fake *FakeAppDiffer) DeletedReturns(result1 <-chan []string) {
 	}{result1}
 }
 
+func (fake *FakeAppDiffer) Drifted() <-chan []cc_messages.CCDesiredAppFingerprint {
+	fake.driftedMutex.Lock()
+	fake.driftedArgsForCall = append(fake.driftedArgsForCall, struct{}{})
+	fake.driftedMutex.Unlock()
+	if fake.DriftedStub != nil {
+		return fake.DriftedStub()
+	} else {
+		return fake.driftedReturns.result1
+	}
+}
+
+func (fake *FakeAppDiffer) DriftedCallCount() int {
+	fake.driftedMutex.RLock()
+	defer fake.driftedMutex.RUnlock()
+	return len(fake.driftedArgsForCall)
+}
+
+func (fake *FakeAppDiffer) DriftedReturns(result1 <-chan []cc_messages.CCDesiredAppFingerprint) {
+	fake.DriftedStub = nil
+	fake.driftedReturns = struct {
+		result1 <-chan []cc_messages.CCDesiredAppFingerprint
+	}{result1}
+}
+
 var _ bulk.AppDiffer = new(FakeAppDiffer)
@@ -0,0 +1,57 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nsync/bulk"
+)
+
+type FakeAuthenticator struct {
+	AuthenticateStub        func(logger lager.Logger, req *http.Request) error
+	authenticateMutex       sync.RWMutex
+	authenticateArgsForCall []struct {
+		logger lager.Logger
+		req    *http.Request
+	}
+	authenticateReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeAuthenticator) Authenticate(logger lager.Logger, req *http.Request) error {
+	fake.authenticateMutex.Lock()
+	fake.authenticateArgsForCall = append(fake.authenticateArgsForCall, struct {
+		logger lager.Logger
+		req    *http.Request
+	}{logger, req})
+	fake.authenticateMutex.Unlock()
+	if fake.AuthenticateStub != nil {
+		return fake.AuthenticateStub(logger, req)
+	} else {
+		return fake.authenticateReturns.result1
+	}
+}
+
+func (fake *FakeAuthenticator) AuthenticateCallCount() int {
+	fake.authenticateMutex.RLock()
+	defer fake.authenticateMutex.RUnlock()
+	return len(fake.authenticateArgsForCall)
+}
+
+func (fake *FakeAuthenticator) AuthenticateArgsForCall(i int) (lager.Logger, *http.Request) {
+	fake.authenticateMutex.RLock()
+	defer fake.authenticateMutex.RUnlock()
+	return fake.authenticateArgsForCall[i].logger, fake.authenticateArgsForCall[i].req
+}
+
+func (fake *FakeAuthenticator) AuthenticateReturns(result1 error) {
+	fake.AuthenticateStub = nil
+	fake.authenticateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ bulk.Authenticator = new(FakeAuthenticator)
@@ -7,6 +7,7 @@ import (
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/nsync/bulk"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
 )
 
@@ -33,7 +34,7 @@ type FakeFetcher struct {
 		result1 <-chan []cc_messages.CCTaskState
 		result2 <-chan error
 	}
-	FetchDesiredAppsStub        func(logger lager.Logger, cancel <-chan struct{}, httpClient *http.Client, fingerprints <-chan []cc_messages.CCDesiredAppFingerprint) (<-chan []cc_messages.DesireAppRequestFromCC, <-chan error)
+	FetchDesiredAppsStub        func(logger lager.Logger, cancel <-chan struct{}, httpClient *http.Client, fingerprints <-chan []cc_messages.CCDesiredAppFingerprint) (<-chan []recipebuilder.DesireAppRequest, <-chan error)
 	fetchDesiredAppsMutex       sync.RWMutex
 	fetchDesiredAppsArgsForCall []struct {
 		logger       lager.Logger
@@ -42,7 +43,7 @@ type FakeFetcher struct {
 		fingerprints <-chan []cc_messages.CCDesiredAppFingerprint
 	}
 	fetchDesiredAppsReturns struct {
-		result1 <-chan []cc_messages.DesireAppRequestFromCC
+		result1 <-chan []recipebuilder.DesireAppRequest
 		result2 <-chan error
 	}
 }
@@ -117,7 +118,7 @@ func (fake *FakeFetcher) FetchTaskStatesReturns(result1 <-chan []cc_messages.CCT
 	}{result1, result2}
 }
 
-func (fake *FakeFetcher) FetchDesiredApps(logger lager.Logger, cancel <-chan struct{}, httpClient *http.Client, fingerprints <-chan []cc_messages.CCDesiredAppFingerprint) (<-chan []cc_messages.DesireAppRequestFromCC, <-chan error) {
+func (fake *FakeFetcher) FetchDesiredApps(logger lager.Logger, cancel <-chan struct{}, httpClient *http.Client, fingerprints <-chan []cc_messages.CCDesiredAppFingerprint) (<-chan []recipebuilder.DesireAppRequest, <-chan error) {
 	fake.fetchDesiredAppsMutex.Lock()
 	fake.fetchDesiredAppsArgsForCall = append(fake.fetchDesiredAppsArgsForCall, struct {
 		logger       lager.Logger
@@ -145,10 +146,10 @@ func (fake *FakeFetcher) FetchDesiredAppsArgsForCall(i int) (lager.Logger, <-cha
 	return fake.fetchDesiredAppsArgsForCall[i].logger, fake.fetchDesiredAppsArgsForCall[i].cancel, fake.fetchDesiredAppsArgsForCall[i].httpClient, fake.fetchDesiredAppsArgsForCall[i].fingerprints
 }
 
-func (fake *FakeFetcher) FetchDesiredAppsReturns(result1 <-chan []cc_messages.DesireAppRequestFromCC, result2 <-chan error) {
+func (fake *FakeFetcher) FetchDesiredAppsReturns(result1 <-chan []recipebuilder.DesireAppRequest, result2 <-chan error) {
 	fake.FetchDesiredAppsStub = nil
 	fake.fetchDesiredAppsReturns = struct {
-		result1 <-chan []cc_messages.DesireAppRequestFromCC
+		result1 <-chan []recipebuilder.DesireAppRequest
 		result2 <-chan error
 	}{result1, result2}
 }
@@ -10,10 +10,10 @@ import (
 )
 
 type FakeRecipeBuilder struct {
-	BuildStub        func(*cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error)
+	BuildStub        func(*recipebuilder.DesireAppRequest) (*models.DesiredLRP, error)
 	buildMutex       sync.RWMutex
 	buildArgsForCall []struct {
-		arg1 *cc_messages.DesireAppRequestFromCC
+		arg1 *recipebuilder.DesireAppRequest
 	}
 	buildReturns struct {
 		result1 *models.DesiredLRP
@@ -37,12 +37,18 @@ type FakeRecipeBuilder struct {
 		result1 []uint32
 		result2 error
 	}
+	RecipeVersionsStub        func() map[string]string
+	recipeVersionsMutex       sync.RWMutex
+	recipeVersionsArgsForCall []struct{}
+	recipeVersionsReturns     struct {
+		result1 map[string]string
+	}
 }
 
-func (fake *FakeRecipeBuilder) Build(arg1 *cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error) {
+func (fake *FakeRecipeBuilder) Build(arg1 *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
 	fake.buildMutex.Lock()
 	fake.buildArgsForCall = append(fake.buildArgsForCall, struct {
-		arg1 *cc_messages.DesireAppRequestFromCC
+		arg1 *recipebuilder.DesireAppRequest
 	}{arg1})
 	fake.buildMutex.Unlock()
 	if fake.BuildStub != nil {
@@ -58,7 +64,7 @@ func (fake *FakeRecipeBuilder) BuildCallCount() int {
 	return len(fake.buildArgsForCall)
 }
 
-func (fake *FakeRecipeBuilder) BuildArgsForCall(i int) *cc_messages.DesireAppRequestFromCC {
+func (fake *FakeRecipeBuilder) BuildArgsForCall(i int) *recipebuilder.DesireAppRequest {
 	fake.buildMutex.RLock()
 	defer fake.buildMutex.RUnlock()
 	return fake.buildArgsForCall[i].arg1
@@ -138,4 +144,28 @@ func (fake *FakeRecipeBuilder) ExtractExposedPortsReturns(result1 []uint32, resu
 	}{result1, result2}
 }
 
+func (fake *FakeRecipeBuilder) RecipeVersions() map[string]string {
+	fake.recipeVersionsMutex.Lock()
+	fake.recipeVersionsArgsForCall = append(fake.recipeVersionsArgsForCall, struct{}{})
+	fake.recipeVersionsMutex.Unlock()
+	if fake.RecipeVersionsStub != nil {
+		return fake.RecipeVersionsStub()
+	} else {
+		return fake.recipeVersionsReturns.result1
+	}
+}
+
+func (fake *FakeRecipeBuilder) RecipeVersionsCallCount() int {
+	fake.recipeVersionsMutex.RLock()
+	defer fake.recipeVersionsMutex.RUnlock()
+	return len(fake.recipeVersionsArgsForCall)
+}
+
+func (fake *FakeRecipeBuilder) RecipeVersionsReturns(result1 map[string]string) {
+	fake.RecipeVersionsStub = nil
+	fake.recipeVersionsReturns = struct {
+		result1 map[string]string
+	}{result1}
+}
+
 var _ recipebuilder.RecipeBuilder = new(FakeRecipeBuilder)
@@ -11,10 +11,11 @@ import (
 )
 
 type FakeTaskClient struct {
-	FailTaskStub        func(logger lager.Logger, taskState *cc_messages.CCTaskState, httpClient *http.Client) error
+	FailTaskStub        func(logger lager.Logger, cancel <-chan struct{}, taskState *cc_messages.CCTaskState, httpClient *http.Client) error
 	failTaskMutex       sync.RWMutex
 	failTaskArgsForCall []struct {
 		logger     lager.Logger
+		cancel     <-chan struct{}
 		taskState  *cc_messages.CCTaskState
 		httpClient *http.Client
 	}
@@ -23,16 +24,17 @@ type FakeTaskClient struct {
 	}
 }
 
-func (fake *FakeTaskClient) FailTask(logger lager.Logger, taskState *cc_messages.CCTaskState, httpClient *http.Client) error {
+func (fake *FakeTaskClient) FailTask(logger lager.Logger, cancel <-chan struct{}, taskState *cc_messages.CCTaskState, httpClient *http.Client) error {
 	fake.failTaskMutex.Lock()
 	fake.failTaskArgsForCall = append(fake.failTaskArgsForCall, struct {
 		logger     lager.Logger
+		cancel     <-chan struct{}
 		taskState  *cc_messages.CCTaskState
 		httpClient *http.Client
-	}{logger, taskState, httpClient})
+	}{logger, cancel, taskState, httpClient})
 	fake.failTaskMutex.Unlock()
 	if fake.FailTaskStub != nil {
-		return fake.FailTaskStub(logger, taskState, httpClient)
+		return fake.FailTaskStub(logger, cancel, taskState, httpClient)
 	} else {
 		return fake.failTaskReturns.result1
 	}
@@ -44,10 +46,10 @@ func (fake *FakeTaskClient) FailTaskCallCount() int {
 	return len(fake.failTaskArgsForCall)
 }
 
-func (fake *FakeTaskClient) FailTaskArgsForCall(i int) (lager.Logger, *cc_messages.CCTaskState, *http.Client) {
+func (fake *FakeTaskClient) FailTaskArgsForCall(i int) (lager.Logger, <-chan struct{}, *cc_messages.CCTaskState, *http.Client) {
 	fake.failTaskMutex.RLock()
 	defer fake.failTaskMutex.RUnlock()
-	return fake.failTaskArgsForCall[i].logger, fake.failTaskArgsForCall[i].taskState, fake.failTaskArgsForCall[i].httpClient
+	return fake.failTaskArgsForCall[i].logger, fake.failTaskArgsForCall[i].cancel, fake.failTaskArgsForCall[i].taskState, fake.failTaskArgsForCall[i].httpClient
 }
 
 func (fake *FakeTaskClient) FailTaskReturns(result1 error) {
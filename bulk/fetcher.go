@@ -2,15 +2,25 @@ package bulk
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"code.cloudfoundry.org/runtimeschema/metric"
 )
 
+var ccRequestRetries = metric.Counter("NsyncCCRequestRetries")
+
 //go:generate counterfeiter -o fakes/fake_fetcher.go . Fetcher
 
 type Fetcher interface {
@@ -31,14 +41,25 @@ type Fetcher interface {
 		cancel <-chan struct{},
 		httpClient *http.Client,
 		fingerprints <-chan []cc_messages.CCDesiredAppFingerprint,
-	) (<-chan []cc_messages.DesireAppRequestFromCC, <-chan error)
+	) (<-chan []recipebuilder.DesireAppRequest, <-chan error)
 }
 
 type CCFetcher struct {
-	BaseURI   string
-	BatchSize int
-	Username  string
-	Password  string
+	BaseURI       string
+	BatchSize     int
+	Authenticator Authenticator
+
+	// Requests that fail with a connection error, a 5xx or a 429 are retried
+	// up to MaxRetries times, backing off exponentially from RetryBaseDelay
+	// (with jitter) up to RetryMaxDelay. A Retry-After header on a 429 takes
+	// precedence over the computed delay, but is capped at RetryMaxDelay too.
+	// A 401 is retried only when it invalidated a cached token.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// Clock times the waits between retries; the real clock when nil.
+	Clock clock.Clock
 }
 
 const initialBulkToken = "{}"
@@ -62,15 +83,9 @@ func (fetcher *CCFetcher) FetchFingerprints(
 		for {
 			logger.Info("fetching-desired")
 
-			req, err := http.NewRequest("GET", fetcher.fingerprintURL(token), nil)
-			if err != nil {
-				errc <- err
-				return
-			}
-
 			response := cc_messages.CCDesiredStateFingerprintResponse{}
 
-			err = fetcher.doRequest(logger, httpClient, req, &response)
+			err := fetcher.doRequest(logger, cancel, httpClient, "GET", fetcher.fingerprintURL(token), nil, &response)
 			if err != nil {
 				errc <- err
 				return
@@ -103,8 +118,8 @@ func (fetcher *CCFetcher) FetchDesiredApps(
 	cancel <-chan struct{},
 	httpClient *http.Client,
 	fingerprintCh <-chan []cc_messages.CCDesiredAppFingerprint,
-) (<-chan []cc_messages.DesireAppRequestFromCC, <-chan error) {
-	results := make(chan []cc_messages.DesireAppRequestFromCC)
+) (<-chan []recipebuilder.DesireAppRequest, <-chan error) {
+	results := make(chan []recipebuilder.DesireAppRequest)
 	errc := make(chan error, 1)
 
 	go func() {
@@ -142,16 +157,9 @@ func (fetcher *CCFetcher) FetchDesiredApps(
 
 			logger.Info("fetching-desired", lager.Data{"fingerprints-length": len(fingerprints)})
 
-			req, err := http.NewRequest("POST", fetcher.desiredURL(), bytes.NewReader(payload))
-			if err != nil {
-				logger.Error("failed-to-create-request", err)
-				errc <- err
-				continue
-			}
-
-			response := []cc_messages.DesireAppRequestFromCC{}
+			response := []recipebuilder.DesireAppRequest{}
 
-			err = fetcher.doRequest(logger, httpClient, req, &response)
+			err = fetcher.doRequest(logger, cancel, httpClient, "POST", fetcher.desiredURL(), payload, &response)
 			if err != nil {
 				errc <- err
 				continue
@@ -187,15 +195,9 @@ func (fetcher *CCFetcher) FetchTaskStates(
 		for {
 			logger.Info("fetching-task-states")
 
-			req, err := http.NewRequest("GET", fetcher.taskStatesURL(token), nil)
-			if err != nil {
-				errc <- err
-				return
-			}
-
 			response := cc_messages.CCTaskStatesResponse{}
 
-			err = fetcher.doRequest(logger, httpClient, req, &response)
+			err := fetcher.doRequest(logger, cancel, httpClient, "GET", fetcher.taskStatesURL(token), nil, &response)
 			if err != nil {
 				errc <- err
 				return
@@ -225,16 +227,95 @@ func (fetcher *CCFetcher) FetchTaskStates(
 
 func (fetcher *CCFetcher) doRequest(
 	logger lager.Logger,
+	cancel <-chan struct{},
 	httpClient *http.Client,
-	req *http.Request,
+	method string,
+	url string,
+	payload []byte,
 	value interface{},
 ) error {
+	for attempt := 0; ; attempt++ {
+		retryable, retryAfter, err := fetcher.attemptRequest(logger, cancel, httpClient, method, url, payload, value)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= fetcher.MaxRetries {
+			return err
+		}
+
+		delay := retryAfter
+		if delay <= 0 {
+			delay = fetcher.backoff(attempt)
+		} else if fetcher.RetryMaxDelay > 0 && delay > fetcher.RetryMaxDelay {
+			delay = fetcher.RetryMaxDelay
+		}
+
+		logger.Info("retrying-request", lager.Data{
+			"attempt":     attempt + 1,
+			"max-retries": fetcher.MaxRetries,
+			"delay":       delay.String(),
+			"error":       err.Error(),
+		})
+		metricErr := ccRequestRetries.Increment()
+		if metricErr != nil {
+			logger.Error("failed-to-send-cc-request-retries-metric", metricErr)
+		}
+
+		timer := fetcher.clock().NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-cancel:
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func (fetcher *CCFetcher) clock() clock.Clock {
+	if fetcher.Clock == nil {
+		return clock.NewClock()
+	}
+	return fetcher.Clock
+}
+
+func (fetcher *CCFetcher) attemptRequest(
+	logger lager.Logger,
+	cancel <-chan struct{},
+	httpClient *http.Client,
+	method string,
+	url string,
+	payload []byte,
+	value interface{},
+) (bool, time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		logger.Error("failed-to-create-request", err)
+		return false, 0, err
+	}
+
+	ctx, stop := cancelContext(cancel)
+	defer stop()
+	req = req.WithContext(ctx)
+
 	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(fetcher.Username, fetcher.Password)
+
+	if fetcher.Authenticator != nil {
+		err = fetcher.Authenticator.Authenticate(logger, req)
+		if err != nil {
+			logger.Error("failed-to-authenticate-request", err)
+			return true, 0, err
+		}
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return err
+		return true, 0, err
 	}
 
 	defer resp.Body.Close()
@@ -243,17 +324,75 @@ func (fetcher *CCFetcher) doRequest(
 		"StatusCode": resp.StatusCode,
 	})
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid response code %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		if invalidator, ok := fetcher.Authenticator.(tokenInvalidator); ok {
+			logger.Info("invalidating-rejected-token")
+			invalidator.InvalidateToken()
+			return true, 0, fmt.Errorf("invalid response code %d", resp.StatusCode)
+		}
+		return false, 0, fmt.Errorf("invalid response code %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true, parseRetryAfter(resp.Header.Get("Retry-After"), fetcher.clock().Now()), fmt.Errorf("invalid response code %d", resp.StatusCode)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return true, 0, fmt.Errorf("invalid response code %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return false, 0, fmt.Errorf("invalid response code %d", resp.StatusCode)
 	}
 
 	err = json.NewDecoder(resp.Body).Decode(value)
 	if err != nil {
 		logger.Error("decode-body", err)
-		return err
+		return false, 0, err
+	}
+
+	return false, 0, nil
+}
+
+// cancelContext returns a context that is cancelled when cancel is closed, so
+// that in-flight requests are abandoned along with the rest of the pipeline.
+// The returned stop function must be called once the request is done.
+func cancelContext(cancel <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, stop := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-cancel:
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, stop
+}
+
+func (fetcher *CCFetcher) backoff(attempt int) time.Duration {
+	delay := fetcher.RetryBaseDelay << uint(attempt)
+	if fetcher.RetryMaxDelay > 0 && (delay > fetcher.RetryMaxDelay || delay < fetcher.RetryBaseDelay) {
+		delay = fetcher.RetryMaxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if retryAt, err := http.ParseTime(value); err == nil {
+		return retryAt.Sub(now)
 	}
 
-	return nil
+	return 0
 }
 
 func (fetcher *CCFetcher) fingerprintURL(bulkToken string) string {
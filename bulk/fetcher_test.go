@@ -6,9 +6,13 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nsync/bulk"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/cloudfoundry/dropsonde/metrics"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
@@ -34,8 +38,10 @@ var _ = Describe("Fetcher", func() {
 		fetcher = &bulk.CCFetcher{
 			BaseURI:   fakeCC.URL(),
 			BatchSize: 2,
-			Username:  "the-username",
-			Password:  "the-password",
+			Authenticator: &bulk.BasicAuthenticator{
+				Username: "the-username",
+				Password: "the-password",
+			},
 		}
 	})
 
@@ -235,7 +241,7 @@ var _ = Describe("Fetcher", func() {
 			cancel           chan struct{}
 			fingerprintsChan chan []cc_messages.CCDesiredAppFingerprint
 
-			resultsChan <-chan []cc_messages.DesireAppRequestFromCC
+			resultsChan <-chan []recipebuilder.DesireAppRequest
 			errorsChan  <-chan error
 		)
 
@@ -249,7 +255,7 @@ var _ = Describe("Fetcher", func() {
 		})
 
 		Context("when retrieving desired app messages", func() {
-			var desireRequests []cc_messages.DesireAppRequestFromCC
+			var desireRequests []recipebuilder.DesireAppRequest
 
 			BeforeEach(func() {
 				routeInfo1, err := cc_messages.CCHTTPRoutes{
@@ -264,54 +270,63 @@ var _ = Describe("Fetcher", func() {
 				}.CCRouteInfo()
 				Expect(err).NotTo(HaveOccurred())
 
-				desireRequests = []cc_messages.DesireAppRequestFromCC{
+				desireRequests = []recipebuilder.DesireAppRequest{
 					{
-						ProcessGuid:  "process-guid-1",
-						DropletUri:   "source-url-1",
-						Stack:        "stack-1",
-						StartCommand: "start-command-1",
-						Environment: []*models.EnvironmentVariable{
-							{Name: "env-key-1", Value: "env-value-1"},
-							{Name: "env-key-2", Value: "env-value-2"},
+						DesireAppRequestFromCC: cc_messages.DesireAppRequestFromCC{
+							ProcessGuid:  "process-guid-1",
+							DropletUri:   "source-url-1",
+							Stack:        "stack-1",
+							StartCommand: "start-command-1",
+							Environment: []*models.EnvironmentVariable{
+								{Name: "env-key-1", Value: "env-value-1"},
+								{Name: "env-key-2", Value: "env-value-2"},
+							},
+							MemoryMB:        256,
+							DiskMB:          1024,
+							FileDescriptors: 16,
+							NumInstances:    2,
+							RoutingInfo:     routeInfo1,
+							LogGuid:         "log-guid-1",
+							ETag:            "1234567.1890",
 						},
-						MemoryMB:        256,
-						DiskMB:          1024,
-						FileDescriptors: 16,
-						NumInstances:    2,
-						RoutingInfo:     routeInfo1,
-						LogGuid:         "log-guid-1",
-						ETag:            "1234567.1890",
 					},
 					{
-						ProcessGuid:  "process-guid-2",
-						DropletUri:   "source-url-2",
-						Stack:        "stack-2",
-						StartCommand: "start-command-2",
-						Environment: []*models.EnvironmentVariable{
-							{Name: "env-key-3", Value: "env-value-3"},
-							{Name: "env-key-4", Value: "env-value-4"},
+						DesireAppRequestFromCC: cc_messages.DesireAppRequestFromCC{
+							ProcessGuid:  "process-guid-2",
+							DropletUri:   "source-url-2",
+							Stack:        "stack-2",
+							StartCommand: "start-command-2",
+							Environment: []*models.EnvironmentVariable{
+								{Name: "env-key-3", Value: "env-value-3"},
+								{Name: "env-key-4", Value: "env-value-4"},
+							},
+							MemoryMB:        512,
+							DiskMB:          2048,
+							FileDescriptors: 32,
+							NumInstances:    4,
+							RoutingInfo:     routeInfo2,
+							LogGuid:         "log-guid-2",
+							ETag:            "2345678.2901",
+						},
+						AppHealthCheck: recipebuilder.AppHealthCheck{
+							HealthCheckInvocationTimeoutInSeconds: 2,
 						},
-						MemoryMB:        512,
-						DiskMB:          2048,
-						FileDescriptors: 32,
-						NumInstances:    4,
-						RoutingInfo:     routeInfo2,
-						LogGuid:         "log-guid-2",
-						ETag:            "2345678.2901",
 					},
 					{
-						ProcessGuid:     "process-guid-3",
-						DropletUri:      "source-url-3",
-						Stack:           "stack-3",
-						StartCommand:    "start-command-3",
-						Environment:     []*models.EnvironmentVariable{},
-						MemoryMB:        128,
-						DiskMB:          512,
-						FileDescriptors: 8,
-						NumInstances:    4,
-						RoutingInfo:     make(cc_messages.CCRouteInfo),
-						LogGuid:         "log-guid-3",
-						ETag:            "3456789.3012",
+						DesireAppRequestFromCC: cc_messages.DesireAppRequestFromCC{
+							ProcessGuid:     "process-guid-3",
+							DropletUri:      "source-url-3",
+							Stack:           "stack-3",
+							StartCommand:    "start-command-3",
+							Environment:     []*models.EnvironmentVariable{},
+							MemoryMB:        128,
+							DiskMB:          512,
+							FileDescriptors: 8,
+							NumInstances:    4,
+							RoutingInfo:     make(cc_messages.CCRouteInfo),
+							LogGuid:         "log-guid-3",
+							ETag:            "3456789.3012",
+						},
 					},
 				}
 
@@ -671,5 +686,335 @@ var _ = Describe("Fetcher", func() {
 				})
 			})
 		})
+
+		Context("when cancelled while waiting for CC to respond", func() {
+			var release chan struct{}
+
+			BeforeEach(func() {
+				release = make(chan struct{})
+				httpClient = &http.Client{Timeout: time.Minute}
+
+				fakeCC.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+					<-release
+				})
+			})
+
+			AfterEach(func() {
+				close(release)
+			})
+
+			It("abandons the request", func() {
+				Eventually(fakeCC.ReceivedRequests).Should(HaveLen(1))
+				close(cancel)
+
+				Eventually(errorsChan).Should(Receive(HaveOccurred()))
+				Eventually(resultsChan).Should(BeClosed())
+			})
+		})
+	})
+
+	Describe("Retrying failed requests", func() {
+		var (
+			metricSender *fake.FakeMetricSender
+
+			fingerprintsResponse string
+		)
+
+		BeforeEach(func() {
+			metricSender = fake.NewFakeMetricSender()
+			metrics.Initialize(metricSender, nil)
+
+			fetcher = &bulk.CCFetcher{
+				BaseURI:   fakeCC.URL(),
+				BatchSize: 2,
+				Authenticator: &bulk.BasicAuthenticator{
+					Username: "the-username",
+					Password: "the-password",
+				},
+
+				MaxRetries:     2,
+				RetryBaseDelay: time.Millisecond,
+				RetryMaxDelay:  10 * time.Millisecond,
+			}
+
+			fingerprintsResponse = `{
+				"token": {"id":"the-token-id"},
+				"fingerprints": [
+					{
+						"process_guid": "process-guid-1",
+						"etag": "1234567.890"
+					}
+				]
+			}`
+		})
+
+		Context("when CC responds with a 5xx before succeeding", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.RespondWith(503, ""),
+					ghttp.RespondWith(500, ""),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/internal/bulk/apps", "batch_size=2&format=fingerprint&token={}"),
+						ghttp.VerifyBasicAuth("the-username", "the-password"),
+						ghttp.RespondWith(200, fingerprintsResponse),
+					),
+				)
+			})
+
+			It("retries the request and returns the results", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(resultsChan).Should(Receive(ConsistOf(
+					cc_messages.CCDesiredAppFingerprint{ProcessGuid: "process-guid-1", ETag: "1234567.890"},
+				)))
+				Eventually(errorsChan).Should(BeClosed())
+				Consistently(errorsChan).ShouldNot(Receive())
+
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(3))
+			})
+
+			It("emits a metric for each retry", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+				Eventually(resultsChan).Should(BeClosed())
+				Eventually(errorsChan).Should(BeClosed())
+
+				Expect(metricSender.GetCounter("NsyncCCRequestRetries")).To(BeEquivalentTo(2))
+			})
+		})
+
+		Context("when CC keeps failing", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.RespondWith(502, ""),
+					ghttp.RespondWith(502, ""),
+					ghttp.RespondWith(502, ""),
+				)
+			})
+
+			It("gives up after the maximum number of retries", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(errorsChan).Should(Receive(MatchError(ContainSubstring("502"))))
+				Eventually(resultsChan).Should(BeClosed())
+
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(3))
+			})
+		})
+
+		Context("when CC responds with a client error", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(ghttp.RespondWith(403, ""))
+			})
+
+			It("does not retry", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(errorsChan).Should(Receive(MatchError(ContainSubstring("403"))))
+				Eventually(resultsChan).Should(BeClosed())
+
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+				Expect(metricSender.GetCounter("NsyncCCRequestRetries")).To(BeEquivalentTo(0))
+			})
+		})
+
+		Context("when CC rejects a cached token", func() {
+			var fakeUAA *ghttp.Server
+
+			BeforeEach(func() {
+				fakeUAA = ghttp.NewServer()
+				fakeUAA.AppendHandlers(
+					ghttp.RespondWithJSONEncoded(200, map[string]interface{}{"access_token": "revoked-token", "expires_in": 600}),
+					ghttp.RespondWithJSONEncoded(200, map[string]interface{}{"access_token": "fresh-token", "expires_in": 600}),
+				)
+
+				fetcher = &bulk.CCFetcher{
+					BaseURI:   fakeCC.URL(),
+					BatchSize: 2,
+					Authenticator: bulk.NewUAATokenAuthenticator(
+						fakeUAA.URL()+"/oauth/token",
+						"nsync",
+						"secret",
+						&http.Client{Timeout: time.Second},
+						fakeclock.NewFakeClock(time.Now()),
+					),
+
+					MaxRetries:     2,
+					RetryBaseDelay: time.Millisecond,
+					RetryMaxDelay:  10 * time.Millisecond,
+				}
+
+				fakeCC.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyHeaderKV("Authorization", "bearer revoked-token"),
+						ghttp.RespondWith(401, ""),
+					),
+					ghttp.CombineHandlers(
+						ghttp.VerifyHeaderKV("Authorization", "bearer fresh-token"),
+						ghttp.RespondWith(200, fingerprintsResponse),
+					),
+				)
+			})
+
+			AfterEach(func() {
+				fakeUAA.Close()
+			})
+
+			It("fetches a new token and retries", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(resultsChan).Should(Receive(HaveLen(1)))
+				Eventually(errorsChan).Should(BeClosed())
+
+				Expect(fakeUAA.ReceivedRequests()).To(HaveLen(2))
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+			})
+		})
+
+		Context("when CC rejects basic auth credentials", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(ghttp.RespondWith(401, ""))
+			})
+
+			It("does not retry", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(errorsChan).Should(Receive(MatchError(ContainSubstring("401"))))
+				Eventually(resultsChan).Should(BeClosed())
+
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when CC is rate limiting", func() {
+			var (
+				fakeClock  *fakeclock.FakeClock
+				retryAfter string
+			)
+
+			BeforeEach(func() {
+				fakeClock = fakeclock.NewFakeClock(time.Now())
+				retryAfter = "30"
+
+				fetcher = &bulk.CCFetcher{
+					BaseURI:   fakeCC.URL(),
+					BatchSize: 2,
+
+					MaxRetries:     2,
+					RetryBaseDelay: time.Millisecond,
+					RetryMaxDelay:  time.Minute,
+					Clock:          fakeClock,
+				}
+			})
+
+			JustBeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.RespondWith(429, "", http.Header{"Retry-After": []string{retryAfter}}),
+					ghttp.RespondWith(200, fingerprintsResponse),
+				)
+			})
+
+			It("waits as long as CC asks before retrying", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(fakeClock.WatcherCount).Should(Equal(1))
+				fakeClock.Increment(29 * time.Second)
+				Consistently(fakeCC.ReceivedRequests).Should(HaveLen(1))
+
+				fakeClock.Increment(time.Second)
+				Eventually(resultsChan).Should(Receive(HaveLen(1)))
+				Eventually(errorsChan).Should(BeClosed())
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+			})
+
+			Context("when CC asks for longer than the maximum delay", func() {
+				BeforeEach(func() {
+					retryAfter = "3600"
+				})
+
+				It("waits only for the maximum delay", func() {
+					resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+					Eventually(fakeClock.WatcherCount).Should(Equal(1))
+					fakeClock.Increment(time.Minute)
+
+					Eventually(resultsChan).Should(Receive(HaveLen(1)))
+					Eventually(errorsChan).Should(BeClosed())
+					Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+				})
+			})
+		})
+
+		Context("when the connection fails", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					func(w http.ResponseWriter, req *http.Request) {
+						time.Sleep(100 * time.Millisecond)
+					},
+					ghttp.RespondWith(200, fingerprintsResponse),
+				)
+
+				httpClient = &http.Client{Timeout: 50 * time.Millisecond}
+			})
+
+			It("retries the request", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(resultsChan).Should(Receive(HaveLen(1)))
+				Eventually(errorsChan).Should(BeClosed())
+			})
+		})
+
+		Context("when fetching desired apps fails with a 5xx", func() {
+			BeforeEach(func() {
+				fakeCC.AppendHandlers(
+					ghttp.RespondWith(503, ""),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/internal/bulk/apps"),
+						ghttp.VerifyJSON(`["process-guid-1"]`),
+						ghttp.RespondWithJSONEncoded(200, []cc_messages.DesireAppRequestFromCC{
+							{ProcessGuid: "process-guid-1"},
+						}),
+					),
+				)
+			})
+
+			It("retries the request with the same payload", func() {
+				fingerprintsChan := make(chan []cc_messages.CCDesiredAppFingerprint, 1)
+				fingerprintsChan <- []cc_messages.CCDesiredAppFingerprint{
+					{ProcessGuid: "process-guid-1", ETag: "1234567.890"},
+				}
+				close(fingerprintsChan)
+
+				resultsChan, errorsChan := fetcher.FetchDesiredApps(logger, cancel, httpClient, fingerprintsChan)
+
+				Eventually(resultsChan).Should(Receive(HaveLen(1)))
+				Eventually(errorsChan).Should(BeClosed())
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+			})
+		})
+
+		Context("when cancelled while waiting to retry", func() {
+			BeforeEach(func() {
+				fetcher = &bulk.CCFetcher{
+					BaseURI:   fakeCC.URL(),
+					BatchSize: 2,
+
+					MaxRetries:     2,
+					RetryBaseDelay: time.Hour,
+				}
+
+				fakeCC.AppendHandlers(ghttp.RespondWith(503, ""))
+			})
+
+			It("stops retrying", func() {
+				resultsChan, errorsChan := fetcher.FetchFingerprints(logger, cancel, httpClient)
+
+				Eventually(fakeCC.ReceivedRequests).Should(HaveLen(1))
+				close(cancel)
+
+				Eventually(errorsChan).Should(Receive(MatchError(ContainSubstring("503"))))
+				Eventually(resultsChan).Should(BeClosed())
+			})
+		})
 	})
 })
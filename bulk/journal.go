@@ -0,0 +1,302 @@
+package bulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+const (
+	JournalCreate = "create"
+	JournalUpdate = "update"
+	JournalDelete = "delete"
+)
+
+// JournalEntry records a single change the LRPProcessor made to the BBS.
+// Before and After hold the scheduling info on either side of the change;
+// DesiredLRP is the definition that was created or deleted. Segments are
+// written with their secrets redacted and marked as such. The definitions
+// themselves go to a sidecar file only the bulker can read, from which
+// ReadJournalSegment restores them so that they can be desired again.
+type JournalEntry struct {
+	Timestamp   int64                            `json:"timestamp"`
+	Action      string                           `json:"action"`
+	ProcessGuid string                           `json:"process_guid"`
+	Before      *models.DesiredLRPSchedulingInfo `json:"before,omitempty"`
+	After       *models.DesiredLRPSchedulingInfo `json:"after,omitempty"`
+	DesiredLRP  *models.DesiredLRP               `json:"desired_lrp,omitempty"`
+	Redacted    bool                             `json:"redacted,omitempty"`
+}
+
+const (
+	journalSegmentPrefix     = "lrp-sync-"
+	journalSegmentSuffix     = ".jsonl"
+	journalDefinitionsSuffix = ".definitions"
+)
+
+// journalDefinition is the unredacted DesiredLRP of the entry at index Entry
+// of a segment.
+type journalDefinition struct {
+	Entry      int                `json:"entry"`
+	DesiredLRP *models.DesiredLRP `json:"desired_lrp"`
+}
+
+// Journal writes one append-only JSON lines segment per sync into a directory,
+// keeping at most maxSegments of them. A maxSegments of 0 keeps every segment.
+type Journal struct {
+	dir         string
+	maxSegments int
+}
+
+func NewJournal(dir string, maxSegments int) *Journal {
+	return &Journal{dir: dir, maxSegments: maxSegments}
+}
+
+// OpenSegment returns the segment for the sync started at syncStart. Its file
+// is only created once the first entry is recorded, so syncs that change
+// nothing leave no segment behind.
+func (j *Journal) OpenSegment(syncStart time.Time) *JournalSegment {
+	return &JournalSegment{
+		path: filepath.Join(j.dir, fmt.Sprintf("%s%d%s", journalSegmentPrefix, syncStart.UnixNano(), journalSegmentSuffix)),
+	}
+}
+
+// Prune removes the oldest segments beyond maxSegments and returns their paths.
+func (j *Journal) Prune() ([]string, error) {
+	if j.maxSegments <= 0 {
+		return nil, nil
+	}
+
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []journalSegmentFile{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, journalSegmentPrefix) || !strings.HasSuffix(name, journalSegmentSuffix) {
+			continue
+		}
+
+		syncStart, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, journalSegmentPrefix), journalSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, journalSegmentFile{path: filepath.Join(j.dir, name), syncStart: syncStart})
+	}
+
+	if len(segments) <= j.maxSegments {
+		return nil, nil
+	}
+
+	sort.Sort(bySyncStart(segments))
+
+	pruned := []string{}
+	for _, segment := range segments[:len(segments)-j.maxSegments] {
+		err := os.Remove(segment.path)
+		if err != nil {
+			return pruned, err
+		}
+		err = os.Remove(segment.path + journalDefinitionsSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return pruned, err
+		}
+		pruned = append(pruned, segment.path)
+	}
+
+	return pruned, nil
+}
+
+type journalSegmentFile struct {
+	path      string
+	syncStart int64
+}
+
+type bySyncStart []journalSegmentFile
+
+func (s bySyncStart) Len() int           { return len(s) }
+func (s bySyncStart) Less(i, j int) bool { return s[i].syncStart < s[j].syncStart }
+func (s bySyncStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type JournalSegment struct {
+	path string
+
+	lock               sync.Mutex
+	file               *os.File
+	encoder            *json.Encoder
+	definitionsFile    *os.File
+	definitionsEncoder *json.Encoder
+	entries            int
+}
+
+func (s *JournalSegment) Path() string {
+	return s.path
+}
+
+func (s *JournalSegment) Record(entry JournalEntry) error {
+	definition := entry.DesiredLRP
+
+	entry, err := redactJournalEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.file = file
+		s.encoder = json.NewEncoder(file)
+	}
+
+	if definition != nil {
+		if s.definitionsFile == nil {
+			file, err := os.OpenFile(s.path+journalDefinitionsSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return err
+			}
+			s.definitionsFile = file
+			s.definitionsEncoder = json.NewEncoder(file)
+		}
+
+		err = s.definitionsEncoder.Encode(journalDefinition{Entry: s.entries, DesiredLRP: definition})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.encoder.Encode(entry)
+	if err != nil {
+		return err
+	}
+
+	s.entries++
+	return nil
+}
+
+// Entries returns how many entries were recorded since the segment was opened.
+func (s *JournalSegment) Entries() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.entries
+}
+
+func (s *JournalSegment) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.definitionsFile != nil {
+		err := s.definitionsFile.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// ReadJournalSegment reads the entries of a segment and restores their
+// definitions from its sidecar file, when there is one. Restored entries are
+// no longer marked as redacted.
+func ReadJournalSegment(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []JournalEntry{}
+	decoder := json.NewDecoder(file)
+	for {
+		var entry JournalEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid journal entry %d in %s: %s", len(entries)+1, path, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	err = restoreJournalDefinitions(path+journalDefinitionsSuffix, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func restoreJournalDefinitions(path string, entries []JournalEntry) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for {
+		var definition journalDefinition
+		err := decoder.Decode(&definition)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid journal definition in %s: %s", path, err)
+		}
+
+		if definition.Entry < 0 || definition.Entry >= len(entries) || definition.DesiredLRP == nil {
+			continue
+		}
+		entries[definition.Entry].DesiredLRP = definition.DesiredLRP
+		entries[definition.Entry].Redacted = false
+	}
+}
+
+func updatedSchedulingInfo(info *models.DesiredLRPSchedulingInfo, update *models.DesiredLRPUpdate) *models.DesiredLRPSchedulingInfo {
+	updated := *info
+	if update.Instances != nil {
+		updated.Instances = *update.Instances
+	}
+	if update.Annotation != nil {
+		updated.Annotation = *update.Annotation
+	}
+	if update.Routes != nil {
+		updated.Routes = *update.Routes
+	}
+	return &updated
+}
+
+func schedulingInfoUpdate(info *models.DesiredLRPSchedulingInfo) *models.DesiredLRPUpdate {
+	instances := info.Instances
+	annotation := info.Annotation
+	routes := info.Routes
+
+	return &models.DesiredLRPUpdate{
+		Instances:  &instances,
+		Annotation: &annotation,
+		Routes:     &routes,
+	}
+}
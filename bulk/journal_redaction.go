@@ -0,0 +1,168 @@
+package bulk
+
+import (
+	"encoding/json"
+	"strings"
+
+	"code.cloudfoundry.org/bbs/models"
+	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
+)
+
+const redactedValue = "[REDACTED]"
+
+// sshdSecretFlags are the diego-sshd arguments that carry key material.
+var sshdSecretFlags = []string{"-hostKey=", "-authorizedKey="}
+
+// redactJournalEntry returns a copy of the entry without the secrets an LRP
+// carries: environment variable values, the registry password, the sshd keys
+// and the private key of the ssh route.
+func redactJournalEntry(entry JournalEntry) (JournalEntry, error) {
+	var err error
+
+	entry.Before, err = redactSchedulingInfo(entry.Before)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	entry.After, err = redactSchedulingInfo(entry.After)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	entry.DesiredLRP, err = redactDesiredLRP(entry.DesiredLRP)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	entry.Redacted = true
+	return entry, nil
+}
+
+func redactSchedulingInfo(info *models.DesiredLRPSchedulingInfo) (*models.DesiredLRPSchedulingInfo, error) {
+	if info == nil {
+		return nil, nil
+	}
+
+	redacted := *info
+	routes, err := redactRoutes(info.Routes)
+	if err != nil {
+		return nil, err
+	}
+	redacted.Routes = routes
+
+	return &redacted, nil
+}
+
+func redactDesiredLRP(desired *models.DesiredLRP) (*models.DesiredLRP, error) {
+	if desired == nil {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted := &models.DesiredLRP{}
+	err = json.Unmarshal(payload, redacted)
+	if err != nil {
+		return nil, err
+	}
+
+	redactEnv(redacted.EnvironmentVariables)
+	redactAction(redacted.Setup)
+	redactAction(redacted.Action)
+	redactAction(redacted.Monitor)
+
+	if redacted.ImagePassword != "" {
+		redacted.ImagePassword = redactedValue
+	}
+
+	if redacted.Routes != nil {
+		routes, err := redactRoutes(*redacted.Routes)
+		if err != nil {
+			return nil, err
+		}
+		redacted.Routes = &routes
+	}
+
+	return redacted, nil
+}
+
+func redactRoutes(routes models.Routes) (models.Routes, error) {
+	message, ok := routes[ssh_routes.DIEGO_SSH]
+	if !ok || message == nil {
+		return routes, nil
+	}
+
+	var sshRoute ssh_routes.SSHRoute
+	err := json.Unmarshal(*message, &sshRoute)
+	if err != nil {
+		return nil, err
+	}
+	sshRoute.PrivateKey = redactedValue
+
+	payload, err := json.Marshal(sshRoute)
+	if err != nil {
+		return nil, err
+	}
+	redactedMessage := json.RawMessage(payload)
+
+	redacted := make(models.Routes, len(routes))
+	for key, value := range routes {
+		redacted[key] = value
+	}
+	redacted[ssh_routes.DIEGO_SSH] = &redactedMessage
+
+	return redacted, nil
+}
+
+func redactAction(action *models.Action) {
+	if action == nil {
+		return
+	}
+
+	switch {
+	case action.RunAction != nil:
+		redactEnv(action.RunAction.Env)
+		if action.RunAction.Path == sshdPath {
+			redactSSHDArgs(action.RunAction.Args)
+		}
+	case action.TimeoutAction != nil:
+		redactAction(action.TimeoutAction.Action)
+	case action.EmitProgressAction != nil:
+		redactAction(action.EmitProgressAction.Action)
+	case action.TryAction != nil:
+		redactAction(action.TryAction.Action)
+	case action.ParallelAction != nil:
+		redactActions(action.ParallelAction.Actions)
+	case action.SerialAction != nil:
+		redactActions(action.SerialAction.Actions)
+	case action.CodependentAction != nil:
+		redactActions(action.CodependentAction.Actions)
+	}
+}
+
+func redactActions(actions []*models.Action) {
+	for _, action := range actions {
+		redactAction(action)
+	}
+}
+
+func redactEnv(env []*models.EnvironmentVariable) {
+	for _, variable := range env {
+		if variable != nil {
+			variable.Value = redactedValue
+		}
+	}
+}
+
+func redactSSHDArgs(args []string) {
+	for i, arg := range args {
+		for _, flag := range sshdSecretFlags {
+			if strings.HasPrefix(arg, flag) {
+				args[i] = flag + redactedValue
+			}
+		}
+	}
+}
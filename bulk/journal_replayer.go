@@ -0,0 +1,221 @@
+package bulk
+
+import (
+	"errors"
+	"fmt"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
+	"code.cloudfoundry.org/lager"
+)
+
+var (
+	ErrJournalEntryIncomplete = errors.New("journal entry does not carry the state needed to apply it")
+	ErrJournalEntryRedacted   = errors.New("journal entry was redacted and its definition file is missing, so its LRP cannot be desired again")
+)
+
+// JournalReplayer applies journal entries to the BBS, either redoing the
+// recorded changes or undoing them. Entries that are already in the desired
+// state (e.g. a create whose LRP exists) are skipped rather than failed.
+type JournalReplayer struct {
+	bbsClient bbs.Client
+	logger    lager.Logger
+}
+
+func NewJournalReplayer(logger lager.Logger, bbsClient bbs.Client) *JournalReplayer {
+	return &JournalReplayer{
+		bbsClient: bbsClient,
+		logger:    logger,
+	}
+}
+
+func (r *JournalReplayer) Replay(entries []JournalEntry) error {
+	logger := r.logger.Session("replay-journal", lager.Data{"num-entries": len(entries)})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	err := checkJournalEntries(entries, false)
+	if err != nil {
+		logger.Error("refusing-to-replay", err)
+		return err
+	}
+
+	failed := 0
+	for _, entry := range entries {
+		var err error
+		switch entry.Action {
+		case JournalCreate:
+			err = r.desire(logger, entry)
+		case JournalUpdate:
+			err = r.update(logger, entry.ProcessGuid, entry.After, entry.Redacted)
+		case JournalDelete:
+			err = r.remove(logger, entry.ProcessGuid)
+		default:
+			err = fmt.Errorf("unknown journal action %q", entry.Action)
+		}
+
+		if err != nil {
+			logger.Error("failed-to-replay-entry", err, lager.Data{"process-guid": entry.ProcessGuid, "action": entry.Action})
+			failed++
+		}
+	}
+
+	return failedEntriesError(failed, len(entries))
+}
+
+// Revert undoes the entries newest first. A segment that has an entry which
+// cannot be undone is refused as a whole, so that reverting a replacement
+// never removes an LRP it cannot desire again.
+func (r *JournalReplayer) Revert(entries []JournalEntry) error {
+	logger := r.logger.Session("revert-journal", lager.Data{"num-entries": len(entries)})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	err := checkJournalEntries(entries, true)
+	if err != nil {
+		logger.Error("refusing-to-revert", err)
+		return err
+	}
+
+	failed := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		var err error
+		switch entry.Action {
+		case JournalCreate:
+			err = r.remove(logger, entry.ProcessGuid)
+		case JournalUpdate:
+			err = r.update(logger, entry.ProcessGuid, entry.Before, entry.Redacted)
+		case JournalDelete:
+			err = r.desire(logger, entry)
+		default:
+			err = fmt.Errorf("unknown journal action %q", entry.Action)
+		}
+
+		if err != nil {
+			logger.Error("failed-to-revert-entry", err, lager.Data{"process-guid": entry.ProcessGuid, "action": entry.Action})
+			failed++
+		}
+	}
+
+	return failedEntriesError(failed, len(entries))
+}
+
+// checkJournalEntries makes sure that every entry carries the state needed to
+// replay it, or to revert it when revert is set, before anything is applied.
+func checkJournalEntries(entries []JournalEntry, revert bool) error {
+	for i, entry := range entries {
+		var err error
+		switch entry.Action {
+		case JournalCreate:
+			if !revert {
+				err = checkDesirable(entry)
+			}
+		case JournalUpdate:
+			if (revert && entry.Before == nil) || (!revert && entry.After == nil) {
+				err = ErrJournalEntryIncomplete
+			}
+		case JournalDelete:
+			if revert {
+				err = checkDesirable(entry)
+			}
+		default:
+			err = fmt.Errorf("unknown journal action %q", entry.Action)
+		}
+
+		if err != nil {
+			return fmt.Errorf("journal entry %d (%s %s): %s", i+1, entry.Action, entry.ProcessGuid, err)
+		}
+	}
+
+	return nil
+}
+
+func checkDesirable(entry JournalEntry) error {
+	if entry.DesiredLRP == nil {
+		return ErrJournalEntryIncomplete
+	}
+	if entry.Redacted {
+		return ErrJournalEntryRedacted
+	}
+	return nil
+}
+
+func (r *JournalReplayer) desire(logger lager.Logger, entry JournalEntry) error {
+	err := checkDesirable(entry)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("desiring-lrp", lager.Data{"process-guid": entry.ProcessGuid})
+	err = r.bbsClient.DesireLRP(logger, entry.DesiredLRP)
+	if err != nil && models.ConvertError(err).Type == models.Error_ResourceExists {
+		logger.Info("desired-lrp-already-exists", lager.Data{"process-guid": entry.ProcessGuid})
+		return nil
+	}
+	return err
+}
+
+func (r *JournalReplayer) update(logger lager.Logger, processGuid string, schedulingInfo *models.DesiredLRPSchedulingInfo, redacted bool) error {
+	if schedulingInfo == nil {
+		return ErrJournalEntryIncomplete
+	}
+
+	update := schedulingInfoUpdate(schedulingInfo)
+	if redacted {
+		err := r.restoreSSHRoute(logger, processGuid, update)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("updating-lrp", lager.Data{"process-guid": processGuid, "annotation": schedulingInfo.Annotation})
+	return r.bbsClient.UpdateDesiredLRP(logger, processGuid, update)
+}
+
+// restoreSSHRoute swaps the redacted ssh route of an update for the one the
+// LRP carries now, so that replaying the routes does not break ssh access.
+func (r *JournalReplayer) restoreSSHRoute(logger lager.Logger, processGuid string, update *models.DesiredLRPUpdate) error {
+	if _, ok := (*update.Routes)[ssh_routes.DIEGO_SSH]; !ok {
+		return nil
+	}
+
+	current, err := r.bbsClient.DesiredLRPByProcessGuid(logger, processGuid)
+	if err != nil {
+		return err
+	}
+
+	routes := models.Routes{}
+	for key, value := range *update.Routes {
+		if key != ssh_routes.DIEGO_SSH {
+			routes[key] = value
+		}
+	}
+	if current.Routes != nil {
+		if sshRoute, ok := (*current.Routes)[ssh_routes.DIEGO_SSH]; ok {
+			routes[ssh_routes.DIEGO_SSH] = sshRoute
+		}
+	}
+	update.Routes = &routes
+
+	return nil
+}
+
+func (r *JournalReplayer) remove(logger lager.Logger, processGuid string) error {
+	logger.Info("removing-lrp", lager.Data{"process-guid": processGuid})
+	err := r.bbsClient.RemoveDesiredLRP(logger, processGuid)
+	if err != nil && models.ConvertError(err).Type == models.Error_ResourceNotFound {
+		logger.Info("desired-lrp-already-removed", lager.Data{"process-guid": processGuid})
+		return nil
+	}
+	return err
+}
+
+func failedEntriesError(failed, total int) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d journal entries failed to apply", failed, total)
+}
@@ -0,0 +1,247 @@
+package bulk_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/bulk"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JournalReplayer", func() {
+	var (
+		bbsClient *fake_bbs.FakeClient
+		replayer  *bulk.JournalReplayer
+		entries   []bulk.JournalEntry
+
+		createdLRP *models.DesiredLRP
+		deletedLRP *models.DesiredLRP
+		before     *models.DesiredLRPSchedulingInfo
+		after      *models.DesiredLRPSchedulingInfo
+	)
+
+	BeforeEach(func() {
+		bbsClient = new(fake_bbs.FakeClient)
+		replayer = bulk.NewJournalReplayer(lagertest.NewTestLogger("test"), bbsClient)
+
+		createdLRP = &models.DesiredLRP{ProcessGuid: "created-guid", Instances: 1}
+		deletedLRP = &models.DesiredLRP{ProcessGuid: "deleted-guid", Instances: 2}
+
+		before = &models.DesiredLRPSchedulingInfo{
+			DesiredLRPKey: models.NewDesiredLRPKey("updated-guid", "cf-apps", "log-guid"),
+			Annotation:    "old-etag",
+			Instances:     1,
+			Routes:        models.Routes{},
+		}
+		after = &models.DesiredLRPSchedulingInfo{
+			DesiredLRPKey: models.NewDesiredLRPKey("updated-guid", "cf-apps", "log-guid"),
+			Annotation:    "new-etag",
+			Instances:     4,
+			Routes:        models.Routes{},
+		}
+
+		entries = []bulk.JournalEntry{
+			{Action: bulk.JournalCreate, ProcessGuid: "created-guid", DesiredLRP: createdLRP},
+			{Action: bulk.JournalUpdate, ProcessGuid: "updated-guid", Before: before, After: after},
+			{Action: bulk.JournalDelete, ProcessGuid: "deleted-guid", DesiredLRP: deletedLRP},
+		}
+	})
+
+	Describe("Replay", func() {
+		It("redoes each change", func() {
+			Expect(replayer.Replay(entries)).To(Succeed())
+
+			Expect(bbsClient.DesireLRPCallCount()).To(Equal(1))
+			_, desired := bbsClient.DesireLRPArgsForCall(0)
+			Expect(desired).To(Equal(createdLRP))
+
+			Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(1))
+			_, processGuid, update := bbsClient.UpdateDesiredLRPArgsForCall(0)
+			Expect(processGuid).To(Equal("updated-guid"))
+			Expect(*update.Instances).To(Equal(int32(4)))
+			Expect(*update.Annotation).To(Equal("new-etag"))
+
+			Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+			_, removed := bbsClient.RemoveDesiredLRPArgsForCall(0)
+			Expect(removed).To(Equal("deleted-guid"))
+		})
+
+		It("skips changes that are already in place", func() {
+			bbsClient.DesireLRPReturns(models.ErrResourceExists)
+			bbsClient.RemoveDesiredLRPReturns(models.ErrResourceNotFound)
+
+			Expect(replayer.Replay(entries)).To(Succeed())
+		})
+
+		It("applies every entry and reports how many failed", func() {
+			bbsClient.DesireLRPReturns(errors.New("oh no"))
+
+			err := replayer.Replay(entries)
+			Expect(err).To(MatchError("1 of 3 journal entries failed to apply"))
+			Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(1))
+			Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("Revert", func() {
+		It("undoes each change, newest first", func() {
+			var calls []string
+			bbsClient.DesireLRPStub = func(_ lager.Logger, desired *models.DesiredLRP) error {
+				calls = append(calls, "desire "+desired.ProcessGuid)
+				return nil
+			}
+			bbsClient.UpdateDesiredLRPStub = func(_ lager.Logger, processGuid string, _ *models.DesiredLRPUpdate) error {
+				calls = append(calls, "update "+processGuid)
+				return nil
+			}
+			bbsClient.RemoveDesiredLRPStub = func(_ lager.Logger, processGuid string) error {
+				calls = append(calls, "remove "+processGuid)
+				return nil
+			}
+
+			Expect(replayer.Revert(entries)).To(Succeed())
+			Expect(calls).To(Equal([]string{
+				"desire deleted-guid",
+				"update updated-guid",
+				"remove created-guid",
+			}))
+
+			_, desired := bbsClient.DesireLRPArgsForCall(0)
+			Expect(desired).To(Equal(deletedLRP))
+
+			_, _, update := bbsClient.UpdateDesiredLRPArgsForCall(0)
+			Expect(*update.Instances).To(Equal(int32(1)))
+			Expect(*update.Annotation).To(Equal("old-etag"))
+		})
+
+		Context("when an update was redacted", func() {
+			var currentSSHRoute, redactedSSHRoute json.RawMessage
+
+			BeforeEach(func() {
+				currentSSHRoute = json.RawMessage(`{"container_port":2222,"private_key":"current-key"}`)
+				redactedSSHRoute = json.RawMessage(`{"container_port":2222,"private_key":"[REDACTED]"}`)
+				before.Routes = models.Routes{ssh_routes.DIEGO_SSH: &redactedSSHRoute}
+				entries[1].Redacted = true
+
+				bbsClient.DesiredLRPByProcessGuidReturns(&models.DesiredLRP{
+					ProcessGuid: "updated-guid",
+					Routes:      &models.Routes{ssh_routes.DIEGO_SSH: &currentSSHRoute},
+				}, nil)
+			})
+
+			It("keeps the ssh route the LRP has now", func() {
+				Expect(replayer.Revert(entries)).To(Succeed())
+
+				Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(1))
+				_, _, update := bbsClient.UpdateDesiredLRPArgsForCall(0)
+				Expect(*update.Routes).To(HaveKeyWithValue(ssh_routes.DIEGO_SSH, &currentSSHRoute))
+			})
+		})
+
+		Context("when a deleted LRP's definition was redacted", func() {
+			BeforeEach(func() {
+				entries[2].Redacted = true
+			})
+
+			It("refuses the whole segment without calling the bbs", func() {
+				err := replayer.Revert(entries)
+				Expect(err).To(MatchError(ContainSubstring(bulk.ErrJournalEntryRedacted.Error())))
+
+				Expect(bbsClient.DesireLRPCallCount()).To(Equal(0))
+				Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(0))
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a deletion was journaled without its definition", func() {
+			BeforeEach(func() {
+				entries = []bulk.JournalEntry{{Action: bulk.JournalDelete, ProcessGuid: "deleted-guid"}}
+			})
+
+			It("fails without calling the bbs", func() {
+				err := replayer.Revert(entries)
+				Expect(err).To(MatchError(ContainSubstring(bulk.ErrJournalEntryIncomplete.Error())))
+				Expect(bbsClient.DesireLRPCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("with a segment the journal recorded", func() {
+			var (
+				journalDir string
+				segment    *bulk.JournalSegment
+				original   *models.DesiredLRP
+				rebuilt    *models.DesiredLRP
+			)
+
+			BeforeEach(func() {
+				var err error
+				journalDir, err = ioutil.TempDir("", "journal")
+				Expect(err).NotTo(HaveOccurred())
+
+				segment = bulk.NewJournal(journalDir, 0).OpenSegment(time.Unix(0, 1234))
+
+				original = &models.DesiredLRP{
+					ProcessGuid:          "some-guid",
+					Instances:            2,
+					ImagePassword:        "registry-password",
+					EnvironmentVariables: []*models.EnvironmentVariable{{Name: "DATABASE_URL", Value: "postgres://secret"}},
+				}
+				rebuilt = &models.DesiredLRP{ProcessGuid: "some-guid", Instances: 2, MemoryMb: 512}
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(journalDir)
+			})
+
+			revert := func() {
+				Expect(segment.Close()).To(Succeed())
+
+				entries, err := bulk.ReadJournalSegment(segment.Path())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(replayer.Revert(entries)).To(Succeed())
+			}
+
+			It("desires a deleted LRP again with its secrets", func() {
+				Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalDelete, ProcessGuid: "some-guid", DesiredLRP: original})).To(Succeed())
+
+				revert()
+
+				Expect(bbsClient.DesireLRPCallCount()).To(Equal(1))
+				_, desired := bbsClient.DesireLRPArgsForCall(0)
+				Expect(desired).To(Equal(original))
+			})
+
+			It("swaps a replaced LRP back for the original", func() {
+				var calls []string
+				bbsClient.DesireLRPStub = func(_ lager.Logger, desired *models.DesiredLRP) error {
+					calls = append(calls, fmt.Sprintf("desire %s with %d MB", desired.ProcessGuid, desired.MemoryMb))
+					return nil
+				}
+				bbsClient.RemoveDesiredLRPStub = func(_ lager.Logger, processGuid string) error {
+					calls = append(calls, "remove "+processGuid)
+					return nil
+				}
+
+				Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalDelete, ProcessGuid: "some-guid", DesiredLRP: original})).To(Succeed())
+				Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalCreate, ProcessGuid: "some-guid", DesiredLRP: rebuilt})).To(Succeed())
+
+				revert()
+
+				Expect(calls).To(Equal([]string{"remove some-guid", "desire some-guid with 0 MB"}))
+				_, desired := bbsClient.DesireLRPArgsForCall(0)
+				Expect(desired).To(Equal(original))
+			})
+		})
+	})
+})
@@ -0,0 +1,246 @@
+package bulk_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
+	"code.cloudfoundry.org/nsync/bulk"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	var (
+		journalDir string
+		journal    *bulk.Journal
+		syncStart  time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		journalDir, err = ioutil.TempDir("", "journal")
+		Expect(err).NotTo(HaveOccurred())
+
+		journal = bulk.NewJournal(journalDir, 0)
+		syncStart = time.Unix(0, 1234)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(journalDir)
+	})
+
+	It("writes a segment per sync that can be read back", func() {
+		segment := journal.OpenSegment(syncStart)
+		Expect(segment.Path()).To(Equal(filepath.Join(journalDir, "lrp-sync-1234.jsonl")))
+
+		before := &models.DesiredLRPSchedulingInfo{
+			DesiredLRPKey: models.NewDesiredLRPKey("some-guid", "cf-apps", "log-guid"),
+			Annotation:    "old-etag",
+			Instances:     1,
+		}
+		after := &models.DesiredLRPSchedulingInfo{
+			DesiredLRPKey: models.NewDesiredLRPKey("some-guid", "cf-apps", "log-guid"),
+			Annotation:    "new-etag",
+			Instances:     3,
+		}
+
+		entries := []bulk.JournalEntry{
+			{
+				Timestamp:   1,
+				Action:      bulk.JournalCreate,
+				ProcessGuid: "new-guid",
+				DesiredLRP:  &models.DesiredLRP{ProcessGuid: "new-guid", Domain: "cf-apps", Instances: 2},
+			},
+			{Timestamp: 2, Action: bulk.JournalUpdate, ProcessGuid: "some-guid", Before: before, After: after},
+		}
+
+		for _, entry := range entries {
+			Expect(segment.Record(entry)).To(Succeed())
+		}
+		Expect(segment.Close()).To(Succeed())
+
+		contents, err := ioutil.ReadFile(segment.Path())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents).To(HaveSuffix("\n"))
+
+		readEntries, err := bulk.ReadJournalSegment(segment.Path())
+		Expect(err).NotTo(HaveOccurred())
+		// the created LRP is restored from the definitions file; the update
+		// carries no definition, so it stays redacted.
+		entries[1].Redacted = true
+		Expect(readEntries).To(Equal(entries))
+	})
+
+	It("redacts the secrets of the LRPs it records", func() {
+		sshRoute := json.RawMessage(`{"container_port":2222,"private_key":"ssh-private-key","host_fingerprint":"fingerprint"}`)
+		desired := &models.DesiredLRP{
+			ProcessGuid:          "some-guid",
+			ImageUsername:        "user",
+			ImagePassword:        "registry-password",
+			EnvironmentVariables: []*models.EnvironmentVariable{{Name: "DATABASE_URL", Value: "postgres://secret"}},
+			Action: models.WrapAction(models.Codependent(
+				&models.RunAction{
+					Path: "/tmp/lifecycle/launcher",
+					Env:  []*models.EnvironmentVariable{{Name: "API_KEY", Value: "api-secret"}},
+				},
+				&models.RunAction{
+					Path: "/tmp/lifecycle/diego-sshd",
+					Args: []string{"-address=0.0.0.0:2222", "-hostKey=host-private-key", "-authorizedKey=authorized-key"},
+				},
+			)),
+			Routes: &models.Routes{ssh_routes.DIEGO_SSH: &sshRoute},
+		}
+		before := &models.DesiredLRPSchedulingInfo{
+			DesiredLRPKey: models.NewDesiredLRPKey("some-guid", "cf-apps", "log-guid"),
+			Routes:        models.Routes{ssh_routes.DIEGO_SSH: &sshRoute},
+		}
+
+		segment := journal.OpenSegment(syncStart)
+		Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalDelete, ProcessGuid: "some-guid", Before: before, DesiredLRP: desired})).To(Succeed())
+		Expect(segment.Close()).To(Succeed())
+
+		contents, err := ioutil.ReadFile(segment.Path())
+		Expect(err).NotTo(HaveOccurred())
+		for _, secret := range []string{"registry-password", "postgres://secret", "api-secret", "host-private-key", "authorized-key", "ssh-private-key"} {
+			Expect(string(contents)).NotTo(ContainSubstring(secret))
+		}
+
+		Expect(string(contents)).To(ContainSubstring("fingerprint"))
+
+		info, err := os.Stat(segment.Path() + ".definitions")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		entries, err := bulk.ReadJournalSegment(segment.Path())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries[0].Redacted).To(BeFalse())
+		Expect(entries[0].DesiredLRP.ImagePassword).To(Equal("registry-password"))
+		Expect(entries[0].DesiredLRP.EnvironmentVariables[0].Value).To(Equal("postgres://secret"))
+		Expect(entries[0].DesiredLRP.Action.CodependentAction.Actions[1].RunAction.Args).To(ContainElement("-hostKey=host-private-key"))
+		Expect(string(*entries[0].Before.Routes[ssh_routes.DIEGO_SSH])).NotTo(ContainSubstring("ssh-private-key"))
+
+		// without its definitions file the segment can only be inspected
+		Expect(os.Remove(segment.Path() + ".definitions")).To(Succeed())
+
+		entries, err = bulk.ReadJournalSegment(segment.Path())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries[0].Redacted).To(BeTrue())
+		Expect(entries[0].DesiredLRP.ImageUsername).To(Equal("user"))
+		Expect(entries[0].DesiredLRP.EnvironmentVariables[0].Name).To(Equal("DATABASE_URL"))
+		Expect(entries[0].DesiredLRP.EnvironmentVariables[0].Value).To(Equal("[REDACTED]"))
+
+		Expect(desired.ImagePassword).To(Equal("registry-password"))
+		Expect(desired.EnvironmentVariables[0].Value).To(Equal("postgres://secret"))
+		Expect(string(*before.Routes[ssh_routes.DIEGO_SSH])).To(ContainSubstring("ssh-private-key"))
+	})
+
+	It("appends to an existing segment", func() {
+		segment := journal.OpenSegment(syncStart)
+		Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalDelete, ProcessGuid: "first"})).To(Succeed())
+		Expect(segment.Close()).To(Succeed())
+
+		segment = journal.OpenSegment(syncStart)
+		Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalDelete, ProcessGuid: "second"})).To(Succeed())
+		Expect(segment.Close()).To(Succeed())
+
+		entries, err := bulk.ReadJournalSegment(segment.Path())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].ProcessGuid).To(Equal("first"))
+		Expect(entries[1].ProcessGuid).To(Equal("second"))
+	})
+
+	Context("when the journal directory does not exist", func() {
+		BeforeEach(func() {
+			journal = bulk.NewJournal(filepath.Join(journalDir, "missing"), 0)
+		})
+
+		It("fails to record an entry", func() {
+			segment := journal.OpenSegment(syncStart)
+			Expect(segment.Record(bulk.JournalEntry{Action: bulk.JournalDelete, ProcessGuid: "some-guid"})).NotTo(Succeed())
+			Expect(segment.Entries()).To(Equal(0))
+		})
+	})
+
+	Context("when nothing is recorded", func() {
+		It("does not create the segment", func() {
+			segment := journal.OpenSegment(syncStart)
+			Expect(segment.Close()).To(Succeed())
+
+			_, err := os.Stat(segment.Path())
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("Prune", func() {
+		record := func(syncStart int64) {
+			segment := journal.OpenSegment(time.Unix(0, syncStart))
+			Expect(segment.Record(bulk.JournalEntry{
+				Action:      bulk.JournalDelete,
+				ProcessGuid: "some-guid",
+				DesiredLRP:  &models.DesiredLRP{ProcessGuid: "some-guid"},
+			})).To(Succeed())
+			Expect(segment.Close()).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			journal = bulk.NewJournal(journalDir, 2)
+
+			record(900)
+			record(1000)
+			record(1100)
+
+			err := ioutil.WriteFile(filepath.Join(journalDir, "unrelated.txt"), []byte("keep me"), 0600)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("removes the oldest segments beyond the limit", func() {
+			pruned, err := journal.Prune()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(ConsistOf(filepath.Join(journalDir, "lrp-sync-900.jsonl")))
+
+			paths, err := filepath.Glob(filepath.Join(journalDir, "*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(ConsistOf(
+				filepath.Join(journalDir, "lrp-sync-1000.jsonl"),
+				filepath.Join(journalDir, "lrp-sync-1000.jsonl.definitions"),
+				filepath.Join(journalDir, "lrp-sync-1100.jsonl"),
+				filepath.Join(journalDir, "lrp-sync-1100.jsonl.definitions"),
+				filepath.Join(journalDir, "unrelated.txt"),
+			))
+		})
+
+		Context("when there is no limit", func() {
+			BeforeEach(func() {
+				journal = bulk.NewJournal(journalDir, 0)
+			})
+
+			It("keeps every segment", func() {
+				pruned, err := journal.Prune()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pruned).To(BeEmpty())
+
+				paths, err := filepath.Glob(filepath.Join(journalDir, "lrp-sync-*.jsonl"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(paths).To(HaveLen(3))
+			})
+		})
+	})
+
+	Context("when a segment is truncated", func() {
+		It("fails to read it", func() {
+			path := filepath.Join(journalDir, "truncated.jsonl")
+			err := ioutil.WriteFile(path, []byte(`{"action":"delete","process_guid":"a"}`+"\n"+`{"action":"del`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = bulk.ReadJournalSegment(path)
+			Expect(err).To(MatchError(ContainSubstring("invalid journal entry 2")))
+		})
+	})
+})
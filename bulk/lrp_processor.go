@@ -26,6 +26,12 @@ import (
 const (
 	syncDesiredLRPsDuration = metric.Duration("DesiredLRPSyncDuration")
 	invalidLRPsFound        = metric.Metric("NsyncInvalidDesiredLRPsFound")
+
+	deletionThresholdExceeded = metric.Counter("NsyncDeletionThresholdExceeded")
+	desiredLRPsDeleted        = metric.Counter("NsyncDesiredLRPsDeleted")
+	desiredLRPDeletesFailed   = metric.Counter("NsyncDesiredLRPDeletesFailed")
+	desiredLRPsRecreated      = metric.Counter("NsyncDesiredLRPsRecreated")
+	desiredLRPsReplaced       = metric.Counter("NsyncDesiredLRPsReplaced")
 )
 
 type LRPProcessor struct {
@@ -34,10 +40,18 @@ type LRPProcessor struct {
 	domainTTL             time.Duration
 	bulkBatchSize         uint
 	updateLRPWorkPoolSize int
+	deleteLRPWorkPoolSize int
+	dryRun                bool
+	maxDeletions          int
+	maxDeletionPercentage float64
+	maxRecipeRecreates    int
 	httpClient            *http.Client
 	logger                lager.Logger
 	fetcher               Fetcher
-	builders              map[string]recipebuilder.RecipeBuilder
+	builders              *recipebuilder.Registry
+	syncReports           *SyncReportRecorder
+	journal               *Journal
+	triggers              chan struct{}
 	clock                 clock.Clock
 }
 
@@ -48,9 +62,16 @@ func NewLRPProcessor(
 	domainTTL time.Duration,
 	bulkBatchSize uint,
 	updateLRPWorkPoolSize int,
-	skipCertVerify bool,
+	deleteLRPWorkPoolSize int,
+	dryRun bool,
+	maxDeletions int,
+	maxDeletionPercentage float64,
+	maxRecipeRecreates int,
+	httpClient *http.Client,
 	fetcher Fetcher,
-	builders map[string]recipebuilder.RecipeBuilder,
+	builders *recipebuilder.Registry,
+	syncReports *SyncReportRecorder,
+	journal *Journal,
 	clock clock.Clock,
 ) *LRPProcessor {
 	return &LRPProcessor{
@@ -59,10 +80,18 @@ func NewLRPProcessor(
 		domainTTL:             domainTTL,
 		bulkBatchSize:         bulkBatchSize,
 		updateLRPWorkPoolSize: updateLRPWorkPoolSize,
-		httpClient:            initializeHttpClient(skipCertVerify),
+		deleteLRPWorkPoolSize: deleteLRPWorkPoolSize,
+		dryRun:                dryRun,
+		maxDeletions:          maxDeletions,
+		maxDeletionPercentage: maxDeletionPercentage,
+		maxRecipeRecreates:    maxRecipeRecreates,
+		httpClient:            httpClient,
 		logger:                logger,
 		fetcher:               fetcher,
 		builders:              builders,
+		syncReports:           syncReports,
+		journal:               journal,
+		triggers:              make(chan struct{}, 1),
 		clock:                 clock,
 	}
 }
@@ -84,16 +113,45 @@ func (l *LRPProcessor) Run(signals <-chan os.Signal, ready chan<- struct{}) erro
 		case <-timer.C():
 			stop = l.sync(signals)
 			timer.Reset(l.pollingInterval)
+		case <-l.triggers:
+			l.logger.Info("sync-triggered")
+			stop = l.sync(signals)
+			timer.Reset(l.pollingInterval)
 		}
 	}
 }
 
+// Trigger requests an immediate sync. The sync runs on the same loop as the
+// polling syncs, so it never overlaps one in flight; it returns false if a
+// triggered sync is already pending.
+func (l *LRPProcessor) Trigger() bool {
+	select {
+	case l.triggers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
 func (l *LRPProcessor) sync(signals <-chan os.Signal) bool {
 	start := l.clock.Now()
 	invalidsFound := int32(0)
-	logger := l.logger.Session("sync-lrps")
+	logger := l.logger.Session("sync-lrps", lager.Data{"dry-run": l.dryRun})
 	logger.Info("starting")
 
+	var report *dryRunReport
+	if l.dryRun {
+		report = newDryRunReport()
+	}
+
+	summary := newSyncSummary(LRPSyncKind, start)
+	summary.DryRun = l.dryRun
+
+	defer func() {
+		summary.finish(l.clock.Now(), int(atomic.LoadInt32(&invalidsFound)))
+		l.syncReports.Record(summary)
+	}()
+
 	defer func() {
 		duration := l.clock.Now().Sub(start)
 		err := syncDesiredLRPsDuration.Send(duration)
@@ -110,11 +168,27 @@ func (l *LRPProcessor) sync(signals <-chan os.Signal) bool {
 
 	existing, err := l.getSchedulingInfos(logger)
 	if err != nil {
+		summary.recordFailure(err)
 		return false
 	}
 
+	var segment *JournalSegment
+	if l.journal != nil && !l.dryRun {
+		segment = l.journal.OpenSegment(start)
+		defer func() {
+			err := segment.Close()
+			if err != nil {
+				logger.Error("failed-to-close-journal-segment", err, lager.Data{"path": segment.Path()})
+			}
+			if entries := segment.Entries(); entries > 0 {
+				logger.Info("journaled", lager.Data{"path": segment.Path(), "num-entries": entries})
+				l.pruneJournal(logger)
+			}
+		}()
+	}
+
 	existingSchedulingInfoMap := organizeSchedulingInfosByProcessGuid(existing)
-	appDiffer := NewAppDiffer(existingSchedulingInfoMap)
+	appDiffer := NewAppDiffer(existingSchedulingInfoMap, l.recipeVersions())
 
 	cancelCh := make(chan struct{})
 
@@ -128,42 +202,63 @@ func (l *LRPProcessor) sync(signals <-chan os.Signal) bool {
 	diffErrorCh := appDiffer.Diff(
 		logger,
 		cancelCh,
-		fingerprintCh,
+		recordFingerprints(cancelCh, fingerprintCh, summary.recordFingerprints),
 	)
 
 	missingAppCh, missingAppsErrorCh := l.fetcher.FetchDesiredApps(
 		logger.Session("fetch-missing-desired-lrps-from-cc"),
 		cancelCh,
 		l.httpClient,
-		appDiffer.Missing(),
+		recordFingerprints(cancelCh, appDiffer.Missing(), summary.recordMissing),
 	)
 
-	createErrorCh := l.createMissingDesiredLRPs(logger, cancelCh, missingAppCh, &invalidsFound)
+	createErrorCh := l.createMissingDesiredLRPs(logger, cancelCh, missingAppCh, &invalidsFound, report, segment)
 
 	staleAppCh, staleAppErrorCh := l.fetcher.FetchDesiredApps(
 		logger.Session("fetch-stale-desired-lrps-from-cc"),
 		cancelCh,
 		l.httpClient,
-		appDiffer.Stale(),
+		recordFingerprints(cancelCh, appDiffer.Stale(), summary.recordStale),
 	)
 
-	updateErrorCh := l.updateStaleDesiredLRPs(logger, cancelCh, staleAppCh, existingSchedulingInfoMap, &invalidsFound)
+	recreates := newRecreateBudget(l.maxRecipeRecreates)
+
+	updateErrorCh := l.updateStaleDesiredLRPs(logger, cancelCh, staleAppCh, existingSchedulingInfoMap, recreates, &invalidsFound, report, segment)
 
 	bumpFreshness := true
 	success := true
 
 	fingerprintErrorCh, fingerprintErrorCount := countErrors(fingerprintErrorCh)
 
-	// closes errors when all error channels have been closed.
-	// below, we rely on this behavior to break the process_loop.
-	errors := mergeErrors(
+	errorChannels := []<-chan error{
 		fingerprintErrorCh,
 		diffErrorCh,
 		missingAppsErrorCh,
 		staleAppErrorCh,
 		createErrorCh,
 		updateErrorCh,
-	)
+	}
+
+	if l.maxRecipeRecreates > 0 {
+		driftedAppCh, driftedAppErrorCh := l.fetcher.FetchDesiredApps(
+			logger.Session("fetch-drifted-desired-lrps-from-cc"),
+			cancelCh,
+			l.httpClient,
+			limitFingerprints(
+				cancelCh,
+				recordFingerprints(cancelCh, appDiffer.Drifted(), summary.recordDrifted),
+				l.maxRecipeRecreates,
+			),
+		)
+
+		recreateErrorCh := l.recreateDriftedDesiredLRPs(logger, cancelCh, driftedAppCh, existingSchedulingInfoMap, recreates, &invalidsFound, report, segment)
+
+		errorChannels = append(errorChannels, driftedAppErrorCh, recreateErrorCh)
+	}
+
+	// closes errors when all error channels have been closed.
+	// below, we rely on this behavior to break the process_loop.
+	errors := mergeErrors(errorChannels...)
 
 	logger.Info("processing-updates-and-creates")
 process_loop:
@@ -172,6 +267,7 @@ process_loop:
 		case err, open := <-errors:
 			if err != nil {
 				logger.Error("not-bumping-freshness-because-of", err)
+				summary.recordFailure(err)
 				bumpFreshness = false
 			}
 			if !open {
@@ -192,7 +288,27 @@ process_loop:
 
 	if success {
 		deleteList := <-appDiffer.Deleted()
-		l.deleteExcess(logger, cancelCh, deleteList)
+		summary.recordDeleted(deleteList)
+
+		if l.exceedsDeletionThreshold(logger, len(deleteList), len(existing)) {
+			summary.markDeletionsRefused()
+			success = false
+		} else if l.dryRun {
+			report.recordDeletes(deleteList)
+		} else {
+			select {
+			case <-l.deleteExcess(logger, cancelCh, deleteList, existingSchedulingInfoMap, summary, segment):
+			case sig := <-signals:
+				logger.Info("exiting", lager.Data{"received-signal": sig})
+				close(cancelCh)
+				return true
+			}
+		}
+	}
+
+	if l.dryRun {
+		report.emit(logger)
+		return false
 	}
 
 	if bumpFreshness && success {
@@ -201,6 +317,9 @@ process_loop:
 		err = l.bbsClient.UpsertDomain(logger, cc_messages.AppLRPDomain, l.domainTTL)
 		if err != nil {
 			logger.Error("failed-to-upsert-domain", err)
+			summary.recordFailure(err)
+		} else {
+			summary.markFreshnessBumped()
 		}
 	}
 
@@ -210,8 +329,10 @@ process_loop:
 func (l *LRPProcessor) createMissingDesiredLRPs(
 	logger lager.Logger,
 	cancel <-chan struct{},
-	missing <-chan []cc_messages.DesireAppRequestFromCC,
+	missing <-chan []recipebuilder.DesireAppRequest,
 	invalidCount *int32,
+	report *dryRunReport,
+	segment *JournalSegment,
 ) <-chan error {
 	logger = logger.Session("create-missing-desired-lrps")
 
@@ -221,7 +342,7 @@ func (l *LRPProcessor) createMissingDesiredLRPs(
 		defer close(errc)
 
 		for {
-			var desireAppRequests []cc_messages.DesireAppRequestFromCC
+			var desireAppRequests []recipebuilder.DesireAppRequest
 
 			select {
 			case <-cancel:
@@ -239,12 +360,14 @@ func (l *LRPProcessor) createMissingDesiredLRPs(
 
 			for i, desireAppRequest := range desireAppRequests {
 				desireAppRequest := desireAppRequest
-				var builder recipebuilder.RecipeBuilder = l.builders["buildpack"]
-				if desireAppRequest.DockerImageUrl != "" {
-					builder = l.builders["docker"]
-				}
-
 				works[i] = func() {
+					builder, err := l.builders.BuilderForApp(&desireAppRequest.DesireAppRequestFromCC)
+					if err != nil {
+						logger.Error("failed-to-find-recipe-builder", err, lager.Data{"process-guid": desireAppRequest.ProcessGuid})
+						errc <- err
+						return
+					}
+
 					logger.Debug("building-create-desired-lrp-request", desireAppRequestDebugData(&desireAppRequest))
 					desired, err := builder.Build(&desireAppRequest)
 					if err != nil {
@@ -254,6 +377,12 @@ func (l *LRPProcessor) createMissingDesiredLRPs(
 					}
 					logger.Debug("succeeded-building-create-desired-lrp-request", desireAppRequestDebugData(&desireAppRequest))
 
+					if l.dryRun {
+						logger.Info("dry-run-skipping-create-desired-lrp", createDesiredReqDebugData(desired))
+						report.recordCreate(desired.ProcessGuid)
+						return
+					}
+
 					logger.Debug("creating-desired-lrp", createDesiredReqDebugData(desired))
 					err = l.bbsClient.DesireLRP(logger, desired)
 					if err != nil {
@@ -266,6 +395,14 @@ func (l *LRPProcessor) createMissingDesiredLRPs(
 						return
 					}
 					logger.Debug("succeeded-creating-desired-lrp", createDesiredReqDebugData(desired))
+
+					schedulingInfo := desired.DesiredLRPSchedulingInfo()
+					l.recordDecision(logger, segment, JournalEntry{
+						Action:      JournalCreate,
+						ProcessGuid: desired.ProcessGuid,
+						After:       &schedulingInfo,
+						DesiredLRP:  desired,
+					})
 				}
 			}
 
@@ -287,9 +424,12 @@ func (l *LRPProcessor) createMissingDesiredLRPs(
 func (l *LRPProcessor) updateStaleDesiredLRPs(
 	logger lager.Logger,
 	cancel <-chan struct{},
-	stale <-chan []cc_messages.DesireAppRequestFromCC,
+	stale <-chan []recipebuilder.DesireAppRequest,
 	existingSchedulingInfoMap map[string]*models.DesiredLRPSchedulingInfo,
+	recreates *recreateBudget,
 	invalidCount *int32,
+	report *dryRunReport,
+	segment *JournalSegment,
 ) <-chan error {
 	logger = logger.Session("update-stale-desired-lrps")
 
@@ -299,7 +439,7 @@ func (l *LRPProcessor) updateStaleDesiredLRPs(
 		defer close(errc)
 
 		for {
-			var staleAppRequests []cc_messages.DesireAppRequestFromCC
+			var staleAppRequests []recipebuilder.DesireAppRequest
 
 			select {
 			case <-cancel:
@@ -317,21 +457,53 @@ func (l *LRPProcessor) updateStaleDesiredLRPs(
 
 			for i, desireAppRequest := range staleAppRequests {
 				desireAppRequest := desireAppRequest
-				var builder recipebuilder.RecipeBuilder = l.builders["buildpack"]
-				if desireAppRequest.DockerImageUrl != "" {
-					builder = l.builders["docker"]
-				}
-
 				works[i] = func() {
+					builder, err := l.builders.BuilderForApp(&desireAppRequest.DesireAppRequestFromCC)
+					if err != nil {
+						logger.Error("failed-to-find-recipe-builder", err, lager.Data{"process-guid": desireAppRequest.ProcessGuid})
+						errc <- err
+						return
+					}
+
 					processGuid := desireAppRequest.ProcessGuid
 					existingSchedulingInfo := existingSchedulingInfoMap[desireAppRequest.ProcessGuid]
+					desireAppRequest.PinnedImage, _ = recipebuilder.PinnedImageFromRoutes(existingSchedulingInfo.Routes)
+
+					outcome := noReplacement
+					if recreates != nil {
+						outcome, err = l.replaceIfImmutableFieldsChanged(logger, builder, &desireAppRequest, existingSchedulingInfo, recreates, report, segment)
+						if err != nil && outcome != replacementDeferred {
+							if models.ConvertError(err).Type == models.Error_InvalidRequest {
+								atomic.AddInt32(invalidCount, int32(1))
+							} else {
+								errc <- err
+							}
+							return
+						}
+						if outcome == replaced {
+							return
+						}
+
+						// the app could not be rebuilt: apply what can be
+						// updated, then fail the sync so that the divergence
+						// does not go unnoticed.
+						if err != nil {
+							rebuildErr := err
+							defer func() { errc <- rebuildErr }()
+						}
+					}
 
 					updateReq := &models.DesiredLRPUpdate{}
 					instances := int32(desireAppRequest.NumInstances)
 					updateReq.Instances = &instances
-					updateReq.Annotation = &desireAppRequest.ETag
 
-					exposedPorts, err := builder.ExtractExposedPorts(&desireAppRequest)
+					// a deferred replacement leaves the old etag in place, so the
+					// app stays stale and is looked at again on the next sync.
+					if outcome != replacementDeferred {
+						updateReq.Annotation = &desireAppRequest.ETag
+					}
+
+					exposedPorts, err := builder.ExtractExposedPorts(&desireAppRequest.DesireAppRequestFromCC)
 					if err != nil {
 						logger.Error("failed-updating-stale-lrp", err, lager.Data{
 							"process-guid":       processGuid,
@@ -356,6 +528,12 @@ func (l *LRPProcessor) updateStaleDesiredLRPs(
 						}
 					}
 
+					if l.dryRun {
+						logger.Info("dry-run-skipping-update-stale-lrp", updateDesiredRequestDebugData(processGuid, updateReq))
+						report.recordUpdate(processGuid)
+						return
+					}
+
 					logger.Debug("updating-stale-lrp", updateDesiredRequestDebugData(processGuid, updateReq))
 					err = l.bbsClient.UpdateDesiredLRP(logger, processGuid, updateReq)
 					if err != nil {
@@ -371,6 +549,13 @@ func (l *LRPProcessor) updateStaleDesiredLRPs(
 						return
 					}
 					logger.Debug("succeeded-updating-stale-lrp", updateDesiredRequestDebugData(processGuid, updateReq))
+
+					l.recordDecision(logger, segment, JournalEntry{
+						Action:      JournalUpdate,
+						ProcessGuid: processGuid,
+						Before:      existingSchedulingInfo,
+						After:       updatedSchedulingInfo(existingSchedulingInfo, updateReq),
+					})
 				}
 			}
 
@@ -389,6 +574,262 @@ func (l *LRPProcessor) updateStaleDesiredLRPs(
 	return errc
 }
 
+// recreateDriftedDesiredLRPs replaces LRPs that were built by an older recipe.
+// Most of a DesiredLRP cannot be updated in place, so the LRP is removed and
+// desired again from the current recipe. LRPs beyond the sync's recreate budget
+// are left for a later sync.
+func (l *LRPProcessor) recreateDriftedDesiredLRPs(
+	logger lager.Logger,
+	cancel <-chan struct{},
+	drifted <-chan []recipebuilder.DesireAppRequest,
+	existingSchedulingInfoMap map[string]*models.DesiredLRPSchedulingInfo,
+	recreates *recreateBudget,
+	invalidCount *int32,
+	report *dryRunReport,
+	segment *JournalSegment,
+) <-chan error {
+	logger = logger.Session("recreate-drifted-desired-lrps")
+
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+
+		for {
+			var driftedAppRequests []recipebuilder.DesireAppRequest
+
+			select {
+			case <-cancel:
+				return
+
+			case selected, open := <-drifted:
+				if !open {
+					return
+				}
+
+				driftedAppRequests = selected
+			}
+
+			var recreatedCount uint64
+			works := make([]func(), len(driftedAppRequests))
+
+			for i, desireAppRequest := range driftedAppRequests {
+				desireAppRequest := desireAppRequest
+				works[i] = func() {
+					builder, err := l.builders.BuilderForApp(&desireAppRequest.DesireAppRequestFromCC)
+					if err != nil {
+						logger.Error("failed-to-find-recipe-builder", err, lager.Data{"process-guid": desireAppRequest.ProcessGuid})
+						errc <- err
+						return
+					}
+
+					processGuid := desireAppRequest.ProcessGuid
+					desireAppRequest.PinnedImage, _ = recipebuilder.PinnedImageFromRoutes(existingSchedulingInfoMap[processGuid].Routes)
+
+					if !recreates.take() {
+						logger.Info("deferring-recreate-desired-lrp", lager.Data{"process-guid": processGuid})
+						return
+					}
+
+					desired, err := builder.Build(&desireAppRequest)
+					if err != nil {
+						logger.Error("failed-building-recreate-desired-lrp-request", err, lager.Data{"process-guid": processGuid})
+						errc <- err
+						return
+					}
+
+					if l.dryRun {
+						logger.Info("dry-run-skipping-recreate-desired-lrp", createDesiredReqDebugData(desired))
+						report.recordRecreate(processGuid)
+						return
+					}
+
+					existing, err := l.bbsClient.DesiredLRPByProcessGuid(logger, processGuid)
+					if err != nil {
+						logger.Error("failed-to-snapshot-desired-lrp", err, lager.Data{"process-guid": processGuid})
+						errc <- err
+						return
+					}
+
+					preserveRoutes(desired, existing.Routes)
+
+					err = l.replaceDesiredLRP(logger, existingSchedulingInfoMap[processGuid], existing, desired, segment)
+					if err != nil {
+						if models.ConvertError(err).Type == models.Error_InvalidRequest {
+							atomic.AddInt32(invalidCount, int32(1))
+						} else {
+							errc <- err
+						}
+						return
+					}
+
+					atomic.AddUint64(&recreatedCount, 1)
+				}
+			}
+
+			throttler, err := workpool.NewThrottler(l.updateLRPWorkPoolSize, works)
+			if err != nil {
+				errc <- err
+				return
+			}
+
+			logger.Info("processing-batch", lager.Data{"size": len(driftedAppRequests)})
+			throttler.Work()
+			logger.Info("done-processing-batch", lager.Data{"size": len(driftedAppRequests), "num-recreated": recreatedCount})
+
+			err = desiredLRPsRecreated.Add(recreatedCount)
+			if err != nil {
+				logger.Error("failed-to-send-desired-lrps-recreated-metric", err)
+			}
+		}
+	}()
+
+	return errc
+}
+
+// replaceIfImmutableFieldsChanged rebuilds a stale app and replaces its LRP when
+// the change touches fields that DesiredLRPUpdate cannot carry, such as memory,
+// disk, environment or the droplet. Replacements draw from the sync's recreate
+// budget; once it is spent, or when the app cannot be rebuilt, the replacement
+// is deferred and the caller still applies the fields that can be updated. A
+// failed rebuild is returned along with the deferral so that the sync fails.
+func (l *LRPProcessor) replaceIfImmutableFieldsChanged(
+	logger lager.Logger,
+	builder recipebuilder.RecipeBuilder,
+	desireAppRequest *recipebuilder.DesireAppRequest,
+	existingSchedulingInfo *models.DesiredLRPSchedulingInfo,
+	recreates *recreateBudget,
+	report *dryRunReport,
+	segment *JournalSegment,
+) (replacement, error) {
+	processGuid := desireAppRequest.ProcessGuid
+
+	desired, err := builder.Build(desireAppRequest)
+	if err != nil {
+		logger.Error("failed-building-stale-desired-lrp", err, lager.Data{"process-guid": processGuid})
+		return replacementDeferred, err
+	}
+
+	existing, err := l.bbsClient.DesiredLRPByProcessGuid(logger, processGuid)
+	if err != nil {
+		logger.Error("failed-fetching-stale-desired-lrp", err, lager.Data{"process-guid": processGuid})
+		return noReplacement, err
+	}
+
+	changes := immutableFieldChanges(existing, desired)
+	if len(changes) == 0 {
+		return noReplacement, nil
+	}
+
+	if !recreates.take() {
+		logger.Info("deferring-replace-desired-lrp", lager.Data{"process-guid": processGuid, "changed-fields": changes})
+		return replacementDeferred, nil
+	}
+
+	logger.Info("replacing-desired-lrp", lager.Data{"process-guid": processGuid, "changed-fields": changes})
+
+	if l.dryRun {
+		logger.Info("dry-run-skipping-replace-desired-lrp", createDesiredReqDebugData(desired))
+		report.recordRecreate(processGuid)
+		return replaced, nil
+	}
+
+	preserveRoutes(desired, existing.Routes)
+
+	err = l.replaceDesiredLRP(logger, existingSchedulingInfo, existing, desired, segment)
+	if err != nil {
+		return noReplacement, err
+	}
+
+	err = desiredLRPsReplaced.Increment()
+	if err != nil {
+		logger.Error("failed-to-send-desired-lrps-replaced-metric", err)
+	}
+
+	return replaced, nil
+}
+
+// replaceDesiredLRP removes an LRP and desires it again from its rebuilt
+// definition. The process guid is owned by CC, so the LRP cannot be swapped for
+// one under a new guid; its instances restart once the new definition is
+// desired. If the new definition is refused, the existing one is desired again
+// so that the app is not left without an LRP.
+func (l *LRPProcessor) replaceDesiredLRP(
+	logger lager.Logger,
+	existingSchedulingInfo *models.DesiredLRPSchedulingInfo,
+	existing *models.DesiredLRP,
+	desired *models.DesiredLRP,
+	segment *JournalSegment,
+) error {
+	processGuid := desired.ProcessGuid
+
+	logger.Debug("removing-desired-lrp", lager.Data{"process-guid": processGuid})
+	err := l.bbsClient.RemoveDesiredLRP(logger, processGuid)
+	if err != nil {
+		logger.Error("failed-removing-desired-lrp", err, lager.Data{"process-guid": processGuid})
+		return err
+	}
+
+	l.recordDecision(logger, segment, JournalEntry{
+		Action:      JournalDelete,
+		ProcessGuid: processGuid,
+		Before:      existingSchedulingInfo,
+		DesiredLRP:  existing,
+	})
+
+	logger.Debug("creating-desired-lrp", createDesiredReqDebugData(desired))
+	err = l.bbsClient.DesireLRP(logger, desired)
+	if err != nil {
+		logger.Error("failed-recreating-desired-lrp", err, lager.Data{"process-guid": processGuid})
+		l.restoreDesiredLRP(logger, existing, segment)
+		return err
+	}
+	logger.Debug("succeeded-recreating-desired-lrp", createDesiredReqDebugData(desired))
+
+	schedulingInfo := desired.DesiredLRPSchedulingInfo()
+	l.recordDecision(logger, segment, JournalEntry{
+		Action:      JournalCreate,
+		ProcessGuid: processGuid,
+		After:       &schedulingInfo,
+		DesiredLRP:  desired,
+	})
+
+	return nil
+}
+
+func (l *LRPProcessor) restoreDesiredLRP(logger lager.Logger, existing *models.DesiredLRP, segment *JournalSegment) {
+	logger.Info("restoring-desired-lrp", lager.Data{"process-guid": existing.ProcessGuid})
+	err := l.bbsClient.DesireLRP(logger, existing)
+	if err != nil {
+		logger.Error("failed-restoring-desired-lrp", err, lager.Data{"process-guid": existing.ProcessGuid})
+		return
+	}
+
+	schedulingInfo := existing.DesiredLRPSchedulingInfo()
+	l.recordDecision(logger, segment, JournalEntry{
+		Action:      JournalCreate,
+		ProcessGuid: existing.ProcessGuid,
+		After:       &schedulingInfo,
+		DesiredLRP:  existing,
+	})
+}
+
+// recipeVersions returns the versions of the current builders, or nothing when
+// recreating drifted LRPs is disabled.
+func (l *LRPProcessor) recipeVersions() []string {
+	if l.maxRecipeRecreates <= 0 {
+		return nil
+	}
+
+	versions := []string{}
+	for _, builder := range l.builders.Builders() {
+		for _, version := range builder.RecipeVersions() {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
 func (l *LRPProcessor) getSchedulingInfos(logger lager.Logger) ([]*models.DesiredLRPSchedulingInfo, error) {
 	logger.Info("getting-desired-lrps-from-bbs")
 	existing, err := l.bbsClient.DesiredLRPSchedulingInfos(logger, models.DesiredLRPFilter{Domain: cc_messages.AppLRPDomain})
@@ -401,20 +842,155 @@ func (l *LRPProcessor) getSchedulingInfos(logger lager.Logger) ([]*models.Desire
 	return existing, nil
 }
 
-func (l *LRPProcessor) deleteExcess(logger lager.Logger, cancel <-chan struct{}, excess []string) {
+func (l *LRPProcessor) deleteExcess(
+	logger lager.Logger,
+	cancel <-chan struct{},
+	excess []string,
+	existingSchedulingInfoMap map[string]*models.DesiredLRPSchedulingInfo,
+	summary *SyncSummary,
+	segment *JournalSegment,
+) <-chan struct{} {
 	logger = logger.Session("delete-excess")
 
-	logger.Info("processing-batch", lager.Data{"num-to-delete": len(excess), "guids-to-delete": excess})
-	deletedGuids := make([]string, 0, len(excess))
-	for _, deleteGuid := range excess {
-		err := l.bbsClient.RemoveDesiredLRP(logger, deleteGuid)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		var failedCount int32
+		deletedGuids := make([]string, 0, len(excess))
+		deletedGuidsLock := sync.Mutex{}
+
+		works := make([]func(), len(excess))
+
+		for i, deleteGuid := range excess {
+			deleteGuid := deleteGuid
+
+			works[i] = func() {
+				select {
+				case <-cancel:
+					return
+				default:
+				}
+
+				// a deletion can only be reverted from the journal if the
+				// full definition was captured before it went away.
+				var removed *models.DesiredLRP
+				if segment != nil {
+					var err error
+					removed, err = l.bbsClient.DesiredLRPByProcessGuid(logger, deleteGuid)
+					if err != nil {
+						logger.Error("failed-to-snapshot-desired-lrp", err, lager.Data{"delete-request": deleteGuid})
+						summary.recordFailure(err)
+						atomic.AddInt32(&failedCount, 1)
+						return
+					}
+				}
+
+				err := l.bbsClient.RemoveDesiredLRP(logger, deleteGuid)
+				if err != nil {
+					logger.Error("failed-processing-batch", err, lager.Data{"delete-request": deleteGuid})
+					summary.recordFailure(err)
+					atomic.AddInt32(&failedCount, 1)
+					return
+				}
+
+				l.recordDecision(logger, segment, JournalEntry{
+					Action:      JournalDelete,
+					ProcessGuid: deleteGuid,
+					Before:      existingSchedulingInfoMap[deleteGuid],
+					DesiredLRP:  removed,
+				})
+
+				deletedGuidsLock.Lock()
+				deletedGuids = append(deletedGuids, deleteGuid)
+				deletedGuidsLock.Unlock()
+			}
+		}
+
+		throttler, err := workpool.NewThrottler(l.deleteLRPWorkPoolSize, works)
 		if err != nil {
-			logger.Error("failed-processing-batch", err, lager.Data{"delete-request": deleteGuid})
-		} else {
-			deletedGuids = append(deletedGuids, deleteGuid)
+			logger.Error("failed-constructing-throttler", err, lager.Data{"max-workers": l.deleteLRPWorkPoolSize})
+			return
+		}
+
+		logger.Info("processing-batch", lager.Data{"num-to-delete": len(excess), "guids-to-delete": excess})
+		throttler.Work()
+
+		deletedGuidsLock.Lock()
+		defer deletedGuidsLock.Unlock()
+
+		err = desiredLRPsDeleted.Add(uint64(len(deletedGuids)))
+		if err != nil {
+			logger.Error("failed-to-send-desired-lrps-deleted-metric", err)
 		}
+
+		err = desiredLRPDeletesFailed.Add(uint64(failedCount))
+		if err != nil {
+			logger.Error("failed-to-send-desired-lrp-deletes-failed-metric", err)
+		}
+
+		logger.Info("succeeded-processing-batch", lager.Data{
+			"num-deleted":   len(deletedGuids),
+			"num-failed":    failedCount,
+			"deleted-guids": deletedGuids,
+		})
+	}()
+
+	return done
+}
+
+func (l *LRPProcessor) pruneJournal(logger lager.Logger) {
+	pruned, err := l.journal.Prune()
+	if err != nil {
+		logger.Error("failed-to-prune-journal", err)
+	}
+	if len(pruned) > 0 {
+		logger.Info("pruned-journal", lager.Data{"removed-segments": pruned})
 	}
-	logger.Info("succeeded-processing-batch", lager.Data{"num-deleted": len(deletedGuids), "deleted-guids": deletedGuids})
+}
+
+func (l *LRPProcessor) recordDecision(logger lager.Logger, segment *JournalSegment, entry JournalEntry) {
+	if segment == nil {
+		return
+	}
+
+	entry.Timestamp = l.clock.Now().UnixNano()
+	err := segment.Record(entry)
+	if err != nil {
+		logger.Error("failed-to-record-journal-entry", err, lager.Data{"process-guid": entry.ProcessGuid, "action": entry.Action})
+	}
+}
+
+func (l *LRPProcessor) exceedsDeletionThreshold(logger lager.Logger, numToDelete, numExisting int) bool {
+	if numToDelete == 0 {
+		return false
+	}
+
+	exceeded := l.maxDeletions > 0 && numToDelete > l.maxDeletions
+
+	if l.maxDeletionPercentage > 0 && numExisting > 0 {
+		percentage := float64(numToDelete) * 100 / float64(numExisting)
+		exceeded = exceeded || percentage > l.maxDeletionPercentage
+	}
+
+	if !exceeded {
+		return false
+	}
+
+	logger.Error("refusing-to-delete-excess-desired-lrps", nil, lager.Data{
+		"num-to-delete":           numToDelete,
+		"num-existing":            numExisting,
+		"max-deletions":           l.maxDeletions,
+		"max-deletion-percentage": l.maxDeletionPercentage,
+	})
+
+	err := deletionThresholdExceeded.Increment()
+	if err != nil {
+		logger.Error("failed-to-send-deletion-threshold-exceeded-metric", err)
+	}
+
+	return true
 }
 
 func countErrors(source <-chan error) (<-chan error, <-chan int) {
@@ -445,6 +1021,49 @@ func countErrors(source <-chan error) (<-chan error, <-chan int) {
 	return dest, count
 }
 
+// limitFingerprints passes on at most limit fingerprints and discards the rest,
+// so that the source never blocks.
+func limitFingerprints(
+	cancel <-chan struct{},
+	source <-chan []cc_messages.CCDesiredAppFingerprint,
+	limit int,
+) <-chan []cc_messages.CCDesiredAppFingerprint {
+	dest := make(chan []cc_messages.CCDesiredAppFingerprint)
+
+	go func() {
+		defer close(dest)
+
+		remaining := limit
+		for {
+			select {
+			case <-cancel:
+				return
+			case batch, open := <-source:
+				if !open {
+					return
+				}
+
+				if remaining <= 0 {
+					continue
+				}
+
+				if len(batch) > remaining {
+					batch = batch[:remaining]
+				}
+				remaining -= len(batch)
+
+				select {
+				case dest <- batch:
+				case <-cancel:
+					return
+				}
+			}
+		}
+	}()
+
+	return dest
+}
+
 func mergeErrors(channels ...<-chan error) <-chan error {
 	out := make(chan error)
 	wg := sync.WaitGroup{}
@@ -500,7 +1119,7 @@ func createDesiredReqDebugData(createDesiredRequest *models.DesiredLRP) lager.Da
 	}
 }
 
-func desireAppRequestDebugData(desireAppRequest *cc_messages.DesireAppRequestFromCC) lager.Data {
+func desireAppRequestDebugData(desireAppRequest *recipebuilder.DesireAppRequest) lager.Data {
 	return lager.Data{
 		"process-guid": desireAppRequest.ProcessGuid,
 		"log-guid":     desireAppRequest.LogGuid,
@@ -514,7 +1133,16 @@ func desireAppRequestDebugData(desireAppRequest *cc_messages.DesireAppRequestFro
 	}
 }
 
-func initializeHttpClient(skipCertVerify bool) *http.Client {
+func NewCCHTTPClient(skipCertVerify bool, authenticator Authenticator) *http.Client {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipCertVerify,
+		MinVersion:         tls.VersionTLS10,
+	}
+
+	if provider, ok := authenticator.(clientCertificateProvider); ok {
+		tlsConfig.Certificates = []tls.Certificate{provider.ClientCertificate()}
+	}
+
 	httpClient := cfhttp.NewClient()
 	httpClient.Transport = &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -523,10 +1151,7 @@ func initializeHttpClient(skipCertVerify bool) *http.Client {
 			KeepAlive: 30 * time.Second,
 		}).Dial,
 		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: skipCertVerify,
-			MinVersion:         tls.VersionTLS10,
-		},
+		TLSClientConfig:     tlsConfig,
 	}
 	return httpClient
 }
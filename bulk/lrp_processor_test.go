@@ -3,7 +3,10 @@ package bulk_test
 import (
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -45,6 +48,14 @@ var _ = Describe("LRPProcessor", func() {
 		clock        *fakeclock.FakeClock
 
 		pollingInterval time.Duration
+		dryRun          bool
+
+		maxDeletions          int
+		maxDeletionPercentage float64
+		maxRecipeRecreates    int
+
+		syncReports *bulk.SyncReportRecorder
+		journal     *bulk.Journal
 
 		logger *lagertest.TestLogger
 	)
@@ -55,6 +66,12 @@ var _ = Describe("LRPProcessor", func() {
 
 		syncDuration = 900900
 		pollingInterval = 500 * time.Millisecond
+		dryRun = false
+		syncReports = bulk.NewSyncReportRecorder(5)
+		journal = nil
+		maxDeletions = 0
+		maxDeletionPercentage = 0
+		maxRecipeRecreates = 0
 		clock = fakeclock.NewFakeClock(time.Now())
 
 		fingerprintsToFetch = []cc_messages.CCDesiredAppFingerprint{
@@ -121,20 +138,22 @@ var _ = Describe("LRPProcessor", func() {
 			cancel <-chan struct{},
 			httpClient *http.Client,
 			fingerprints <-chan []cc_messages.CCDesiredAppFingerprint,
-		) (<-chan []cc_messages.DesireAppRequestFromCC, <-chan error) {
+		) (<-chan []recipebuilder.DesireAppRequest, <-chan error) {
 			batch := <-fingerprints
 
-			results := []cc_messages.DesireAppRequestFromCC{}
+			results := []recipebuilder.DesireAppRequest{}
 			for _, fingerprint := range batch {
 				routeInfo, err := cc_messages.CCHTTPRoutes{
 					{Hostname: "host-" + fingerprint.ProcessGuid},
 				}.CCRouteInfo()
 				Expect(err).NotTo(HaveOccurred())
 
-				lrp := cc_messages.DesireAppRequestFromCC{
-					ProcessGuid: fingerprint.ProcessGuid,
-					ETag:        fingerprint.ETag,
-					RoutingInfo: routeInfo,
+				lrp := recipebuilder.DesireAppRequest{
+					DesireAppRequestFromCC: cc_messages.DesireAppRequestFromCC{
+						ProcessGuid: fingerprint.ProcessGuid,
+						ETag:        fingerprint.ETag,
+						RoutingInfo: routeInfo,
+					},
 				}
 				if strings.HasPrefix(fingerprint.ProcessGuid, "docker") {
 					lrp.DockerImageUrl = "some-image"
@@ -142,7 +161,7 @@ var _ = Describe("LRPProcessor", func() {
 				results = append(results, lrp)
 			}
 
-			desired := make(chan []cc_messages.DesireAppRequestFromCC, 1)
+			desired := make(chan []recipebuilder.DesireAppRequest, 1)
 			desired <- results
 			close(desired)
 
@@ -153,7 +172,7 @@ var _ = Describe("LRPProcessor", func() {
 		}
 
 		buildpackRecipeBuilder = new(fakes.FakeRecipeBuilder)
-		buildpackRecipeBuilder.BuildStub = func(ccRequest *cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error) {
+		buildpackRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
 			createRequest := models.DesiredLRP{
 				ProcessGuid: ccRequest.ProcessGuid,
 				Annotation:  ccRequest.ETag,
@@ -165,7 +184,7 @@ var _ = Describe("LRPProcessor", func() {
 		}
 
 		dockerRecipeBuilder = new(fakes.FakeRecipeBuilder)
-		dockerRecipeBuilder.BuildStub = func(ccRequest *cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error) {
+		dockerRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
 			createRequest := models.DesiredLRP{
 				ProcessGuid: ccRequest.ProcessGuid,
 				Annotation:  ccRequest.ETag,
@@ -175,6 +194,9 @@ var _ = Describe("LRPProcessor", func() {
 
 		bbsClient = new(fake_bbs.FakeClient)
 		bbsClient.DesiredLRPSchedulingInfosReturns(existingSchedulingInfos, nil)
+		bbsClient.DesiredLRPByProcessGuidStub = func(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
+			return &models.DesiredLRP{ProcessGuid: processGuid}, nil
+		}
 
 		bbsClient.UpsertDomainStub = func(lager.Logger, string, time.Duration) error {
 			clock.Increment(syncDuration)
@@ -182,7 +204,9 @@ var _ = Describe("LRPProcessor", func() {
 		}
 
 		logger = lagertest.NewTestLogger("test")
+	})
 
+	JustBeforeEach(func() {
 		processor = bulk.NewLRPProcessor(
 			logger,
 			bbsClient,
@@ -190,17 +214,19 @@ var _ = Describe("LRPProcessor", func() {
 			time.Second,
 			10,
 			50,
-			false,
+			50,
+			dryRun,
+			maxDeletions,
+			maxDeletionPercentage,
+			maxRecipeRecreates,
+			&http.Client{},
 			fetcher,
-			map[string]recipebuilder.RecipeBuilder{
-				"buildpack": buildpackRecipeBuilder,
-				"docker":    dockerRecipeBuilder,
-			},
+			recipebuilder.NewDefaultRegistry(buildpackRecipeBuilder, dockerRecipeBuilder),
+			syncReports,
+			journal,
 			clock,
 		)
-	})
 
-	JustBeforeEach(func() {
 		process = ifrit.Invoke(processor)
 	})
 
@@ -218,6 +244,21 @@ var _ = Describe("LRPProcessor", func() {
 			}))
 		})
 
+		It("records a summary of the sync", func() {
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+			Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+			summary := syncReports.Summaries()[0]
+			Expect(summary.Kind).To(Equal(bulk.LRPSyncKind))
+			Expect(summary.FingerprintsFetched).To(Equal(4))
+			Expect(summary.MissingGuids).To(ConsistOf("new-process-guid"))
+			Expect(summary.StaleGuids).To(ConsistOf("stale-process-guid", "docker-process-guid"))
+			Expect(summary.DeletedGuids).To(ConsistOf("excess-process-guid"))
+			Expect(summary.FailuresByType).To(BeEmpty())
+			Expect(summary.FreshnessBumped).To(BeTrue())
+			Expect(summary.EndTime.Sub(summary.StartTime)).To(Equal(syncDuration))
+		})
+
 		Context("desired lrps", func() {
 			Context("and the differ discovers desired LRPs to delete", func() {
 				It("the processor deletes them", func() {
@@ -240,10 +281,12 @@ var _ = Describe("LRPProcessor", func() {
 					Expect(err).NotTo(HaveOccurred())
 
 					Eventually(buildpackRecipeBuilder.BuildArgsForCall(0)).Should(Equal(
-						&cc_messages.DesireAppRequestFromCC{
-							ProcessGuid: "new-process-guid",
-							ETag:        "new-etag",
-							RoutingInfo: expectedRoutingInfo,
+						&recipebuilder.DesireAppRequest{
+							DesireAppRequestFromCC: cc_messages.DesireAppRequestFromCC{
+								ProcessGuid: "new-process-guid",
+								ETag:        "new-etag",
+								RoutingInfo: expectedRoutingInfo,
+							},
 						}))
 				})
 
@@ -261,8 +304,8 @@ var _ = Describe("LRPProcessor", func() {
 							cancel <-chan struct{},
 							httpClient *http.Client,
 							fingerprints <-chan []cc_messages.CCDesiredAppFingerprint,
-						) (<-chan []cc_messages.DesireAppRequestFromCC, <-chan error) {
-							desireAppRequests := make(chan []cc_messages.DesireAppRequestFromCC)
+						) (<-chan []recipebuilder.DesireAppRequest, <-chan error) {
+							desireAppRequests := make(chan []recipebuilder.DesireAppRequest)
 							close(desireAppRequests)
 
 							<-fingerprints
@@ -528,6 +571,11 @@ var _ = Describe("LRPProcessor", func() {
 							return metricSender.GetValue("NsyncInvalidDesiredLRPsFound")
 						}).Should(Equal(fake.Metric{Value: 2, Unit: "Metric"}))
 					})
+
+					It("records the invalid LRPs in the sync summary", func() {
+						Eventually(syncReports.Summaries).Should(HaveLen(1))
+						Expect(syncReports.Summaries()[0].InvalidLRPs).To(Equal(2))
+					})
 				})
 
 				It("does not update the domain", func() {
@@ -538,6 +586,14 @@ var _ = Describe("LRPProcessor", func() {
 					Eventually(bbsClient.DesireLRPCallCount).Should(Equal(1))
 					Eventually(bbsClient.RemoveDesiredLRPCallCount).Should(Equal(1))
 				})
+
+				It("records the failures by type in the sync summary", func() {
+					Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+					summary := syncReports.Summaries()[0]
+					Expect(summary.FailuresByType).To(Equal(map[string]int{"UnknownError": 2}))
+					Expect(summary.FreshnessBumped).To(BeFalse())
+				})
 			})
 
 			Context("when creating the desired lrp fails", func() {
@@ -574,6 +630,800 @@ var _ = Describe("LRPProcessor", func() {
 		})
 	})
 
+	Context("when there are many desired lrps to delete", func() {
+		var removeBlock chan struct{}
+
+		BeforeEach(func() {
+			removeBlock = make(chan struct{})
+			bbsClient.RemoveDesiredLRPStub = func(lager.Logger, string) error {
+				<-removeBlock
+				return nil
+			}
+
+			bbsClient.DesiredLRPSchedulingInfosReturns(append(existingSchedulingInfos,
+				&models.DesiredLRPSchedulingInfo{
+					DesiredLRPKey: models.NewDesiredLRPKey("excess-process-guid-2", "domain", "log-guid"),
+				},
+				&models.DesiredLRPSchedulingInfo{
+					DesiredLRPKey: models.NewDesiredLRPKey("excess-process-guid-3", "domain", "log-guid"),
+				},
+			), nil)
+		})
+
+		AfterEach(func() {
+			select {
+			case <-removeBlock:
+			default:
+				close(removeBlock)
+			}
+		})
+
+		It("deletes them concurrently", func() {
+			Eventually(bbsClient.RemoveDesiredLRPCallCount).Should(Equal(3))
+			close(removeBlock)
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+		})
+
+		It("emits the number of deleted desired lrps", func() {
+			close(removeBlock)
+			Eventually(func() uint64 {
+				return metricSender.GetCounter("NsyncDesiredLRPsDeleted")
+			}).Should(Equal(uint64(3)))
+		})
+
+		Context("and the deletes fail", func() {
+			BeforeEach(func() {
+				bbsClient.RemoveDesiredLRPStub = func(lager.Logger, string) error {
+					<-removeBlock
+					return errors.New("boom")
+				}
+			})
+
+			It("emits the number of failed deletes", func() {
+				close(removeBlock)
+				Eventually(func() uint64 {
+					return metricSender.GetCounter("NsyncDesiredLRPDeletesFailed")
+				}).Should(Equal(uint64(3)))
+			})
+		})
+
+		Context("and the processor is signalled mid-batch", func() {
+			It("stops without waiting for the deletes to finish", func() {
+				Eventually(bbsClient.RemoveDesiredLRPCallCount).Should(Equal(3))
+				process.Signal(os.Interrupt)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+				Consistently(bbsClient.UpsertDomainCallCount).Should(Equal(0))
+			})
+		})
+	})
+
+	Context("when the deletions exceed the configured threshold", func() {
+		itRefusesToDelete := func() {
+			It("does not delete the excess desired lrps", func() {
+				Eventually(bbsClient.DesireLRPCallCount).Should(Equal(1))
+				Consistently(bbsClient.RemoveDesiredLRPCallCount).Should(Equal(0))
+			})
+
+			It("does not update the domain", func() {
+				Consistently(bbsClient.UpsertDomainCallCount).Should(Equal(0))
+			})
+
+			It("logs and emits a metric explaining why", func() {
+				Eventually(logger.TestSink.Buffer).Should(gbytes.Say("refusing-to-delete-excess-desired-lrps"))
+				Eventually(func() uint64 {
+					return metricSender.GetCounter("NsyncDeletionThresholdExceeded")
+				}).Should(Equal(uint64(1)))
+			})
+		}
+
+		Context("by absolute count", func() {
+			BeforeEach(func() {
+				maxDeletions = 1
+				bbsClient.DesiredLRPSchedulingInfosReturns(append(existingSchedulingInfos, &models.DesiredLRPSchedulingInfo{
+					DesiredLRPKey: models.NewDesiredLRPKey("another-excess-process-guid", "domain", "log-guid"),
+					Annotation:    "excess-etag",
+				}), nil)
+			})
+
+			itRefusesToDelete()
+		})
+
+		Context("by percentage of existing desired lrps", func() {
+			BeforeEach(func() {
+				maxDeletionPercentage = 20
+			})
+
+			itRefusesToDelete()
+		})
+	})
+
+	Context("when the deletions are within the configured threshold", func() {
+		BeforeEach(func() {
+			maxDeletions = 1
+			maxDeletionPercentage = 25
+		})
+
+		It("deletes the excess desired lrps and updates the domain", func() {
+			Eventually(bbsClient.RemoveDesiredLRPCallCount).Should(Equal(1))
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("when dry run is enabled", func() {
+		BeforeEach(func() {
+			dryRun = true
+		})
+
+		It("fetches and diffs the desired state", func() {
+			Eventually(fetcher.FetchFingerprintsCallCount).Should(Equal(1))
+			Eventually(fetcher.FetchDesiredAppsCallCount).Should(Equal(2))
+			Eventually(buildpackRecipeBuilder.BuildCallCount).Should(Equal(1))
+		})
+
+		It("does not modify the bbs", func() {
+			Eventually(logger.TestSink.Buffer).Should(gbytes.Say("dry-run-report"))
+
+			Consistently(bbsClient.DesireLRPCallCount).Should(Equal(0))
+			Consistently(bbsClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+			Consistently(bbsClient.RemoveDesiredLRPCallCount).Should(Equal(0))
+			Consistently(bbsClient.UpsertDomainCallCount).Should(Equal(0))
+		})
+
+		It("reports the creates, updates and deletes it would have made", func() {
+			Eventually(logger.TestSink.Buffer).Should(gbytes.Say(`"guids-to-create":\["new-process-guid"\]`))
+			Eventually(logger.LogMessages).Should(ContainElement("test.sync-lrps.dry-run-report"))
+
+			var reportData lager.Data
+			for _, log := range logger.Logs() {
+				if log.Message == "test.sync-lrps.dry-run-report" {
+					reportData = log.Data
+				}
+			}
+			Expect(reportData["guids-to-update"]).To(ConsistOf("stale-process-guid", "docker-process-guid"))
+			Expect(reportData["guids-to-delete"]).To(ConsistOf("excess-process-guid"))
+		})
+	})
+
+	Context("when journaling is enabled", func() {
+		var journalDir string
+
+		BeforeEach(func() {
+			var err error
+			journalDir, err = ioutil.TempDir("", "journal")
+			Expect(err).NotTo(HaveOccurred())
+
+			journal = bulk.NewJournal(journalDir, 0)
+
+			bbsClient.DesiredLRPByProcessGuidReturns(&models.DesiredLRP{
+				ProcessGuid: "excess-process-guid",
+				Annotation:  "excess-etag",
+			}, nil)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(journalDir)
+		})
+
+		readSegment := func() []bulk.JournalEntry {
+			paths, err := filepath.Glob(filepath.Join(journalDir, "lrp-sync-*.jsonl"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(HaveLen(1))
+
+			entries, err := bulk.ReadJournalSegment(paths[0])
+			Expect(err).NotTo(HaveOccurred())
+			return entries
+		}
+
+		entryFor := func(entries []bulk.JournalEntry, processGuid string) bulk.JournalEntry {
+			for _, entry := range entries {
+				if entry.ProcessGuid == processGuid {
+					return entry
+				}
+			}
+			Fail("no journal entry for " + processGuid)
+			return bulk.JournalEntry{}
+		}
+
+		It("records every create, update and delete of the sync in one segment", func() {
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+			entries := readSegment()
+			Expect(entries).To(HaveLen(4))
+
+			created := entryFor(entries, "new-process-guid")
+			Expect(created.Action).To(Equal(bulk.JournalCreate))
+			Expect(created.DesiredLRP.Annotation).To(Equal("new-etag"))
+			Expect(created.After.Annotation).To(Equal("new-etag"))
+			Expect(created.Before).To(BeNil())
+
+			updated := entryFor(entries, "stale-process-guid")
+			Expect(updated.Action).To(Equal(bulk.JournalUpdate))
+			Expect(updated.Before.Annotation).To(Equal("stale-etag"))
+			Expect(updated.After.Annotation).To(Equal("new-etag"))
+
+			deleted := entryFor(entries, "excess-process-guid")
+			Expect(deleted.Action).To(Equal(bulk.JournalDelete))
+			Expect(deleted.Before.Annotation).To(Equal("excess-etag"))
+			Expect(deleted.DesiredLRP.ProcessGuid).To(Equal("excess-process-guid"))
+			Expect(deleted.Timestamp).To(BeNumerically(">", 0))
+		})
+
+		Context("when the journal keeps a limited number of segments", func() {
+			BeforeEach(func() {
+				journal = bulk.NewJournal(journalDir, 1)
+
+				err := ioutil.WriteFile(filepath.Join(journalDir, "lrp-sync-1.jsonl"), []byte{}, 0600)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes the older segments after the sync", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				Eventually(func() []string {
+					paths, err := filepath.Glob(filepath.Join(journalDir, "lrp-sync-*.jsonl"))
+					Expect(err).NotTo(HaveOccurred())
+					return paths
+				}).Should(HaveLen(1))
+
+				_, err := os.Stat(filepath.Join(journalDir, "lrp-sync-1.jsonl"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+				Expect(readSegment()).To(HaveLen(4))
+			})
+		})
+
+		Context("when the sync changes nothing", func() {
+			BeforeEach(func() {
+				fingerprintsToFetch = []cc_messages.CCDesiredAppFingerprint{
+					{ProcessGuid: "current-process-guid", ETag: "current-etag"},
+				}
+				bbsClient.DesiredLRPSchedulingInfosReturns(existingSchedulingInfos[:1], nil)
+			})
+
+			It("does not write a segment", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				paths, err := filepath.Glob(filepath.Join(journalDir, "*"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(paths).To(BeEmpty())
+			})
+		})
+
+		Context("when the desired lrp to delete cannot be snapshotted", func() {
+			BeforeEach(func() {
+				bbsClient.DesiredLRPByProcessGuidReturns(nil, errors.New("oh no"))
+			})
+
+			It("does not delete it", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(0))
+
+				for _, entry := range readSegment() {
+					Expect(entry.Action).NotTo(Equal(bulk.JournalDelete))
+				}
+			})
+		})
+
+		Context("when dry run is enabled", func() {
+			BeforeEach(func() {
+				dryRun = true
+			})
+
+			It("does not write a segment", func() {
+				Eventually(logger.TestSink.Buffer).Should(gbytes.Say("dry-run-report"))
+
+				paths, err := filepath.Glob(filepath.Join(journalDir, "*"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(paths).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when a stale app changes fields that cannot be updated", func() {
+		var existingRouteMessage json.RawMessage
+
+		BeforeEach(func() {
+			maxRecipeRecreates = 1
+
+			// keep the up-to-date LRP current so that it does not draw from the
+			// recreate budget
+			buildpackRecipeBuilder.RecipeVersionsReturns(map[string]string{"buildpack/some-stack": "buildpack-v1"})
+			currentVersion := json.RawMessage(`"buildpack-v1"`)
+			existingSchedulingInfos[0].Routes = models.Routes{
+				recipebuilder.RecipeVersionRouteKey: &currentVersion,
+			}
+
+			existingRouteMessage = json.RawMessage(`{ "some-route-key": "some-route-value" }`)
+			oldCFRouteMessage := json.RawMessage(`[{"hostnames":["old-host"],"port":8080}]`)
+
+			bbsClient.DesiredLRPByProcessGuidStub = func(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
+				return &models.DesiredLRP{
+					ProcessGuid: processGuid,
+					MemoryMb:    256,
+					Routes: &models.Routes{
+						"router-route-data": &existingRouteMessage,
+						cfroutes.CF_ROUTER:  &oldCFRouteMessage,
+					},
+				}, nil
+			}
+
+			buildpackRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
+				newCFRouteMessage := json.RawMessage(`[{"hostnames":["new-host"],"port":8080}]`)
+				return &models.DesiredLRP{
+					ProcessGuid: ccRequest.ProcessGuid,
+					Annotation:  ccRequest.ETag,
+					MemoryMb:    512,
+					Routes: &models.Routes{
+						cfroutes.CF_ROUTER: &newCFRouteMessage,
+					},
+				}, nil
+			}
+
+			dockerRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
+				return &models.DesiredLRP{
+					ProcessGuid: ccRequest.ProcessGuid,
+					Annotation:  ccRequest.ETag,
+					MemoryMb:    256,
+				}, nil
+			}
+		})
+
+		It("replaces the LRP instead of updating it", func() {
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+			Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(1))
+			_, updatedGuid, _ := bbsClient.UpdateDesiredLRPArgsForCall(0)
+			Expect(updatedGuid).To(Equal("docker-process-guid"))
+
+			removed := []string{}
+			for i := 0; i < bbsClient.RemoveDesiredLRPCallCount(); i++ {
+				_, guid := bbsClient.RemoveDesiredLRPArgsForCall(i)
+				removed = append(removed, guid)
+			}
+			Expect(removed).To(ConsistOf("stale-process-guid", "excess-process-guid"))
+
+			var replacement *models.DesiredLRP
+			for i := 0; i < bbsClient.DesireLRPCallCount(); i++ {
+				_, desired := bbsClient.DesireLRPArgsForCall(i)
+				if desired.ProcessGuid == "stale-process-guid" {
+					replacement = desired
+				}
+			}
+			Expect(replacement).NotTo(BeNil())
+			Expect(replacement.MemoryMb).To(BeEquivalentTo(512))
+			Expect(replacement.Annotation).To(Equal("new-etag"))
+		})
+
+		Context("when the stale LRP has its docker image pinned", func() {
+			var pinnedMessage json.RawMessage
+
+			BeforeEach(func() {
+				pinnedMessage = json.RawMessage(`{"image":"user/repo:tag","digest":"sha256:` + strings.Repeat("a", 64) + `"}`)
+				existingSchedulingInfos[2].Routes = models.Routes{
+					recipebuilder.PinnedImageRouteKey: &pinnedMessage,
+				}
+			})
+
+			It("rebuilds it with the pin, so that the tag is not resolved again", func() {
+				Eventually(dockerRecipeBuilder.BuildCallCount).Should(Equal(1))
+
+				request := dockerRecipeBuilder.BuildArgsForCall(0)
+				Expect(request.PinnedImage).To(Equal(&recipebuilder.PinnedImage{
+					Image:  "user/repo:tag",
+					Digest: "sha256:" + strings.Repeat("a", 64),
+				}))
+			})
+
+			It("keeps the pin on the updated LRP", func() {
+				Eventually(bbsClient.UpdateDesiredLRPCallCount).Should(Equal(1))
+
+				_, _, update := bbsClient.UpdateDesiredLRPArgsForCall(0)
+				Expect((*update.Routes)[recipebuilder.PinnedImageRouteKey]).To(Equal(&pinnedMessage))
+			})
+		})
+
+		It("keeps the routes other components own and takes the rest from the rebuilt LRP", func() {
+			Eventually(bbsClient.DesireLRPCallCount).Should(Equal(2))
+
+			for i := 0; i < bbsClient.DesireLRPCallCount(); i++ {
+				_, desired := bbsClient.DesireLRPArgsForCall(i)
+				if desired.ProcessGuid != "stale-process-guid" {
+					continue
+				}
+
+				routes := *desired.Routes
+				Expect(routes).To(HaveKeyWithValue("router-route-data", &existingRouteMessage))
+				Expect(string(*routes[cfroutes.CF_ROUTER])).To(ContainSubstring("new-host"))
+			}
+		})
+
+		It("logs the fields that changed", func() {
+			Eventually(logger.TestSink.Buffer).Should(gbytes.Say(`replacing-desired-lrp.*"changed-fields":\["memory_mb"\]`))
+		})
+
+		It("emits a metric for each replacement", func() {
+			Eventually(func() uint64 {
+				return metricSender.GetCounter("NsyncDesiredLRPsReplaced")
+			}).Should(Equal(uint64(1)))
+		})
+
+		Context("when more apps need replacing than the recreate budget allows", func() {
+			BeforeEach(func() {
+				dockerRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
+					return &models.DesiredLRP{
+						ProcessGuid: ccRequest.ProcessGuid,
+						Annotation:  ccRequest.ETag,
+						MemoryMb:    1024,
+					}, nil
+				}
+			})
+
+			It("replaces one and updates the other without bumping its etag", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(2))
+				Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(1))
+
+				_, _, update := bbsClient.UpdateDesiredLRPArgsForCall(0)
+				Expect(update.Instances).NotTo(BeNil())
+				Expect(update.Routes).NotTo(BeNil())
+				Expect(update.Annotation).To(BeNil())
+			})
+
+			It("logs the deferred replacement", func() {
+				Eventually(logger.TestSink.Buffer).Should(gbytes.Say(`deferring-replace-desired-lrp`))
+			})
+		})
+
+		Context("when replacing is disabled", func() {
+			BeforeEach(func() {
+				maxRecipeRecreates = 0
+			})
+
+			It("updates the LRP in place without rebuilding it", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(2))
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+				Expect(buildpackRecipeBuilder.BuildCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the stale app cannot be rebuilt", func() {
+			BeforeEach(func() {
+				buildpackRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
+					if ccRequest.ProcessGuid == "stale-process-guid" {
+						return nil, errors.New("boom")
+					}
+					return &models.DesiredLRP{ProcessGuid: ccRequest.ProcessGuid}, nil
+				}
+			})
+
+			It("still updates the LRP without bumping its etag", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+
+				var update *models.DesiredLRPUpdate
+				for i := 0; i < bbsClient.UpdateDesiredLRPCallCount(); i++ {
+					_, guid, u := bbsClient.UpdateDesiredLRPArgsForCall(i)
+					if guid == "stale-process-guid" {
+						update = u
+					}
+				}
+				Expect(update).NotTo(BeNil())
+				Expect(update.Instances).NotTo(BeNil())
+				Expect(update.Annotation).To(BeNil())
+			})
+
+			It("fails the sync and does not bump freshness", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				summary := syncReports.Summaries()[0]
+				Expect(summary.FailuresByType).NotTo(BeEmpty())
+				Expect(summary.FreshnessBumped).To(BeFalse())
+				Expect(bbsClient.UpsertDomainCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when desiring the replacement fails", func() {
+			BeforeEach(func() {
+				bbsClient.DesireLRPStub = func(logger lager.Logger, desired *models.DesiredLRP) error {
+					if desired.ProcessGuid == "stale-process-guid" && desired.MemoryMb == 512 {
+						return errors.New("boom")
+					}
+					return nil
+				}
+			})
+
+			It("desires the existing LRP again", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				var restored *models.DesiredLRP
+				for i := 0; i < bbsClient.DesireLRPCallCount(); i++ {
+					_, desired := bbsClient.DesireLRPArgsForCall(i)
+					if desired.ProcessGuid == "stale-process-guid" {
+						restored = desired
+					}
+				}
+				Expect(restored).NotTo(BeNil())
+				Expect(restored.MemoryMb).To(BeEquivalentTo(256))
+				Expect(logger.TestSink.Buffer()).To(gbytes.Say(`restoring-desired-lrp`))
+			})
+
+			It("does not bump freshness", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+				Expect(bbsClient.UpsertDomainCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when only the ssh host keys were regenerated", func() {
+			BeforeEach(func() {
+				sshdAction := func(hostKey string) *models.Action {
+					return models.WrapAction(models.Codependent(
+						&models.RunAction{Path: "/tmp/lifecycle/launcher", User: "vcap"},
+						&models.RunAction{Path: "/tmp/lifecycle/diego-sshd", User: "vcap", Args: []string{"-hostKey=" + hostKey}},
+					))
+				}
+
+				bbsClient.DesiredLRPByProcessGuidStub = func(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
+					return &models.DesiredLRP{ProcessGuid: processGuid, Action: sshdAction("old-key")}, nil
+				}
+				buildpackRecipeBuilder.BuildStub = func(ccRequest *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
+					return &models.DesiredLRP{ProcessGuid: ccRequest.ProcessGuid, Action: sshdAction("new-key")}, nil
+				}
+				dockerRecipeBuilder.BuildStub = buildpackRecipeBuilder.BuildStub
+			})
+
+			It("updates the LRP in place", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(2))
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when removing the LRP fails", func() {
+			BeforeEach(func() {
+				bbsClient.RemoveDesiredLRPStub = func(logger lager.Logger, processGuid string) error {
+					if processGuid == "stale-process-guid" {
+						return errors.New("boom")
+					}
+					return nil
+				}
+			})
+
+			It("neither desires it again nor bumps freshness", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				Expect(bbsClient.DesireLRPCallCount()).To(Equal(1))
+				Expect(bbsClient.UpsertDomainCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when fetching the existing LRP fails", func() {
+			BeforeEach(func() {
+				bbsClient.DesiredLRPByProcessGuidStub = func(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
+					return nil, errors.New("boom")
+				}
+			})
+
+			It("leaves the LRP alone and does not bump freshness", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				Expect(bbsClient.UpdateDesiredLRPCallCount()).To(Equal(0))
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+				Expect(bbsClient.UpsertDomainCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when dry run is enabled", func() {
+			BeforeEach(func() {
+				dryRun = true
+			})
+
+			It("reports the replacement it would have made", func() {
+				Eventually(logger.TestSink.Buffer).Should(gbytes.Say(`"guids-to-recreate":\["stale-process-guid"\]`))
+				Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when recreating drifted LRPs is enabled", func() {
+		removedGuids := func() []string {
+			guids := []string{}
+			for i := 0; i < bbsClient.RemoveDesiredLRPCallCount(); i++ {
+				_, guid := bbsClient.RemoveDesiredLRPArgsForCall(i)
+				guids = append(guids, guid)
+			}
+			return guids
+		}
+
+		desiredGuids := func() []string {
+			guids := []string{}
+			for i := 0; i < bbsClient.DesireLRPCallCount(); i++ {
+				_, desired := bbsClient.DesireLRPArgsForCall(i)
+				guids = append(guids, desired.ProcessGuid)
+			}
+			return guids
+		}
+
+		BeforeEach(func() {
+			maxRecipeRecreates = 1
+			buildpackRecipeBuilder.RecipeVersionsReturns(map[string]string{"buildpack/some-stack": "buildpack-v2"})
+			dockerRecipeBuilder.RecipeVersionsReturns(map[string]string{"docker": "docker-v2"})
+
+			oldVersion := json.RawMessage(`"buildpack-v1"`)
+			existingSchedulingInfos[0].Routes = models.Routes{
+				recipebuilder.RecipeVersionRouteKey: &oldVersion,
+			}
+		})
+
+		It("recreates the up-to-date LRPs built by an older recipe", func() {
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+			Expect(removedGuids()).To(ConsistOf("current-process-guid", "excess-process-guid"))
+			Expect(desiredGuids()).To(ConsistOf("current-process-guid", "new-process-guid"))
+			Expect(buildpackRecipeBuilder.BuildCallCount()).To(Equal(3))
+		})
+
+		It("records the drifted LRPs and the recreates", func() {
+			Eventually(syncReports.Summaries).Should(HaveLen(1))
+			Expect(syncReports.Summaries()[0].DriftedGuids).To(ConsistOf("current-process-guid"))
+
+			Eventually(func() uint64 {
+				return metricSender.GetCounter("NsyncDesiredLRPsRecreated")
+			}).Should(Equal(uint64(1)))
+		})
+
+		Context("when the drifted LRP has routes other components own", func() {
+			var existingRouteMessage json.RawMessage
+
+			BeforeEach(func() {
+				existingRouteMessage = json.RawMessage(`{ "some-route-key": "some-route-value" }`)
+				oldCFRouteMessage := json.RawMessage(`[{"hostnames":["old-host"],"port":8080}]`)
+
+				bbsClient.DesiredLRPByProcessGuidStub = func(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
+					return &models.DesiredLRP{
+						ProcessGuid: processGuid,
+						Routes: &models.Routes{
+							"router-route-data": &existingRouteMessage,
+							cfroutes.CF_ROUTER:  &oldCFRouteMessage,
+						},
+					}, nil
+				}
+			})
+
+			It("keeps them on the recreated LRP", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				var recreated *models.DesiredLRP
+				for i := 0; i < bbsClient.DesireLRPCallCount(); i++ {
+					_, desired := bbsClient.DesireLRPArgsForCall(i)
+					if desired.ProcessGuid == "current-process-guid" {
+						recreated = desired
+					}
+				}
+				Expect(recreated).NotTo(BeNil())
+				Expect(recreated.Routes).NotTo(BeNil())
+				Expect(*recreated.Routes).To(HaveKeyWithValue("router-route-data", &existingRouteMessage))
+				Expect(*recreated.Routes).NotTo(HaveKey(cfroutes.CF_ROUTER))
+			})
+		})
+
+		Context("when the LRP was built by the current recipe", func() {
+			BeforeEach(func() {
+				currentVersion := json.RawMessage(`"buildpack-v2"`)
+				existingSchedulingInfos[0].Routes = models.Routes{
+					recipebuilder.RecipeVersionRouteKey: &currentVersion,
+				}
+			})
+
+			It("leaves it alone", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				Expect(removedGuids()).To(ConsistOf("excess-process-guid"))
+				Expect(syncReports.Summaries()[0].DriftedGuids).To(BeEmpty())
+			})
+		})
+
+		Context("when more LRPs have drifted than the rollout allows", func() {
+			BeforeEach(func() {
+				fingerprintsToFetch = append(fingerprintsToFetch, cc_messages.CCDesiredAppFingerprint{
+					ProcessGuid: "unversioned-process-guid",
+					ETag:        "unversioned-etag",
+				})
+				existingSchedulingInfos = append(existingSchedulingInfos, &models.DesiredLRPSchedulingInfo{
+					DesiredLRPKey: models.NewDesiredLRPKey("unversioned-process-guid", "domain", "log-guid"),
+					Annotation:    "unversioned-etag",
+				})
+				bbsClient.DesiredLRPSchedulingInfosReturns(existingSchedulingInfos, nil)
+			})
+
+			It("recreates only as many as allowed per sync", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				Expect(syncReports.Summaries()[0].DriftedGuids).To(ConsistOf("current-process-guid", "unversioned-process-guid"))
+				Expect(removedGuids()).To(HaveLen(2))
+				Expect(removedGuids()).To(ContainElement("excess-process-guid"))
+			})
+		})
+
+		Context("when removing the drifted LRP fails", func() {
+			BeforeEach(func() {
+				bbsClient.RemoveDesiredLRPStub = func(logger lager.Logger, processGuid string) error {
+					if processGuid == "current-process-guid" {
+						return errors.New("boom")
+					}
+					return nil
+				}
+			})
+
+			It("does not desire it again and does not bump freshness", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				Expect(desiredGuids()).To(ConsistOf("new-process-guid"))
+				Expect(bbsClient.UpsertDomainCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when dry run is enabled", func() {
+			BeforeEach(func() {
+				dryRun = true
+			})
+
+			It("reports the recreates it would have made", func() {
+				Eventually(logger.TestSink.Buffer).Should(gbytes.Say(`"guids-to-recreate":\["current-process-guid"\]`))
+				Expect(removedGuids()).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when recreating drifted LRPs is disabled", func() {
+		It("does not look for drifted LRPs", func() {
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+			Expect(fetcher.FetchDesiredAppsCallCount()).To(Equal(2))
+			Expect(buildpackRecipeBuilder.RecipeVersionsCallCount()).To(Equal(0))
+			Expect(bbsClient.RemoveDesiredLRPCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when a sync is triggered", func() {
+		It("syncs immediately without waiting for the polling interval", func() {
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+			Expect(processor.(*bulk.LRPProcessor).Trigger()).To(BeTrue())
+			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(2))
+			Consistently(bbsClient.UpsertDomainCallCount).Should(Equal(2))
+		})
+
+		Context("while a sync is in flight", func() {
+			var upsertBlock chan struct{}
+
+			BeforeEach(func() {
+				upsertBlock = make(chan struct{})
+				bbsClient.UpsertDomainStub = func(lager.Logger, string, time.Duration) error {
+					<-upsertBlock
+					return nil
+				}
+			})
+
+			It("runs a single sync after the current one completes", func() {
+				Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
+
+				lrpProcessor := processor.(*bulk.LRPProcessor)
+				Expect(lrpProcessor.Trigger()).To(BeTrue())
+				Expect(lrpProcessor.Trigger()).To(BeFalse())
+
+				Consistently(bbsClient.DesiredLRPSchedulingInfosCallCount).Should(Equal(1))
+
+				close(upsertBlock)
+				Eventually(bbsClient.DesiredLRPSchedulingInfosCallCount).Should(Equal(2))
+				Consistently(bbsClient.DesiredLRPSchedulingInfosCallCount).Should(Equal(2))
+			})
+		})
+	})
+
 	Context("when getting all desired LRPs fails", func() {
 		BeforeEach(func() {
 			bbsClient.DesiredLRPSchedulingInfosReturns(nil, errors.New("oh no!"))
@@ -0,0 +1,158 @@
+package bulk
+
+import (
+	"sync/atomic"
+
+	"code.cloudfoundry.org/bbs/models"
+	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/routing-info/cfroutes"
+	"github.com/cloudfoundry-incubator/routing-info/tcp_routes"
+)
+
+const sshdPath = "/tmp/lifecycle/diego-sshd"
+
+type replacement int
+
+const (
+	noReplacement replacement = iota
+	replaced
+	replacementDeferred
+)
+
+// recreateBudget caps how many LRPs a single sync removes and desires again.
+// Drifted and stale LRPs draw from the same budget, so together they never
+// restart more apps than maxRecipeRecreates allows.
+type recreateBudget struct {
+	remaining int32
+}
+
+// newRecreateBudget returns nil when recreating is disabled.
+func newRecreateBudget(limit int) *recreateBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &recreateBudget{remaining: int32(limit)}
+}
+
+// take claims one recreate and reports whether any were left.
+func (b *recreateBudget) take() bool {
+	if b == nil {
+		return false
+	}
+	return atomic.AddInt32(&b.remaining, -1) >= 0
+}
+
+type immutableField struct {
+	name    string
+	project func(*models.DesiredLRP) *models.DesiredLRP
+}
+
+// immutableFields are the parts of a DesiredLRP that can only be changed by
+// replacing it. Each projection keeps a single field so that the generated
+// Equal can compare it.
+var immutableFields = []immutableField{
+	{"memory_mb", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{MemoryMb: d.MemoryMb}
+	}},
+	{"disk_mb", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{DiskMb: d.DiskMb}
+	}},
+	{"cpu_weight", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{CpuWeight: d.CpuWeight}
+	}},
+	{"privileged", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{Privileged: d.Privileged}
+	}},
+	{"rootfs", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{RootFs: d.RootFs}
+	}},
+	{"env", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{EnvironmentVariables: d.EnvironmentVariables}
+	}},
+	{"setup", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{Setup: d.Setup}
+	}},
+	{"cached_dependencies", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{CachedDependencies: d.CachedDependencies}
+	}},
+	{"action", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{Action: withoutSSHDKeys(d.Action)}
+	}},
+	{"monitor", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{Monitor: d.Monitor}
+	}},
+	{"start_timeout_ms", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{StartTimeoutMs: d.StartTimeoutMs}
+	}},
+	{"ports", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{Ports: d.Ports}
+	}},
+	{"volume_mounts", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{VolumeMounts: d.VolumeMounts}
+	}},
+	{"placement_tags", func(d *models.DesiredLRP) *models.DesiredLRP {
+		return &models.DesiredLRP{PlacementTags: d.PlacementTags}
+	}},
+}
+
+// immutableFieldChanges returns the names of the immutable fields that differ
+// between the existing LRP and its rebuilt definition.
+func immutableFieldChanges(existing, desired *models.DesiredLRP) []string {
+	changes := []string{}
+	for _, field := range immutableFields {
+		if !field.project(existing).Equal(field.project(desired)) {
+			changes = append(changes, field.name)
+		}
+	}
+	return changes
+}
+
+// withoutSSHDKeys drops the arguments of the diego-sshd process, which carry
+// host keys that are generated anew on every build. Whether sshd runs at all
+// still counts as a change.
+func withoutSSHDKeys(action *models.Action) *models.Action {
+	if action == nil || action.CodependentAction == nil {
+		return action
+	}
+
+	actions := make([]*models.Action, len(action.CodependentAction.Actions))
+	for i, subAction := range action.CodependentAction.Actions {
+		actions[i] = subAction
+		if subAction.RunAction != nil && subAction.RunAction.Path == sshdPath {
+			actions[i] = models.WrapAction(&models.RunAction{
+				Path: subAction.RunAction.Path,
+				User: subAction.RunAction.User,
+			})
+		}
+	}
+
+	return models.WrapAction(&models.CodependentAction{
+		Actions:   actions,
+		LogSource: action.CodependentAction.LogSource,
+	})
+}
+
+// preserveRoutes carries over route entries owned by other components, which
+// the rebuilt definition knows nothing about.
+func preserveRoutes(desired *models.DesiredLRP, existing *models.Routes) {
+	if existing == nil {
+		return
+	}
+
+	if desired.Routes == nil {
+		routes := models.Routes{}
+		desired.Routes = &routes
+	}
+
+	for key, value := range *existing {
+		switch key {
+		case cfroutes.CF_ROUTER, tcp_routes.TCP_ROUTER, ssh_routes.DIEGO_SSH, recipebuilder.RecipeVersionRouteKey, recipebuilder.PinnedImageRouteKey:
+			continue
+		}
+
+		if _, ok := (*desired.Routes)[key]; !ok {
+			(*desired.Routes)[key] = value
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package bulk
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+const (
+	LRPSyncKind  = "lrps"
+	TaskSyncKind = "tasks"
+)
+
+type SyncSummary struct {
+	Kind            string         `json:"kind"`
+	StartTime       time.Time      `json:"start_time"`
+	EndTime         time.Time      `json:"end_time"`
+	DryRun          bool           `json:"dry_run"`
+	FailuresByType  map[string]int `json:"failures_by_type"`
+	FreshnessBumped bool           `json:"freshness_bumped"`
+
+	FingerprintsFetched int      `json:"fingerprints_fetched,omitempty"`
+	MissingGuids        []string `json:"missing_guids,omitempty"`
+	StaleGuids          []string `json:"stale_guids,omitempty"`
+	DeletedGuids        []string `json:"deleted_guids,omitempty"`
+	DriftedGuids        []string `json:"drifted_guids,omitempty"`
+	DeletionsRefused    bool     `json:"deletions_refused,omitempty"`
+	InvalidLRPs         int      `json:"invalid_lrps,omitempty"`
+
+	TaskStatesFetched int      `json:"task_states_fetched,omitempty"`
+	TasksToFail       []string `json:"tasks_to_fail,omitempty"`
+	TasksToCancel     []string `json:"tasks_to_cancel,omitempty"`
+
+	lock sync.Mutex
+}
+
+func newSyncSummary(kind string, startTime time.Time) *SyncSummary {
+	return &SyncSummary{
+		Kind:           kind,
+		StartTime:      startTime,
+		FailuresByType: map[string]int{},
+	}
+}
+
+func (s *SyncSummary) finish(endTime time.Time, invalidLRPs int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.EndTime = endTime
+	s.InvalidLRPs = invalidLRPs
+}
+
+func (s *SyncSummary) markFreshnessBumped() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.FreshnessBumped = true
+}
+
+func (s *SyncSummary) markDeletionsRefused() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.DeletionsRefused = true
+}
+
+func (s *SyncSummary) recordFailure(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.FailuresByType[errorType(err)]++
+}
+
+func (s *SyncSummary) recordFingerprints(fingerprints []cc_messages.CCDesiredAppFingerprint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.FingerprintsFetched += len(fingerprints)
+}
+
+func (s *SyncSummary) recordMissing(fingerprints []cc_messages.CCDesiredAppFingerprint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.MissingGuids = appendProcessGuids(s.MissingGuids, fingerprints)
+}
+
+func (s *SyncSummary) recordStale(fingerprints []cc_messages.CCDesiredAppFingerprint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.StaleGuids = appendProcessGuids(s.StaleGuids, fingerprints)
+}
+
+func (s *SyncSummary) recordDrifted(fingerprints []cc_messages.CCDesiredAppFingerprint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.DriftedGuids = appendProcessGuids(s.DriftedGuids, fingerprints)
+}
+
+func (s *SyncSummary) recordDeleted(processGuids []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.DeletedGuids = append(s.DeletedGuids, processGuids...)
+}
+
+func (s *SyncSummary) recordTaskStates(taskStates []cc_messages.CCTaskState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.TaskStatesFetched += len(taskStates)
+}
+
+func (s *SyncSummary) recordTasksToFail(taskStates []cc_messages.CCTaskState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, taskState := range taskStates {
+		s.TasksToFail = append(s.TasksToFail, taskState.TaskGuid)
+	}
+}
+
+func (s *SyncSummary) recordTasksToCancel(taskGuids []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.TasksToCancel = append(s.TasksToCancel, taskGuids...)
+}
+
+func appendProcessGuids(guids []string, fingerprints []cc_messages.CCDesiredAppFingerprint) []string {
+	for _, fingerprint := range fingerprints {
+		guids = append(guids, fingerprint.ProcessGuid)
+	}
+	return guids
+}
+
+func errorType(err error) string {
+	if builderErr, ok := err.(recipebuilder.Error); ok {
+		return builderErr.Type
+	}
+	return models.ConvertError(err).Type.String()
+}
+
+// SyncReportRecorder keeps the summaries of the most recent syncs and serves
+// them as JSON, newest first.
+type SyncReportRecorder struct {
+	capacity  int
+	summaries []*SyncSummary
+	lock      sync.RWMutex
+}
+
+func NewSyncReportRecorder(capacity int) *SyncReportRecorder {
+	return &SyncReportRecorder{
+		capacity: capacity,
+	}
+}
+
+func (r *SyncReportRecorder) Record(summary *SyncSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.capacity <= 0 {
+		return
+	}
+
+	r.summaries = append([]*SyncSummary{summary}, r.summaries...)
+	if len(r.summaries) > r.capacity {
+		r.summaries = r.summaries[:r.capacity]
+	}
+}
+
+func (r *SyncReportRecorder) Summaries() []*SyncSummary {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	summaries := make([]*SyncSummary, len(r.summaries))
+	copy(summaries, r.summaries)
+	return summaries
+}
+
+func (r *SyncReportRecorder) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	summaries := r.Summaries()
+
+	for _, summary := range summaries {
+		summary.lock.Lock()
+		defer summary.lock.Unlock()
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(summaries)
+}
+
+func recordFingerprints(
+	cancel <-chan struct{},
+	source <-chan []cc_messages.CCDesiredAppFingerprint,
+	record func([]cc_messages.CCDesiredAppFingerprint),
+) <-chan []cc_messages.CCDesiredAppFingerprint {
+	dest := make(chan []cc_messages.CCDesiredAppFingerprint)
+
+	go func() {
+		defer close(dest)
+
+		for {
+			select {
+			case <-cancel:
+				return
+			case batch, open := <-source:
+				if !open {
+					return
+				}
+
+				record(batch)
+
+				select {
+				case dest <- batch:
+				case <-cancel:
+					return
+				}
+			}
+		}
+	}()
+
+	return dest
+}
+
+func recordTaskStates(
+	cancel <-chan struct{},
+	source <-chan []cc_messages.CCTaskState,
+	record func([]cc_messages.CCTaskState),
+) <-chan []cc_messages.CCTaskState {
+	dest := make(chan []cc_messages.CCTaskState)
+
+	go func() {
+		defer close(dest)
+
+		for {
+			select {
+			case <-cancel:
+				return
+			case batch, open := <-source:
+				if !open {
+					return
+				}
+
+				record(batch)
+
+				select {
+				case dest <- batch:
+				case <-cancel:
+					return
+				}
+			}
+		}
+	}()
+
+	return dest
+}
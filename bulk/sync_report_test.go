@@ -0,0 +1,68 @@
+package bulk_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/nsync/bulk"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SyncReportRecorder", func() {
+	var recorder *bulk.SyncReportRecorder
+
+	BeforeEach(func() {
+		recorder = bulk.NewSyncReportRecorder(2)
+	})
+
+	It("keeps the most recent summaries, newest first", func() {
+		recorder.Record(&bulk.SyncSummary{Kind: "first"})
+		recorder.Record(&bulk.SyncSummary{Kind: "second"})
+		recorder.Record(&bulk.SyncSummary{Kind: "third"})
+
+		summaries := recorder.Summaries()
+		Expect(summaries).To(HaveLen(2))
+		Expect(summaries[0].Kind).To(Equal("third"))
+		Expect(summaries[1].Kind).To(Equal("second"))
+	})
+
+	It("serves the summaries as json", func() {
+		recorder.Record(&bulk.SyncSummary{
+			Kind:            bulk.LRPSyncKind,
+			MissingGuids:    []string{"missing-guid"},
+			FailuresByType:  map[string]int{"UnknownError": 1},
+			FreshnessBumped: true,
+		})
+
+		req, err := http.NewRequest("GET", "/sync-reports", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := httptest.NewRecorder()
+		recorder.ServeHTTP(resp, req)
+
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var summaries []map[string]interface{}
+		err = json.Unmarshal(resp.Body.Bytes(), &summaries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summaries).To(HaveLen(1))
+		Expect(summaries[0]["kind"]).To(Equal("lrps"))
+		Expect(summaries[0]["missing_guids"]).To(ConsistOf("missing-guid"))
+		Expect(summaries[0]["failures_by_type"]).To(Equal(map[string]interface{}{"UnknownError": float64(1)}))
+		Expect(summaries[0]["freshness_bumped"]).To(BeTrue())
+	})
+
+	Context("when the capacity is zero", func() {
+		BeforeEach(func() {
+			recorder = bulk.NewSyncReportRecorder(0)
+		})
+
+		It("records nothing", func() {
+			recorder.Record(&bulk.SyncSummary{Kind: "first"})
+			Expect(recorder.Summaries()).To(BeEmpty())
+		})
+	})
+})
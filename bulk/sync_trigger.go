@@ -0,0 +1,86 @@
+package bulk
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type Triggerable interface {
+	Trigger() bool
+}
+
+type SyncTriggerHandler struct {
+	logger     lager.Logger
+	token      string
+	processors map[string]Triggerable
+}
+
+func NewSyncTriggerHandler(logger lager.Logger, token string, lrpProcessor, taskProcessor Triggerable) *SyncTriggerHandler {
+	return &SyncTriggerHandler{
+		logger: logger,
+		token:  token,
+		processors: map[string]Triggerable{
+			LRPSyncKind:  lrpProcessor,
+			TaskSyncKind: taskProcessor,
+		},
+	}
+}
+
+func (h *SyncTriggerHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	kind := req.FormValue("kind")
+
+	logger := h.logger.Session("trigger-sync", lager.Data{
+		"kind":   kind,
+		"method": req.Method,
+	})
+
+	if req.Method != "POST" {
+		logger.Error("invalid-method", nil)
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.authorized(req) {
+		logger.Error("unauthorized", nil)
+		resp.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	kinds := []string{LRPSyncKind, TaskSyncKind}
+	if kind != "" {
+		if _, ok := h.processors[kind]; !ok {
+			logger.Error("unknown-sync-kind", nil)
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		kinds = []string{kind}
+	}
+
+	result := map[string]string{}
+	for _, k := range kinds {
+		if h.processors[k].Trigger() {
+			result[k] = "triggered"
+		} else {
+			result[k] = "already-pending"
+		}
+	}
+
+	logger.Info("triggered", lager.Data{"result": result})
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(resp).Encode(result)
+}
+
+func (h *SyncTriggerHandler) authorized(req *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+
+	expected := "Bearer " + h.token
+	actual := req.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
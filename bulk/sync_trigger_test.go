@@ -0,0 +1,121 @@
+package bulk_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/bulk"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeTriggerable struct {
+	triggered int
+	pending   bool
+}
+
+func (f *fakeTriggerable) Trigger() bool {
+	f.triggered++
+	return !f.pending
+}
+
+var _ = Describe("SyncTriggerHandler", func() {
+	var (
+		lrpProcessor  *fakeTriggerable
+		taskProcessor *fakeTriggerable
+		handler       *bulk.SyncTriggerHandler
+
+		method        string
+		url           string
+		authorization string
+		resp          *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		lrpProcessor = &fakeTriggerable{}
+		taskProcessor = &fakeTriggerable{}
+		handler = bulk.NewSyncTriggerHandler(lagertest.NewTestLogger("test"), "secret", lrpProcessor, taskProcessor)
+
+		method = "POST"
+		url = "/sync"
+		authorization = "Bearer secret"
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		req, err := http.NewRequest(method, url, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", authorization)
+
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("triggers both the lrp and task syncs", func() {
+		Expect(resp.Code).To(Equal(http.StatusAccepted))
+		Expect(lrpProcessor.triggered).To(Equal(1))
+		Expect(taskProcessor.triggered).To(Equal(1))
+
+		var result map[string]string
+		Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+		Expect(result).To(Equal(map[string]string{"lrps": "triggered", "tasks": "triggered"}))
+	})
+
+	Context("when a kind is given", func() {
+		BeforeEach(func() {
+			url = "/sync?kind=tasks"
+		})
+
+		It("only triggers that sync", func() {
+			Expect(resp.Code).To(Equal(http.StatusAccepted))
+			Expect(lrpProcessor.triggered).To(Equal(0))
+			Expect(taskProcessor.triggered).To(Equal(1))
+		})
+	})
+
+	Context("when the kind is unknown", func() {
+		BeforeEach(func() {
+			url = "/sync?kind=bogus"
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			Expect(lrpProcessor.triggered).To(Equal(0))
+			Expect(taskProcessor.triggered).To(Equal(0))
+		})
+	})
+
+	Context("when a sync is already pending", func() {
+		BeforeEach(func() {
+			lrpProcessor.pending = true
+		})
+
+		It("reports it", func() {
+			var result map[string]string
+			Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+			Expect(result["lrps"]).To(Equal("already-pending"))
+		})
+	})
+
+	Context("when the token is wrong", func() {
+		BeforeEach(func() {
+			authorization = "Bearer wrong"
+		})
+
+		It("responds with 401 Unauthorized", func() {
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			Expect(lrpProcessor.triggered).To(Equal(0))
+		})
+	})
+
+	Context("when the method is not POST", func() {
+		BeforeEach(func() {
+			method = "GET"
+		})
+
+		It("responds with 405 Method Not Allowed", func() {
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
@@ -13,13 +15,21 @@ import (
 //go:generate counterfeiter -o fakes/fake_task_client.go . TaskClient
 
 type TaskClient interface {
-	FailTask(logger lager.Logger, taskState *cc_messages.CCTaskState, httpClient *http.Client) error
+	FailTask(logger lager.Logger, cancel <-chan struct{}, taskState *cc_messages.CCTaskState, httpClient *http.Client) error
 }
 
+// CCTaskClient reports tasks as failed to their completion callback. Only
+// callbacks on the host of BaseURI are authenticated. The http client passed
+// to FailTask may present CC's client certificate on every TLS handshake, so
+// the other callbacks are sent with CallbackHTTPClient when it is set, which
+// must not carry any CC credentials.
 type CCTaskClient struct {
+	BaseURI            string
+	Authenticator      Authenticator
+	CallbackHTTPClient *http.Client
 }
 
-func (tc *CCTaskClient) FailTask(logger lager.Logger, taskState *cc_messages.CCTaskState, httpClient *http.Client) error {
+func (tc *CCTaskClient) FailTask(logger lager.Logger, cancel <-chan struct{}, taskState *cc_messages.CCTaskState, httpClient *http.Client) error {
 	taskGuid := taskState.TaskGuid
 	payload, err := json.Marshal(cc_messages.TaskFailResponseForCC{
 		TaskGuid:      taskGuid,
@@ -36,13 +46,38 @@ func (tc *CCTaskClient) FailTask(logger lager.Logger, taskState *cc_messages.CCT
 		return err
 	}
 
+	ctx, stop := cancelContext(cancel)
+	defer stop()
+	req = req.WithContext(ctx)
+
 	req.Header.Set("Content-Type", "application/json")
+
+	authenticated := tc.shouldAuthenticate(req.URL)
+	if authenticated {
+		err = tc.Authenticator.Authenticate(logger, req)
+		if err != nil {
+			logger.Error("failed-to-authenticate-request", err, lager.Data{"task_guid": taskGuid})
+			return err
+		}
+	}
+
+	if !authenticated && tc.CallbackHTTPClient != nil {
+		httpClient = tc.CallbackHTTPClient
+	}
+
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized && authenticated {
+		if invalidator, ok := tc.Authenticator.(tokenInvalidator); ok {
+			logger.Info("invalidating-rejected-token", lager.Data{"task_guid": taskGuid})
+			invalidator.InvalidateToken()
+		}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("bad-response-from-cc", err, lager.Data{"task_guid": taskGuid})
 		return errors.New("received bad response from CC ")
@@ -50,3 +85,27 @@ func (tc *CCTaskClient) FailTask(logger lager.Logger, taskState *cc_messages.CCT
 
 	return nil
 }
+
+func (tc *CCTaskClient) shouldAuthenticate(callbackURL *url.URL) bool {
+	if tc.Authenticator == nil {
+		return false
+	}
+
+	// Callback URLs that embed their own credentials are sent as CC gave them.
+	if callbackURL.User != nil {
+		return false
+	}
+
+	baseURL, err := url.Parse(tc.BaseURI)
+	if err != nil || !strings.EqualFold(baseURL.Hostname(), callbackURL.Hostname()) {
+		return false
+	}
+
+	// A client certificate can only be presented over TLS; plain http
+	// callbacks are sent without one, as they always have been.
+	if _, ok := tc.Authenticator.(clientCertificateProvider); ok && callbackURL.Scheme != "https" {
+		return false
+	}
+
+	return true
+}
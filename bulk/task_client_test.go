@@ -1,12 +1,19 @@
 package bulk_test
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nsync/bulk"
+	"code.cloudfoundry.org/nsync/bulk/fakes"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -21,12 +28,14 @@ var _ = Describe("TaskClient", func() {
 		httpClient *http.Client
 		taskGuid   string
 		taskState  *cc_messages.CCTaskState
+		cancel     chan struct{}
 	)
 
 	BeforeEach(func() {
 		fakeCC = ghttp.NewServer()
 		logger = lagertest.NewTestLogger("test")
 		httpClient = &http.Client{Timeout: time.Second}
+		cancel = make(chan struct{})
 
 		taskClient = &bulk.CCTaskClient{}
 		taskGuid = "task-guid-6000"
@@ -54,7 +63,7 @@ var _ = Describe("TaskClient", func() {
 			})
 
 			It("sends a fail task request to CC", func() {
-				err := taskClient.FailTask(logger, taskState, httpClient)
+				err := taskClient.FailTask(logger, cancel, taskState, httpClient)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
@@ -67,7 +76,7 @@ var _ = Describe("TaskClient", func() {
 			})
 
 			It("returns an error", func() {
-				err := taskClient.FailTask(logger, taskState, httpClient)
+				err := taskClient.FailTask(logger, cancel, taskState, httpClient)
 				Expect(err).To(HaveOccurred())
 			})
 		})
@@ -78,9 +87,229 @@ var _ = Describe("TaskClient", func() {
 			})
 
 			It("returns an error", func() {
-				err := taskClient.FailTask(logger, taskState, httpClient)
+				err := taskClient.FailTask(logger, cancel, taskState, httpClient)
 				Expect(err).To(HaveOccurred())
 			})
 		})
+
+		Context("when cancelled while waiting for CC", func() {
+			var release chan struct{}
+
+			BeforeEach(func() {
+				release = make(chan struct{})
+				httpClient = &http.Client{Timeout: time.Minute}
+
+				fakeCC.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+					<-release
+				})
+			})
+
+			AfterEach(func() {
+				close(release)
+			})
+
+			It("abandons the request", func() {
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- taskClient.FailTask(logger, cancel, taskState, httpClient)
+				}()
+
+				Eventually(fakeCC.ReceivedRequests).Should(HaveLen(1))
+				close(cancel)
+
+				Eventually(errCh).Should(Receive(HaveOccurred()))
+			})
+		})
+
+		Context("with an authenticator", func() {
+			var authenticator *fakes.FakeAuthenticator
+
+			BeforeEach(func() {
+				authenticator = new(fakes.FakeAuthenticator)
+				authenticator.AuthenticateStub = func(logger lager.Logger, req *http.Request) error {
+					req.Header.Set("Authorization", "bearer some-token")
+					return nil
+				}
+				taskClient.BaseURI = fakeCC.URL()
+				taskClient.Authenticator = authenticator
+
+				taskState.CompletionCallbackUrl = fmt.Sprintf("%s/internal/v3/tasks/%s/completed", fakeCC.URL(), taskGuid)
+			})
+
+			Context("when the callback url has no credentials", func() {
+				BeforeEach(func() {
+					fakeCC.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", fmt.Sprintf("/internal/v3/tasks/%s/completed", taskGuid)),
+							ghttp.VerifyHeaderKV("Authorization", "bearer some-token"),
+							ghttp.RespondWith(200, "{}"),
+						),
+					)
+				})
+
+				It("authenticates the request", func() {
+					err := taskClient.FailTask(logger, cancel, taskState, httpClient)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(authenticator.AuthenticateCallCount()).To(Equal(1))
+					Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+				})
+			})
+
+			Context("when the callback url carries its own credentials", func() {
+				BeforeEach(func() {
+					taskState.CompletionCallbackUrl = fmt.Sprintf("http://utako:luan@%s/internal/v3/tasks/%s/completed", fakeCC.Addr(), taskGuid)
+
+					fakeCC.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyBasicAuth("utako", "luan"),
+							ghttp.RespondWith(200, "{}"),
+						),
+					)
+				})
+
+				It("uses the credentials from the url", func() {
+					err := taskClient.FailTask(logger, cancel, taskState, httpClient)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(authenticator.AuthenticateCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the callback url is not on the CC host", func() {
+				BeforeEach(func() {
+					taskState.CompletionCallbackUrl = fmt.Sprintf("http://localhost:%s/internal/v3/tasks/%s/completed", serverPort(fakeCC), taskGuid)
+
+					fakeCC.AppendHandlers(
+						ghttp.CombineHandlers(
+							func(w http.ResponseWriter, req *http.Request) {
+								Expect(req.Header.Get("Authorization")).To(BeEmpty())
+							},
+							ghttp.RespondWith(200, "{}"),
+						),
+					)
+				})
+
+				It("does not authenticate the request", func() {
+					err := taskClient.FailTask(logger, cancel, taskState, httpClient)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(authenticator.AuthenticateCallCount()).To(Equal(0))
+					Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+				})
+			})
+
+			Context("when authenticating fails", func() {
+				BeforeEach(func() {
+					authenticator.AuthenticateStub = nil
+					authenticator.AuthenticateReturns(errors.New("no token for you"))
+				})
+
+				It("returns the error without contacting CC", func() {
+					err := taskClient.FailTask(logger, cancel, taskState, httpClient)
+					Expect(err).To(MatchError("no token for you"))
+
+					Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when CC rejects the token", func() {
+			var fakeUAA *ghttp.Server
+
+			BeforeEach(func() {
+				fakeUAA = ghttp.NewServer()
+				fakeUAA.AppendHandlers(
+					ghttp.RespondWithJSONEncoded(200, map[string]interface{}{"access_token": "revoked-token", "expires_in": 600}),
+					ghttp.RespondWithJSONEncoded(200, map[string]interface{}{"access_token": "fresh-token", "expires_in": 600}),
+				)
+
+				taskClient.BaseURI = fakeCC.URL()
+				taskClient.Authenticator = bulk.NewUAATokenAuthenticator(
+					fakeUAA.URL()+"/oauth/token",
+					"nsync",
+					"secret",
+					&http.Client{Timeout: time.Second},
+					fakeclock.NewFakeClock(time.Now()),
+				)
+
+				taskState.CompletionCallbackUrl = fmt.Sprintf("%s/internal/v3/tasks/%s/completed", fakeCC.URL(), taskGuid)
+				fakeCC.AppendHandlers(
+					ghttp.RespondWith(401, ""),
+					ghttp.CombineHandlers(
+						ghttp.VerifyHeaderKV("Authorization", "bearer fresh-token"),
+						ghttp.RespondWith(200, "{}"),
+					),
+				)
+			})
+
+			AfterEach(func() {
+				fakeUAA.Close()
+			})
+
+			It("uses a new token for the next callback", func() {
+				err := taskClient.FailTask(logger, cancel, taskState, httpClient)
+				Expect(err).To(HaveOccurred())
+
+				err = taskClient.FailTask(logger, cancel, taskState, httpClient)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeUAA.ReceivedRequests()).To(HaveLen(2))
+			})
+		})
+
+		Context("with a client certificate authenticator", func() {
+			var authenticator *bulk.ClientCertAuthenticator
+
+			BeforeEach(func() {
+				var err error
+				authenticator, err = bulk.NewClientCertAuthenticator("../fixtures/certs/client.crt", "../fixtures/certs/client.key")
+				Expect(err).NotTo(HaveOccurred())
+
+				taskClient.BaseURI = fakeCC.URL()
+				taskClient.Authenticator = authenticator
+
+				taskState.CompletionCallbackUrl = fmt.Sprintf("%s/internal/v3/tasks/%s/completed", fakeCC.URL(), taskGuid)
+				fakeCC.AppendHandlers(ghttp.RespondWith(200, "{}"))
+			})
+
+			It("still sends plain http callbacks", func() {
+				err := taskClient.FailTask(logger, cancel, taskState, httpClient)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+			})
+
+			It("does not present the certificate to callbacks on another host", func() {
+				serverCert, err := tls.LoadX509KeyPair("../fixtures/certs/server.crt", "../fixtures/certs/server.key")
+				Expect(err).NotTo(HaveOccurred())
+
+				peerCertificates := -1
+				callbackServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					peerCertificates = len(r.TLS.PeerCertificates)
+				}))
+				callbackServer.TLS = &tls.Config{
+					Certificates: []tls.Certificate{serverCert},
+					ClientAuth:   tls.RequestClientCert,
+				}
+				callbackServer.StartTLS()
+				defer callbackServer.Close()
+
+				taskClient.BaseURI = "https://cc.example.com"
+				taskClient.CallbackHTTPClient = bulk.NewCCHTTPClient(true, nil)
+				taskState.CompletionCallbackUrl = fmt.Sprintf("%s/internal/v3/tasks/%s/completed", callbackServer.URL, taskGuid)
+
+				err = taskClient.FailTask(logger, cancel, taskState, bulk.NewCCHTTPClient(true, authenticator))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(peerCertificates).To(BeZero())
+			})
+		})
 	})
 })
+
+func serverPort(server *ghttp.Server) string {
+	_, port, err := net.SplitHostPort(server.Addr())
+	Expect(err).NotTo(HaveOccurred())
+	return port
+}
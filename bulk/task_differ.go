@@ -46,7 +46,10 @@ func (t *taskDiffer) Diff(logger lager.Logger, ccTasks <-chan []cc_messages.CCTa
 				if !open {
 					guids := filterTasksToCancel(logger, tasksToCancel)
 					if len(guids) > 0 {
-						t.tasksToCancel <- guids
+						select {
+						case t.tasksToCancel <- guids:
+						case <-cancelCh:
+						}
 					}
 
 					return
@@ -73,7 +76,11 @@ func (t *taskDiffer) Diff(logger lager.Logger, ccTasks <-chan []cc_messages.CCTa
 				}
 
 				if len(batchTasksToFail) > 0 {
-					t.tasksToFail <- batchTasksToFail
+					select {
+					case t.tasksToFail <- batchTasksToFail:
+					case <-cancelCh:
+						return
+					}
 				}
 			}
 		}
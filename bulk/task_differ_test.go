@@ -247,6 +247,29 @@ var _ = Describe("TaskDiffer", func() {
 	})
 
 	Context("canceling", func() {
+		Context("when it is waiting to send tasks to fail", func() {
+			BeforeEach(func() {
+				ccTasks = make(chan []cc_messages.CCTaskState, 2)
+				ccTasks <- []cc_messages.CCTaskState{
+					{TaskGuid: "task-guid-1", State: cc_messages.TaskStateRunning},
+				}
+				ccTasks <- []cc_messages.CCTaskState{
+					{TaskGuid: "task-guid-2", State: cc_messages.TaskStateRunning},
+				}
+			})
+
+			It("closes the output channels", func() {
+				differ.Diff(logger, ccTasks, cancelCh)
+
+				Eventually(func() int { return len(differ.TasksToFail()) }).Should(Equal(1))
+				Eventually(func() int { return len(ccTasks) }).Should(Equal(0))
+				close(cancelCh)
+
+				Eventually(differ.TasksToFail()).Should(BeClosed())
+				Eventually(differ.TasksToCancel()).Should(BeClosed())
+			})
+		})
+
 		Context("when it is receiving tasks", func() {
 			BeforeEach(func() {
 				ccTasks <- []cc_messages.CCTaskState{
@@ -264,6 +287,24 @@ var _ = Describe("TaskDiffer", func() {
 			})
 		})
 
+		Context("when it is blocked sending tasks to fail", func() {
+			It("gives up the send and closes the output channels", func() {
+				differ.Diff(logger, ccTasks, cancelCh)
+
+				ccTasks <- []cc_messages.CCTaskState{{TaskGuid: "task-guid-1", State: cc_messages.TaskStateRunning}}
+				ccTasks <- []cc_messages.CCTaskState{{TaskGuid: "task-guid-2", State: cc_messages.TaskStateRunning}}
+				Eventually(func() int { return len(ccTasks) }).Should(BeZero())
+
+				close(cancelCh)
+
+				Eventually(differ.TasksToFail()).Should(Receive(ConsistOf(
+					cc_messages.CCTaskState{TaskGuid: "task-guid-1", State: cc_messages.TaskStateRunning},
+				)))
+				Eventually(differ.TasksToFail()).Should(BeClosed())
+				Eventually(differ.TasksToCancel()).Should(BeClosed())
+			})
+		})
+
 		Context("when it is not receiving tasks", func() {
 			It("closes the output channels", func() {
 				close(cancelCh)
@@ -23,6 +23,8 @@ type TaskProcessor struct {
 	httpClient         *http.Client
 	logger             lager.Logger
 	fetcher            Fetcher
+	syncReports        *SyncReportRecorder
+	triggers           chan struct{}
 	clock              clock.Clock
 }
 
@@ -34,8 +36,9 @@ func NewTaskProcessor(
 	domainTTL time.Duration,
 	failTaskPoolSize int,
 	cancelTaskPoolSize int,
-	skipCertVerify bool,
+	httpClient *http.Client,
 	fetcher Fetcher,
+	syncReports *SyncReportRecorder,
 	clock clock.Clock) *TaskProcessor {
 	return &TaskProcessor{
 		bbsClient:          bbsClient,
@@ -44,9 +47,11 @@ func NewTaskProcessor(
 		domainTTL:          domainTTL,
 		failTaskPoolSize:   failTaskPoolSize,
 		cancelTaskPoolSize: cancelTaskPoolSize,
-		httpClient:         initializeHttpClient(skipCertVerify),
+		httpClient:         httpClient,
 		logger:             logger,
 		fetcher:            fetcher,
+		syncReports:        syncReports,
+		triggers:           make(chan struct{}, 1),
 		clock:              clock,
 	}
 }
@@ -68,16 +73,37 @@ func (t *TaskProcessor) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 		case <-timer.C():
 			stop = t.sync(signals)
 			timer.Reset(t.pollingInterval)
+		case <-t.triggers:
+			t.logger.Info("sync-triggered")
+			stop = t.sync(signals)
+			timer.Reset(t.pollingInterval)
 		}
 	}
 }
 
+// Trigger requests an immediate task sync, as LRPProcessor.Trigger does for LRPs.
+func (t *TaskProcessor) Trigger() bool {
+	select {
+	case t.triggers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
 func (t *TaskProcessor) sync(signals <-chan os.Signal) bool {
 	logger := t.logger.Session("sync")
 	logger.Info("starting")
 
+	summary := newSyncSummary(TaskSyncKind, t.clock.Now())
+	defer func() {
+		summary.finish(t.clock.Now(), 0)
+		t.syncReports.Record(summary)
+	}()
+
 	existingTasks, err := t.existingTasksMap()
 	if err != nil {
+		summary.recordFailure(err)
 		return false
 	}
 
@@ -90,10 +116,10 @@ func (t *TaskProcessor) sync(signals <-chan os.Signal) bool {
 	)
 
 	taskDiffer := NewTaskDiffer(existingTasks)
-	taskDiffer.Diff(logger, taskStateCh, cancelCh)
+	taskDiffer.Diff(logger, recordTaskStates(cancelCh, taskStateCh, summary.recordTaskStates), cancelCh)
 
-	failTaskErrorCh := t.failTasks(logger, taskDiffer.TasksToFail())
-	cancelTaskErrorCh := t.cancelTasks(logger, taskDiffer.TasksToCancel())
+	failTaskErrorCh := t.failTasks(logger, cancelCh, taskDiffer.TasksToFail(), summary)
+	cancelTaskErrorCh := t.cancelTasks(logger, cancelCh, taskDiffer.TasksToCancel(), summary)
 
 	taskStateErrorCh, taskStateErrorCount := countErrors(taskStateErrorCh)
 
@@ -112,6 +138,7 @@ process_loop:
 			if err != nil {
 				bumpFreshness = false
 				logger.Error("not-bumping-freshness-because-of", err)
+				summary.recordFailure(err)
 			}
 			if !open {
 				break process_loop
@@ -119,6 +146,11 @@ process_loop:
 		case sig := <-signals:
 			logger.Info("exiting", lager.Data{"received-signal": sig})
 			close(cancelCh)
+
+			// every stage stops on cancelCh and then closes its error channel,
+			// so this returns once the whole pipeline has wound down.
+			for range errors {
+			}
 			return true
 		}
 	}
@@ -129,7 +161,12 @@ process_loop:
 	}
 
 	if bumpFreshness {
-		t.bbsClient.UpsertDomain(logger, cc_messages.RunningTaskDomain, t.domainTTL)
+		err = t.bbsClient.UpsertDomain(logger, cc_messages.RunningTaskDomain, t.domainTTL)
+		if err != nil {
+			summary.recordFailure(err)
+		} else {
+			summary.markFreshnessBumped()
+		}
 		logger.Info("bumpin-freshness")
 	}
 
@@ -154,7 +191,9 @@ func (t *TaskProcessor) existingTasksMap() (map[string]*models.Task, error) {
 
 func (t *TaskProcessor) failTasks(
 	logger lager.Logger,
+	cancel <-chan struct{},
 	tasksCh <-chan []cc_messages.CCTaskState,
+	summary *SyncSummary,
 ) <-chan error {
 
 	logger = logger.Session("fail-mismatched-tasks")
@@ -167,6 +206,9 @@ func (t *TaskProcessor) failTasks(
 			var tasksToFail []cc_messages.CCTaskState
 
 			select {
+			case <-cancel:
+				return
+
 			case selected, open := <-tasksCh:
 				if !open {
 					return
@@ -175,16 +217,24 @@ func (t *TaskProcessor) failTasks(
 				tasksToFail = selected
 			}
 
+			summary.recordTasksToFail(tasksToFail)
+
 			works := make([]func(), len(tasksToFail))
 
 			for i, taskState := range tasksToFail {
 				taskState := taskState
 
 				works[i] = func() {
-					err := t.taskClient.FailTask(logger, &taskState, t.httpClient)
+					select {
+					case <-cancel:
+						return
+					default:
+					}
+
+					err := t.taskClient.FailTask(logger, cancel, &taskState, t.httpClient)
 					if err != nil {
 						logger.Error("failed-failing-mismatched-task", err)
-						errc <- err
+						sendError(errc, err, cancel)
 					} else {
 						logger.Debug("succeeded-failing-mismatched-task", lager.Data{"task_guid": taskState.TaskGuid})
 					}
@@ -193,7 +243,7 @@ func (t *TaskProcessor) failTasks(
 
 			throttler, err := workpool.NewThrottler(t.failTaskPoolSize, works)
 			if err != nil {
-				errc <- err
+				sendError(errc, err, cancel)
 				return
 			}
 
@@ -205,7 +255,7 @@ func (t *TaskProcessor) failTasks(
 	return errc
 }
 
-func (t *TaskProcessor) cancelTasks(logger lager.Logger, tasksCh <-chan []string) <-chan error {
+func (t *TaskProcessor) cancelTasks(logger lager.Logger, cancel <-chan struct{}, tasksCh <-chan []string, summary *SyncSummary) <-chan error {
 	logger = logger.Session("cancel-mismatched-tasks")
 	errc := make(chan error, 1)
 
@@ -216,6 +266,9 @@ func (t *TaskProcessor) cancelTasks(logger lager.Logger, tasksCh <-chan []string
 			var tasksToCancel []string
 
 			select {
+			case <-cancel:
+				return
+
 			case selected, open := <-tasksCh:
 				if !open {
 					return
@@ -224,16 +277,24 @@ func (t *TaskProcessor) cancelTasks(logger lager.Logger, tasksCh <-chan []string
 				tasksToCancel = selected
 			}
 
+			summary.recordTasksToCancel(tasksToCancel)
+
 			works := make([]func(), len(tasksToCancel))
 
 			for i, taskGuid := range tasksToCancel {
 				taskGuid := taskGuid
 
 				works[i] = func() {
+					select {
+					case <-cancel:
+						return
+					default:
+					}
+
 					err := t.bbsClient.CancelTask(logger, taskGuid)
 					if err != nil {
 						logger.Error("failed-canceling-mismatched-task", err)
-						errc <- err
+						sendError(errc, err, cancel)
 					} else {
 						logger.Debug("succeeded-canceling-mismatched-task", lager.Data{"task_guid": taskGuid})
 					}
@@ -242,7 +303,7 @@ func (t *TaskProcessor) cancelTasks(logger lager.Logger, tasksCh <-chan []string
 
 			throttler, err := workpool.NewThrottler(t.cancelTaskPoolSize, works)
 			if err != nil {
-				errc <- err
+				sendError(errc, err, cancel)
 				return
 			}
 
@@ -253,3 +314,12 @@ func (t *TaskProcessor) cancelTasks(logger lager.Logger, tasksCh <-chan []string
 	}()
 	return errc
 }
+
+// sendError reports err unless the sync has been cancelled, in which case
+// nobody may be left to receive it.
+func sendError(errc chan<- error, err error, cancel <-chan struct{}) {
+	select {
+	case errc <- err:
+	case <-cancel:
+	}
+}
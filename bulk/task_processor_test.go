@@ -3,7 +3,11 @@ package bulk_test
 import (
 	"errors"
 	"net/http"
+	"os"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/bbs/fake_bbs"
@@ -33,6 +37,7 @@ var _ = Describe("Task Processor", func() {
 		syncDuration    time.Duration
 		pollingInterval time.Duration
 		clock           *fakeclock.FakeClock
+		syncReports     *bulk.SyncReportRecorder
 
 		logger *lagertest.TestLogger
 	)
@@ -65,6 +70,7 @@ var _ = Describe("Task Processor", func() {
 		}
 
 		pollingInterval = 500 * time.Millisecond
+		syncReports = bulk.NewSyncReportRecorder(5)
 		processor = bulk.NewTaskProcessor(
 			logger,
 			bbsClient,
@@ -73,8 +79,9 @@ var _ = Describe("Task Processor", func() {
 			time.Second,
 			50,
 			50,
-			false,
+			&http.Client{},
 			fetcher,
+			syncReports,
 			clock,
 		)
 	})
@@ -96,7 +103,7 @@ var _ = Describe("Task Processor", func() {
 
 		It("fails the task", func() {
 			Eventually(taskClient.FailTaskCallCount).Should(Equal(1))
-			_, taskState, _ := taskClient.FailTaskArgsForCall(0)
+			_, _, taskState, _ := taskClient.FailTaskArgsForCall(0)
 			Expect(taskState.TaskGuid).Should(Equal("task-guid-1"))
 			Expect(taskState.CompletionCallbackUrl).Should(Equal("asdf"))
 		})
@@ -105,6 +112,16 @@ var _ = Describe("Task Processor", func() {
 			Eventually(bbsClient.UpsertDomainCallCount).Should(Equal(1))
 		})
 
+		It("records a summary of the sync", func() {
+			Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+			summary := syncReports.Summaries()[0]
+			Expect(summary.Kind).To(Equal(bulk.TaskSyncKind))
+			Expect(summary.TaskStatesFetched).To(Equal(1))
+			Expect(summary.TasksToFail).To(ConsistOf("task-guid-1"))
+			Expect(summary.FreshnessBumped).To(BeTrue())
+		})
+
 		Context("and failing the task fails", func() {
 			BeforeEach(func() {
 				taskClient.FailTaskReturns(errors.New("nope"))
@@ -113,6 +130,103 @@ var _ = Describe("Task Processor", func() {
 			It("does not update the domain", func() {
 				Consistently(bbsClient.UpsertDomainCallCount).Should(Equal(0))
 			})
+
+			It("records the failure in the sync summary", func() {
+				Eventually(syncReports.Summaries).Should(HaveLen(1))
+
+				summary := syncReports.Summaries()[0]
+				Expect(summary.FailuresByType).To(Equal(map[string]int{"UnknownError": 1}))
+				Expect(summary.FreshnessBumped).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when a sync is triggered", func() {
+		It("syncs immediately without waiting for the polling interval", func() {
+			Eventually(bbsClient.TasksByDomainCallCount).Should(Equal(1))
+
+			Expect(processor.(*bulk.TaskProcessor).Trigger()).To(BeTrue())
+			Eventually(bbsClient.TasksByDomainCallCount).Should(Equal(2))
+			Consistently(bbsClient.TasksByDomainCallCount).Should(Equal(2))
+		})
+	})
+
+	Context("when signalled mid-sync", func() {
+		var (
+			failing     chan struct{}
+			fetchCancel <-chan struct{}
+			inFlight    int32
+			baseline    map[string]string
+		)
+
+		BeforeEach(func() {
+			failing = make(chan struct{})
+			atomic.StoreInt32(&inFlight, 0)
+			baseline = bulkGoroutines()
+
+			// more batches than the pipeline buffers, so that the differ is
+			// blocked sending while the first batch is being failed.
+			fetcher.FetchTaskStatesStub = func(
+				logger lager.Logger,
+				cancel <-chan struct{},
+				httpClient *http.Client,
+			) (<-chan []cc_messages.CCTaskState, <-chan error) {
+				fetchCancel = cancel
+				results := make(chan []cc_messages.CCTaskState, 3)
+				errorsChan := make(chan error)
+
+				for _, guid := range []string{"task-guid-1", "task-guid-2", "task-guid-3"} {
+					results <- []cc_messages.CCTaskState{
+						{TaskGuid: guid, State: cc_messages.TaskStateRunning},
+					}
+				}
+				close(results)
+				close(errorsChan)
+
+				return results, errorsChan
+			}
+
+			once := sync.Once{}
+			taskClient.FailTaskStub = func(logger lager.Logger, cancel <-chan struct{}, taskState *cc_messages.CCTaskState, httpClient *http.Client) error {
+				atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+
+				once.Do(func() { close(failing) })
+				<-cancel
+				return errors.New("cancelled")
+			}
+		})
+
+		It("cancels the in-flight callbacks and exits", func() {
+			Eventually(failing).Should(BeClosed())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+
+			Expect(taskClient.FailTaskCallCount()).To(Equal(1))
+			Expect(bbsClient.UpsertDomainCallCount()).To(Equal(0))
+		})
+
+		It("leaves no stage of the pipeline running", func() {
+			Eventually(failing).Should(BeClosed())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+
+			Expect(fetchCancel).To(BeClosed())
+			Expect(atomic.LoadInt32(&inFlight)).To(BeZero())
+			Consistently(taskClient.FailTaskCallCount).Should(Equal(1))
+
+			leaked := func() []string {
+				ids := []string{}
+				for id, stack := range bulkGoroutines() {
+					if _, ok := baseline[id]; !ok {
+						ids = append(ids, stack)
+					}
+				}
+				return ids
+			}
+			Eventually(leaked).Should(BeEmpty())
 		})
 	})
 
@@ -149,7 +263,7 @@ var _ = Describe("Task Processor", func() {
 
 		It("fails the task", func() {
 			Eventually(taskClient.FailTaskCallCount).Should(Equal(1))
-			_, taskState, _ := taskClient.FailTaskArgsForCall(0)
+			_, _, taskState, _ := taskClient.FailTaskArgsForCall(0)
 			Expect(taskState.TaskGuid).Should(Equal("task-guid-1"))
 			Expect(taskState.CompletionCallbackUrl).Should(Equal("asdf"))
 		})
@@ -304,3 +418,29 @@ var _ = Describe("Task Processor", func() {
 		})
 	})
 })
+
+// bulkGoroutines snapshots the goroutines running code of the bulk package,
+// keyed by goroutine id, so that a spec can tell which ones it left behind.
+func bulkGoroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	goroutines := map[string]string{}
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		if !strings.Contains(stack, "code.cloudfoundry.org/nsync/bulk.") {
+			continue
+		}
+		fields := strings.Fields(stack)
+		if len(fields) > 1 {
+			goroutines[fields[1]] = stack
+		}
+	}
+	return goroutines
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"github.com/nu7hatch/gouuid"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 	"github.com/tedsuo/ifrit/sigmon"
 
 	"code.cloudfoundry.org/nsync"
@@ -36,6 +38,11 @@ var configPath = flag.String(
 
 const (
 	dropsondeOrigin = "nsync_bulker"
+	syncReportsPath = "/sync-reports"
+	syncTriggerPath = "/sync"
+
+	replayJournalCommand = "replay-journal"
+	revertJournalCommand = "revert-journal"
 )
 
 func main() {
@@ -52,20 +59,36 @@ func main() {
 
 	logger, reconfigurableSink := lagerflags.NewFromConfig("nsync-bulker", bulkerConfig.LagerConfig)
 
+	if flag.NArg() > 0 {
+		os.Exit(runJournalCommand(logger, bulkerConfig, flag.Args()))
+	}
+
 	initializeDropsonde(logger, bulkerConfig)
 	cfhttp.Initialize(time.Duration(bulkerConfig.CommunicationTimeout))
 
-	serviceClient := initializeServiceClient(logger, bulkerConfig)
-	uuid, err := uuid.NewV4()
+	lockMaintainer := initializeLockMaintainer(logger, bulkerConfig)
+
+	err = bulkerConfig.DockerImagePolicy.Validate()
 	if err != nil {
-		logger.Fatal("Couldn't generate uuid", err)
+		logger.Fatal("invalid-docker-image-policy", err)
+	}
+
+	healthCheckConfig := recipebuilder.HealthCheckConfig{
+		Interval:       time.Duration(bulkerConfig.HealthCheckInterval),
+		Timeout:        time.Duration(bulkerConfig.HealthCheckTimeout),
+		MonitorTimeout: time.Duration(bulkerConfig.HealthCheckMonitorTimeout),
+	}
+	err = healthCheckConfig.Validate()
+	if err != nil {
+		logger.Fatal("invalid-health-check-config", err)
 	}
-	lockMaintainer := serviceClient.NewNsyncBulkerLockRunner(logger, uuid.String(), time.Duration(bulkerConfig.LockRetryInterval), time.Duration(bulkerConfig.LockTTL))
 
 	dockerRecipeBuilderConfig := recipebuilder.Config{
 		Lifecycles:    lifecycles,
 		FileServerURL: bulkerConfig.FileServerUrl,
 		KeyFactory:    keys.RSAKeyPairFactory,
+		ImagePolicy:   bulkerConfig.DockerImagePolicy,
+		HealthCheck:   healthCheckConfig,
 	}
 
 	buildpackRecipeBuilderConfig := recipebuilder.Config{
@@ -73,13 +96,27 @@ func main() {
 		FileServerURL:        bulkerConfig.FileServerUrl,
 		KeyFactory:           keys.RSAKeyPairFactory,
 		PrivilegedContainers: bulkerConfig.PrivilegedContainers,
+		HealthCheck:          healthCheckConfig,
 	}
 
-	recipeBuilders := map[string]recipebuilder.RecipeBuilder{
-		"buildpack": recipebuilder.NewBuildpackRecipeBuilder(logger, buildpackRecipeBuilderConfig),
-		"docker":    recipebuilder.NewDockerRecipeBuilder(logger, dockerRecipeBuilderConfig),
+	if bulkerConfig.PinDockerImageDigests {
+		dockerRecipeBuilderConfig.DigestResolver = recipebuilder.NewCachingDigestResolver(
+			recipebuilder.NewRegistryDigestResolver(cfhttp.NewClient(), bulkerConfig.InsecureDockerRegistries),
+			time.Duration(bulkerConfig.DockerDigestCacheTTL),
+			clock.NewClock(),
+		)
 	}
 
+	recipeBuilders := recipebuilder.NewDefaultRegistry(
+		recipebuilder.NewBuildpackRecipeBuilder(logger, buildpackRecipeBuilderConfig),
+		recipebuilder.NewDockerRecipeBuilder(logger, dockerRecipeBuilderConfig),
+	)
+
+	syncReports := bulk.NewSyncReportRecorder(bulkerConfig.SyncReportHistorySize)
+
+	ccAuthenticator := initializeCCAuthenticator(logger, bulkerConfig)
+	ccHTTPClient := bulk.NewCCHTTPClient(bulkerConfig.SkipCertVerify, ccAuthenticator)
+
 	lrpRunner := bulk.NewLRPProcessor(
 		logger,
 		initializeBBSClient(logger, bulkerConfig),
@@ -87,32 +124,52 @@ func main() {
 		time.Duration(bulkerConfig.DomainTTL),
 		bulkerConfig.CCBulkBatchSize,
 		bulkerConfig.BBSUpdateLRPWorkers,
-		bulkerConfig.SkipCertVerify,
+		bulkerConfig.BBSDeleteLRPWorkers,
+		bulkerConfig.DryRun,
+		bulkerConfig.MaxDeletionsPerSync,
+		bulkerConfig.MaxDeletionPercentage,
+		bulkerConfig.MaxRecipeRecreatesPerSync,
+		ccHTTPClient,
 		&bulk.CCFetcher{
-			BaseURI:   bulkerConfig.CCBaseUrl,
-			BatchSize: int(bulkerConfig.CCBulkBatchSize),
-			Username:  bulkerConfig.CCUsername,
-			Password:  bulkerConfig.CCPassword,
+			BaseURI:       bulkerConfig.CCBaseUrl,
+			BatchSize:     int(bulkerConfig.CCBulkBatchSize),
+			Authenticator: ccAuthenticator,
+
+			MaxRetries:     bulkerConfig.CCRequestMaxRetries,
+			RetryBaseDelay: time.Duration(bulkerConfig.CCRequestRetryBaseDelay),
+			RetryMaxDelay:  time.Duration(bulkerConfig.CCRequestRetryMaxDelay),
+			Clock:          clock.NewClock(),
 		},
 		recipeBuilders,
+		syncReports,
+		initializeJournal(logger, bulkerConfig),
 		clock.NewClock(),
 	)
 
 	taskRunner := bulk.NewTaskProcessor(
 		logger,
 		initializeBBSClient(logger, bulkerConfig),
-		&bulk.CCTaskClient{},
+		&bulk.CCTaskClient{
+			BaseURI:            bulkerConfig.CCBaseUrl,
+			Authenticator:      ccAuthenticator,
+			CallbackHTTPClient: bulk.NewCCHTTPClient(bulkerConfig.SkipCertVerify, nil),
+		},
 		time.Duration(bulkerConfig.CCPollingInterval),
 		time.Duration(bulkerConfig.DomainTTL),
 		bulkerConfig.BBSFailTaskPoolSize,
 		bulkerConfig.BBSCancelTaskPoolSize,
-		bulkerConfig.SkipCertVerify,
+		ccHTTPClient,
 		&bulk.CCFetcher{
-			BaseURI:   bulkerConfig.CCBaseUrl,
-			BatchSize: int(bulkerConfig.CCBulkBatchSize),
-			Username:  bulkerConfig.CCUsername,
-			Password:  bulkerConfig.CCPassword,
+			BaseURI:       bulkerConfig.CCBaseUrl,
+			BatchSize:     int(bulkerConfig.CCBulkBatchSize),
+			Authenticator: ccAuthenticator,
+
+			MaxRetries:     bulkerConfig.CCRequestMaxRetries,
+			RetryBaseDelay: time.Duration(bulkerConfig.CCRequestRetryBaseDelay),
+			RetryMaxDelay:  time.Duration(bulkerConfig.CCRequestRetryMaxDelay),
+			Clock:          clock.NewClock(),
 		},
+		syncReports,
 		clock.NewClock(),
 	)
 
@@ -123,8 +180,15 @@ func main() {
 	}
 
 	if dbgAddr := bulkerConfig.DebugServerConfig.DebugAddress; dbgAddr != "" {
+		debugHandler := http.NewServeMux()
+		debugHandler.Handle(syncReportsPath, syncReports)
+		if bulkerConfig.SyncTriggerToken != "" {
+			debugHandler.Handle(syncTriggerPath, bulk.NewSyncTriggerHandler(logger, bulkerConfig.SyncTriggerToken, lrpRunner, taskRunner))
+		}
+		debugHandler.Handle("/", debugserver.Handler(reconfigurableSink))
+
 		members = append(grouper.Members{
-			{"debug-server", debugserver.Runner(dbgAddr, reconfigurableSink)},
+			{"debug-server", http_server.New(dbgAddr, debugHandler)},
 		}, members...)
 	}
 
@@ -146,6 +210,75 @@ func main() {
 	os.Exit(0)
 }
 
+func runJournalCommand(logger lager.Logger, bulkerConfig config.BulkerConfig, args []string) int {
+	command := args[0]
+	if (command != replayJournalCommand && command != revertJournalCommand) || len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: nsync-bulker -configPath=<path> %s|%s <journal-segment>\n", replayJournalCommand, revertJournalCommand)
+		return 2
+	}
+
+	logger = logger.Session(command, lager.Data{"segment": args[1]})
+
+	entries, err := bulk.ReadJournalSegment(args[1])
+	if err != nil {
+		logger.Error("failed-to-read-journal-segment", err)
+		return 1
+	}
+
+	// hold the bulker lock so that no bulker syncs while the journal is applied.
+	logger.Info("waiting-for-lock")
+	lockProcess := ifrit.Background(initializeLockMaintainer(logger, bulkerConfig))
+	select {
+	case <-lockProcess.Ready():
+	case err := <-lockProcess.Wait():
+		logger.Error("failed-to-acquire-lock", err)
+		return 1
+	}
+	defer func() {
+		lockProcess.Signal(os.Interrupt)
+		<-lockProcess.Wait()
+	}()
+	logger.Info("acquired-lock")
+
+	cfhttp.Initialize(time.Duration(bulkerConfig.CommunicationTimeout))
+	replayer := bulk.NewJournalReplayer(logger, initializeBBSClient(logger, bulkerConfig))
+
+	if command == revertJournalCommand {
+		err = replayer.Revert(entries)
+	} else {
+		err = replayer.Replay(entries)
+	}
+
+	if err != nil {
+		logger.Error("failed", err)
+		return 1
+	}
+
+	return 0
+}
+
+func initializeLockMaintainer(logger lager.Logger, bulkerConfig config.BulkerConfig) ifrit.Runner {
+	serviceClient := initializeServiceClient(logger, bulkerConfig)
+	uuid, err := uuid.NewV4()
+	if err != nil {
+		logger.Fatal("Couldn't generate uuid", err)
+	}
+	return serviceClient.NewNsyncBulkerLockRunner(logger, uuid.String(), time.Duration(bulkerConfig.LockRetryInterval), time.Duration(bulkerConfig.LockTTL))
+}
+
+func initializeJournal(logger lager.Logger, bulkerConfig config.BulkerConfig) *bulk.Journal {
+	if bulkerConfig.JournalDir == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(bulkerConfig.JournalDir, 0700)
+	if err != nil {
+		logger.Fatal("failed-to-create-journal-dir", err)
+	}
+
+	return bulk.NewJournal(bulkerConfig.JournalDir, bulkerConfig.JournalMaxSegments)
+}
+
 func initializeDropsonde(logger lager.Logger, bulkerConfig config.BulkerConfig) {
 	dropsondeDestination := fmt.Sprint("localhost:", bulkerConfig.DropsondePort)
 	err := dropsonde.Initialize(dropsondeDestination, dropsondeOrigin)
@@ -163,6 +296,33 @@ func initializeServiceClient(logger lager.Logger, bulkerConfig config.BulkerConf
 	return nsync.NewServiceClient(consulClient, clock.NewClock())
 }
 
+func initializeCCAuthenticator(logger lager.Logger, bulkerConfig config.BulkerConfig) bulk.Authenticator {
+	switch bulkerConfig.CCAuthType {
+	case config.CCAuthBasic:
+		return &bulk.BasicAuthenticator{
+			Username: bulkerConfig.CCUsername,
+			Password: bulkerConfig.CCPassword,
+		}
+	case config.CCAuthMutualTLS:
+		authenticator, err := bulk.NewClientCertAuthenticator(bulkerConfig.CCClientCert, bulkerConfig.CCClientKey)
+		if err != nil {
+			logger.Fatal("failed-to-load-cc-client-cert", err)
+		}
+		return authenticator
+	case config.CCAuthUAA:
+		return bulk.NewUAATokenAuthenticator(
+			bulkerConfig.UAATokenURL,
+			bulkerConfig.UAAClientName,
+			bulkerConfig.UAAClientSecret,
+			bulk.NewCCHTTPClient(bulkerConfig.SkipCertVerify, nil),
+			clock.NewClock(),
+		)
+	}
+
+	logger.Fatal("invalid-cc-auth-type", fmt.Errorf("unknown cc auth type %q", bulkerConfig.CCAuthType))
+	return nil
+}
+
 func initializeBBSClient(logger lager.Logger, bulkerConfig config.BulkerConfig) bbs.Client {
 	bbsURL, err := url.Parse(bulkerConfig.BBSAddress)
 	if err != nil {
@@ -39,6 +39,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 
 		bulkerLockName  = "nsync_bulker_lock"
 		pollingInterval config.Duration
+		debugAddress    string
 
 		logger lager.Logger
 	)
@@ -66,6 +67,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 
 		pollingInterval = config.Duration(500 * time.Millisecond)
 		domainTTL = config.Duration(1 * time.Second)
+		debugAddress = fmt.Sprintf("127.0.0.1:%d", 17017+GinkgoParallelNode())
 
 		var err error
 		bulkerConfigFile, err = ioutil.TempFile("", "bulker_config")
@@ -86,6 +88,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 			"docker:the/docker/lifecycle/path.tgz",
 		}
 		bulkerConfig.FileServerUrl = "http://file-server.com"
+		bulkerConfig.DebugServerConfig.DebugAddress = debugAddress
 
 		bulkerJSON, err := json.Marshal(bulkerConfig)
 		Expect(err).NotTo(HaveOccurred())
@@ -337,6 +340,34 @@ var _ = Describe("Syncing desired state with CC", func() {
 						return false
 					}).Should(BeTrue())
 				})
+
+				It("serves a summary of the sync on the debug server", func() {
+					Eventually(func() []map[string]interface{} {
+						resp, err := http.Get(fmt.Sprintf("http://%s/sync-reports", debugAddress))
+						if err != nil {
+							return nil
+						}
+						defer resp.Body.Close()
+
+						var summaries []map[string]interface{}
+						err = json.NewDecoder(resp.Body).Decode(&summaries)
+						if err != nil {
+							return nil
+						}
+
+						lrpSummaries := []map[string]interface{}{}
+						for _, summary := range summaries {
+							if summary["kind"] == "lrps" {
+								lrpSummaries = append(lrpSummaries, summary)
+							}
+						}
+						return lrpSummaries
+					}).Should(ContainElement(SatisfyAll(
+						HaveKeyWithValue("missing_guids", ConsistOf("process-guid-3")),
+						HaveKeyWithValue("stale_guids", ConsistOf("process-guid-2")),
+						HaveKeyWithValue("deleted_guids", ConsistOf("process-guid-4")),
+					)))
+				})
 			})
 
 			Context("tasks", func() {
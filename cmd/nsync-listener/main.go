@@ -1,9 +1,14 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"time"
@@ -17,6 +22,7 @@ import (
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagerflags"
 	"code.cloudfoundry.org/locket"
+	"code.cloudfoundry.org/nsync/bulk"
 	"code.cloudfoundry.org/nsync/config"
 	"code.cloudfoundry.org/nsync/handlers"
 	"code.cloudfoundry.org/runtimeschema/cc_messages/flags"
@@ -57,24 +63,73 @@ func main() {
 	initializeDropsonde(logger, listenerConfig)
 	cfhttp.Initialize(time.Duration(listenerConfig.CommunicationTimeout))
 
+	err = listenerConfig.DockerImagePolicy.Validate()
+	if err != nil {
+		logger.Fatal("invalid-docker-image-policy", err)
+	}
+
+	healthCheckConfig := recipebuilder.HealthCheckConfig{
+		Interval:       time.Duration(listenerConfig.HealthCheckInterval),
+		Timeout:        time.Duration(listenerConfig.HealthCheckTimeout),
+		MonitorTimeout: time.Duration(listenerConfig.HealthCheckMonitorTimeout),
+	}
+	err = healthCheckConfig.Validate()
+	if err != nil {
+		logger.Fatal("invalid-health-check-config", err)
+	}
+
 	buildpackRecipeBuilderConfig := recipebuilder.Config{
 		Lifecycles:           lifecycles,
 		FileServerURL:        listenerConfig.FileServerURL,
 		KeyFactory:           keys.RSAKeyPairFactory,
 		PrivilegedContainers: listenerConfig.PrivilegedContainers,
+		HealthCheck:          healthCheckConfig,
 	}
+
 	dockerRecipeBuilderConfig := recipebuilder.Config{
 		Lifecycles:    lifecycles,
 		FileServerURL: listenerConfig.FileServerURL,
 		KeyFactory:    keys.RSAKeyPairFactory,
+		ImagePolicy:   listenerConfig.DockerImagePolicy,
+		HealthCheck:   healthCheckConfig,
 	}
 
-	recipeBuilders := map[string]recipebuilder.RecipeBuilder{
-		"buildpack": recipebuilder.NewBuildpackRecipeBuilder(logger, buildpackRecipeBuilderConfig),
-		"docker":    recipebuilder.NewDockerRecipeBuilder(logger, dockerRecipeBuilderConfig),
+	if listenerConfig.PinDockerImageDigests {
+		dockerRecipeBuilderConfig.DigestResolver = recipebuilder.NewCachingDigestResolver(
+			recipebuilder.NewRegistryDigestResolver(cfhttp.NewClient(), listenerConfig.InsecureDockerRegistries),
+			time.Duration(listenerConfig.DockerDigestCacheTTL),
+			clock.NewClock(),
+		)
 	}
 
-	handler := handlers.New(logger, initializeBBSClient(logger, listenerConfig), recipeBuilders)
+	recipeBuilders := recipebuilder.NewDefaultRegistry(
+		recipebuilder.NewBuildpackRecipeBuilder(logger, buildpackRecipeBuilderConfig),
+		recipebuilder.NewDockerRecipeBuilder(logger, dockerRecipeBuilderConfig),
+	)
+
+	ccFetcher := &bulk.CCFetcher{
+		BaseURI: listenerConfig.CCBaseUrl,
+		Authenticator: &bulk.BasicAuthenticator{
+			Username: listenerConfig.CCUsername,
+			Password: listenerConfig.CCPassword,
+		},
+	}
+
+	clock := clock.NewClock()
+
+	handler := handlers.New(
+		logger,
+		initializeBBSClient(logger, listenerConfig),
+		recipeBuilders,
+		ccFetcher,
+		bulk.NewCCHTTPClient(listenerConfig.SkipCertVerify, nil),
+		listenerConfig.BulkDesireAppWorkers,
+		handlers.RestartConfig{
+			Clock:        clock,
+			PollInterval: time.Duration(listenerConfig.RestartPollInterval),
+			BatchTimeout: time.Duration(listenerConfig.RestartBatchTimeout),
+		},
+	)
 
 	consulClient, err := consuladapter.NewClientFromUrl(listenerConfig.ConsulCluster)
 	if err != nil {
@@ -90,11 +145,10 @@ func main() {
 		logger.Fatal("failed-invalid-listen-port", err)
 	}
 
-	clock := clock.NewClock()
 	registrationRunner := initializeRegistrationRunner(logger, consulClient, portNum, clock)
 
 	members := grouper.Members{
-		{"server", http_server.New(listenerConfig.ListenAddress, handler)},
+		{"server", initializeServer(logger, listenerConfig, handler)},
 		{"registration-runner", registrationRunner},
 	}
 
@@ -127,6 +181,53 @@ func initializeDropsonde(logger lager.Logger, listenerConfig config.ListenerConf
 	}
 }
 
+func initializeServer(logger lager.Logger, listenerConfig config.ListenerConfig, handler http.Handler) ifrit.Runner {
+	if listenerConfig.ServerCert == "" && listenerConfig.ServerKey == "" {
+		logger.Info("serving-without-tls")
+		return http_server.New(listenerConfig.ListenAddress, handler)
+	}
+
+	tlsConfig, err := newServerTLSConfig(listenerConfig)
+	if err != nil {
+		logger.Fatal("failed-to-configure-tls", err)
+	}
+
+	logger.Info("serving-with-mutual-tls", lager.Data{"allowed-client-common-names": listenerConfig.AllowedClientCommonNames})
+
+	authHandler := handlers.NewClientCertAuthHandler(logger, listenerConfig.AllowedClientCommonNames, handler)
+	return http_server.NewTLSServer(listenerConfig.ListenAddress, authHandler, tlsConfig)
+}
+
+func newServerTLSConfig(listenerConfig config.ListenerConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(listenerConfig.ServerCert, listenerConfig.ServerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if listenerConfig.CACert == "" {
+		return nil, errors.New("ca_cert is required to verify client certificates")
+	}
+
+	caCert, err := ioutil.ReadFile(listenerConfig.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("unable to load ca_cert")
+	}
+
+	// Clients without a certificate still complete the handshake so that
+	// ClientCertAuthHandler can log and reject them with a useful response.
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
 func initializeBBSClient(logger lager.Logger, listenerConfig config.ListenerConfig) bbs.Client {
 	bbsURL, err := url.Parse(listenerConfig.BBSAddress)
 	if err != nil {
@@ -1,6 +1,8 @@
 package main_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -244,6 +246,88 @@ var _ = Describe("Nsync Listener", func() {
 	})
 })
 
+var _ = Describe("Nsync Listener with mutual TLS", func() {
+	const exitDuration = 3 * time.Second
+
+	var (
+		nsyncURL string
+		runner   *ginkgomon.Runner
+		process  ifrit.Process
+		caPool   *x509.CertPool
+	)
+
+	stopAppWithClient := func(httpClient *http.Client) (*http.Response, error) {
+		requestGenerator := rata.NewRequestGenerator(nsyncURL, nsync.Routes)
+		req, err := requestGenerator.CreateRequest(nsync.StopAppRoute, rata.Params{"process_guid": "the-guid"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		return httpClient.Do(req)
+	}
+
+	clientWithCert := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					Certificates: certs,
+					RootCAs:      caPool,
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		nsyncPort := 8888 + GinkgoParallelNode()
+		nsyncURL = fmt.Sprintf("https://127.0.0.1:%d", nsyncPort)
+
+		caCert, err := ioutil.ReadFile("../../fixtures/certs/ca.crt")
+		Expect(err).NotTo(HaveOccurred())
+		caPool = x509.NewCertPool()
+		Expect(caPool.AppendCertsFromPEM(caCert)).To(BeTrue())
+
+		fakeBBS.RouteToHandler("POST", "/v1/desired_lrp/remove", ghttp.RespondWith(200, ``))
+
+		runner = newNSyncRunner(fmt.Sprintf("127.0.0.1:%d", nsyncPort), func(listenerConfig *config.ListenerConfig) {
+			listenerConfig.ServerCert = "../../fixtures/certs/server.crt"
+			listenerConfig.ServerKey = "../../fixtures/certs/server.key"
+			listenerConfig.CACert = "../../fixtures/certs/ca.crt"
+			listenerConfig.AllowedClientCommonNames = []string{"nsync-client"}
+		})
+		process = ginkgomon.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		ginkgomon.Interrupt(process, exitDuration)
+	})
+
+	It("serves clients presenting an allowed certificate", func() {
+		clientCert, err := tls.LoadX509KeyPair("../../fixtures/certs/client.crt", "../../fixtures/certs/client.key")
+		Expect(err).NotTo(HaveOccurred())
+
+		response, err := stopAppWithClient(clientWithCert(clientCert))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+	})
+
+	It("rejects clients without a certificate", func() {
+		response, err := stopAppWithClient(clientWithCert())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		Eventually(runner).Should(gbytes.Say("rejected-request-without-client-certificate"))
+	})
+
+	It("rejects certificates whose common name is not allowed", func() {
+		otherCert, err := tls.LoadX509KeyPair("../../fixtures/certs/other-client.crt", "../../fixtures/certs/other-client.key")
+		Expect(err).NotTo(HaveOccurred())
+
+		response, err := stopAppWithClient(clientWithCert(otherCert))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusForbidden))
+
+		Eventually(runner).Should(gbytes.Say("rejected-client-certificate-common-name"))
+	})
+})
+
 var _ = Describe("Nsync Listener Initialization", func() {
 	const exitDuration = 3 * time.Second
 
@@ -323,7 +407,7 @@ var _ = Describe("Nsync Listener Initialization", func() {
 	})
 })
 
-var newNSyncRunner = func(nsyncListenAddress string) *ginkgomon.Runner {
+var newNSyncRunner = func(nsyncListenAddress string, configure ...func(*config.ListenerConfig)) *ginkgomon.Runner {
 	configFile, err := ioutil.TempFile("", "listener_config")
 	Expect(err).NotTo(HaveOccurred())
 
@@ -338,6 +422,10 @@ var newNSyncRunner = func(nsyncListenAddress string) *ginkgomon.Runner {
 	listenerConfig.LagerConfig.LogLevel = "debug"
 	listenerConfig.ConsulCluster = consulRunner.ConsulCluster()
 
+	for _, c := range configure {
+		c(&listenerConfig)
+	}
+
 	listenerJSON, err := json.Marshal(listenerConfig)
 	Expect(err).NotTo(HaveOccurred())
 	err = ioutil.WriteFile(configFile.Name(), listenerJSON, 0644)
@@ -9,6 +9,7 @@ import (
 	"code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/lager/lagerflags"
 	"code.cloudfoundry.org/locket"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 )
 
 type Duration time.Duration
@@ -34,6 +35,12 @@ func (d Duration) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%s"`, t.String())), nil
 }
 
+const (
+	CCAuthBasic     = "basic"
+	CCAuthMutualTLS = "mutual_tls"
+	CCAuthUAA       = "uaa"
+)
+
 type BulkerConfig struct {
 	BBSAddress                 string                        `json:"bbs_api_url"`
 	BBSCACert                  string                        `json:"bbs_ca_cert"`
@@ -42,63 +49,120 @@ type BulkerConfig struct {
 	BBSClientConnectionPerHost int                           `json:"bbs_client_connection_per_host"`
 	BBSClientKey               string                        `json:"bbs_client_key"`
 	BBSClientSessionCacheSize  int                           `json:"bbs_client_cache_size"`
+	BBSDeleteLRPWorkers        int                           `json:"bbs_delete_lrp_workers"`
 	BBSFailTaskPoolSize        int                           `json:"bbs_fail_task_pool_size"`
 	BBSMaxIdleConnsPerHost     int                           `json:"bbs_max_idle_conns_per_host"`
 	BBSUpdateLRPWorkers        int                           `json:"bbs_update_lrp_workers"`
+	CCAuthType                 string                        `json:"cc_auth_type"`
 	CCBaseUrl                  string                        `json:"cc_base_url"`
 	CCBulkBatchSize            uint                          `json:"cc_bulk_batch_size"`
+	CCClientCert               string                        `json:"cc_client_cert"`
+	CCClientKey                string                        `json:"cc_client_key"`
 	CCPassword                 string                        `json:"cc_basic_auth_password"`
 	CCPollingInterval          Duration                      `json:"cc_polling_interval"`
+	CCRequestMaxRetries        int                           `json:"cc_request_max_retries"`
+	CCRequestRetryBaseDelay    Duration                      `json:"cc_request_retry_base_delay"`
+	CCRequestRetryMaxDelay     Duration                      `json:"cc_request_retry_max_delay"`
 	CCUsername                 string                        `json:"cc_basic_auth_username"`
 	CommunicationTimeout       Duration                      `json:"communication_timeout"`
 	ConsulCluster              string                        `json:"consul_cluster"`
 	DebugServerConfig          debugserver.DebugServerConfig `json:"debug_server_config"`
+	DockerDigestCacheTTL       Duration                      `json:"docker_digest_cache_ttl"`
+	DockerImagePolicy          recipebuilder.ImagePolicy     `json:"docker_image_policy"`
 	DomainTTL                  Duration                      `json:"domain_ttl"`
 	DropsondePort              int                           `json:"dropsonde_port"`
+	DryRun                     bool                          `json:"dry_run"`
 	FileServerUrl              string                        `json:"file_server_url"`
+	HealthCheckInterval        Duration                      `json:"health_check_interval"`
+	HealthCheckMonitorTimeout  Duration                      `json:"health_check_monitor_timeout"`
+	HealthCheckTimeout         Duration                      `json:"health_check_timeout"`
+	InsecureDockerRegistries   []string                      `json:"insecure_docker_registry_list"`
+	JournalDir                 string                        `json:"journal_dir"`
+	JournalMaxSegments         int                           `json:"journal_max_segments"`
 	LagerConfig                lagerflags.LagerConfig        `json:"lager_config"`
 	LockRetryInterval          Duration                      `json:"lock_retry_interval"`
 	LockTTL                    Duration                      `json:"lock_ttl"`
 	Lifecycles                 []string                      `json:"lifecycle_bundles"`
+	MaxDeletionsPerSync        int                           `json:"max_deletions_per_sync"`
+	MaxDeletionPercentage      float64                       `json:"max_deletion_percentage"`
+	MaxRecipeRecreatesPerSync  int                           `json:"max_recipe_recreates_per_sync"`
+	PinDockerImageDigests      bool                          `json:"pin_docker_image_digests"`
 	PrivilegedContainers       bool                          `json:"diego_privileged_containers"`
 	SkipCertVerify             bool                          `json:"skip_cert_verify"`
+	SyncReportHistorySize      int                           `json:"sync_report_history_size"`
+	SyncTriggerToken           string                        `json:"sync_trigger_token"`
+	UAAClientName              string                        `json:"uaa_client_name"`
+	UAAClientSecret            string                        `json:"uaa_client_secret"`
+	UAATokenURL                string                        `json:"uaa_token_url"`
 }
 
 type ListenerConfig struct {
+	AllowedClientCommonNames  []string                      `json:"allowed_client_common_names"`
 	BBSAddress                string                        `json:"bbs_api_url"`
 	BBSCACert                 string                        `json:"bbs_ca_cert"`
 	BBSClientCert             string                        `json:"bbs_client_cert"`
 	BBSClientKey              string                        `json:"bbs_client_key"`
 	BBSClientSessionCacheSize int                           `json:"bbs_client_cache_size"`
 	BBSMaxIdleConnsPerHost    int                           `json:"bbs_max_idle_conns_per_host"`
+	BulkDesireAppWorkers      int                           `json:"bulk_desire_app_workers"`
+	CACert                    string                        `json:"ca_cert"`
+	CCBaseUrl                 string                        `json:"cc_base_url"`
+	CCPassword                string                        `json:"cc_basic_auth_password"`
+	CCUsername                string                        `json:"cc_basic_auth_username"`
 	CommunicationTimeout      Duration                      `json:"communication_timeout"`
 	ConsulCluster             string                        `json:"consul_cluster"`
 	DebugServerConfig         debugserver.DebugServerConfig `json:"debug_server_config"`
+	DockerDigestCacheTTL      Duration                      `json:"docker_digest_cache_ttl"`
+	DockerImagePolicy         recipebuilder.ImagePolicy     `json:"docker_image_policy"`
 	DropsondePort             int                           `json:"dropsonde_port"`
 	FileServerURL             string                        `json:"file_server_url"`
+	HealthCheckInterval       Duration                      `json:"health_check_interval"`
+	HealthCheckMonitorTimeout Duration                      `json:"health_check_monitor_timeout"`
+	HealthCheckTimeout        Duration                      `json:"health_check_timeout"`
+	InsecureDockerRegistries  []string                      `json:"insecure_docker_registry_list"`
 	Lifecycles                []string                      `json:"lifecycle_bundles"`
 	ListenAddress             string                        `json:"nsync_listen_addr"`
 	LagerConfig               lagerflags.LagerConfig        `json:"lager_config"`
+	PinDockerImageDigests     bool                          `json:"pin_docker_image_digests"`
 	PrivilegedContainers      bool                          `json:"diego_privileged_containers"`
+	RestartBatchTimeout       Duration                      `json:"restart_batch_timeout"`
+	RestartPollInterval       Duration                      `json:"restart_poll_interval"`
+	ServerCert                string                        `json:"server_cert"`
+	ServerKey                 string                        `json:"server_key"`
+	SkipCertVerify            bool                          `json:"skip_cert_verify"`
 }
 
 func DefaultBulkerConfig() BulkerConfig {
 	return BulkerConfig{
 		BBSCancelTaskPoolSize:     50,
 		BBSClientSessionCacheSize: 0,
+		BBSDeleteLRPWorkers:       50,
 		BBSFailTaskPoolSize:       50,
 		BBSMaxIdleConnsPerHost:    0,
 		BBSUpdateLRPWorkers:       50,
+		CCAuthType:                CCAuthBasic,
 		CCBulkBatchSize:           500,
 		CCPollingInterval:         Duration(30 * time.Second),
+		CCRequestMaxRetries:       3,
+		CCRequestRetryBaseDelay:   Duration(500 * time.Millisecond),
+		CCRequestRetryMaxDelay:    Duration(10 * time.Second),
 		CommunicationTimeout:      Duration(30 * time.Second),
+		DockerDigestCacheTTL:      Duration(5 * time.Minute),
 		DomainTTL:                 Duration(2 * time.Minute),
 		DropsondePort:             3457,
+		DryRun:                    false,
+		HealthCheckMonitorTimeout: Duration(recipebuilder.DefaultMonitorTimeout),
+		JournalMaxSegments:        100,
 		LagerConfig:               lagerflags.DefaultLagerConfig(),
 		LockRetryInterval:         Duration(locket.RetryInterval),
 		LockTTL:                   Duration(locket.DefaultSessionTTL),
+		MaxDeletionsPerSync:       0,
+		MaxDeletionPercentage:     0,
+		MaxRecipeRecreatesPerSync: 0,
+		PinDockerImageDigests:     false,
 		PrivilegedContainers:      false,
 		SkipCertVerify:            false,
+		SyncReportHistorySize:     10,
 	}
 }
 
@@ -122,10 +186,17 @@ func DefaultListenerConfig() ListenerConfig {
 	return ListenerConfig{
 		BBSClientSessionCacheSize: 0,
 		BBSMaxIdleConnsPerHost:    0,
+		BulkDesireAppWorkers:      50,
 		CommunicationTimeout:      Duration(30 * time.Second),
+		DockerDigestCacheTTL:      Duration(5 * time.Minute),
 		DropsondePort:             3457,
+		HealthCheckMonitorTimeout: Duration(recipebuilder.DefaultMonitorTimeout),
 		LagerConfig:               lagerflags.DefaultLagerConfig(),
+		PinDockerImageDigests:     false,
 		PrivilegedContainers:      false,
+		RestartBatchTimeout:       Duration(5 * time.Minute),
+		RestartPollInterval:       Duration(2 * time.Second),
+		SkipCertVerify:            false,
 	}
 }
 func NewListenerConfig(configPath string) (ListenerConfig, error) {
@@ -5,6 +5,7 @@ import (
 
 	"code.cloudfoundry.org/locket"
 	. "code.cloudfoundry.org/nsync/config"
+	"code.cloudfoundry.org/nsync/recipebuilder"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -18,19 +19,36 @@ var _ = Describe("Config", func() {
 
 			Expect(bulkerConfig.BBSCancelTaskPoolSize).To(Equal(50))
 			Expect(bulkerConfig.BBSClientSessionCacheSize).To(Equal(0))
+			Expect(bulkerConfig.BBSDeleteLRPWorkers).To(Equal(50))
 			Expect(bulkerConfig.BBSFailTaskPoolSize).To(Equal(50))
 			Expect(bulkerConfig.BBSMaxIdleConnsPerHost).To(Equal(0))
 			Expect(bulkerConfig.BBSUpdateLRPWorkers).To(Equal(50))
 			Expect(bulkerConfig.CCBulkBatchSize).To(Equal(uint(500)))
 			Expect(bulkerConfig.CCPollingInterval).To(Equal(Duration(30 * time.Second)))
+			Expect(bulkerConfig.CCRequestMaxRetries).To(Equal(3))
+			Expect(bulkerConfig.CCAuthType).To(Equal(CCAuthBasic))
+			Expect(bulkerConfig.CCRequestRetryBaseDelay).To(Equal(Duration(500 * time.Millisecond)))
+			Expect(bulkerConfig.CCRequestRetryMaxDelay).To(Equal(Duration(10 * time.Second)))
 			Expect(bulkerConfig.CommunicationTimeout).To(Equal(Duration(30 * time.Second)))
+			Expect(bulkerConfig.DockerDigestCacheTTL).To(Equal(Duration(5 * time.Minute)))
 			Expect(bulkerConfig.DomainTTL).To(Equal(Duration(2 * time.Minute)))
 			Expect(bulkerConfig.DropsondePort).To(Equal(3457))
+			Expect(bulkerConfig.DockerImagePolicy).To(BeZero())
+			Expect(bulkerConfig.HealthCheckInterval).To(BeZero())
+			Expect(bulkerConfig.HealthCheckMonitorTimeout).To(Equal(Duration(10 * time.Minute)))
+			Expect(bulkerConfig.HealthCheckTimeout).To(BeZero())
+			Expect(bulkerConfig.DryRun).To(BeFalse())
+			Expect(bulkerConfig.JournalMaxSegments).To(Equal(100))
 			Expect(bulkerConfig.LagerConfig.LogLevel).To(Equal("info"))
 			Expect(bulkerConfig.LockRetryInterval).To(Equal(Duration(locket.RetryInterval)))
 			Expect(bulkerConfig.LockTTL).To(Equal(Duration(locket.DefaultSessionTTL)))
+			Expect(bulkerConfig.MaxDeletionsPerSync).To(Equal(0))
+			Expect(bulkerConfig.MaxDeletionPercentage).To(Equal(float64(0)))
+			Expect(bulkerConfig.MaxRecipeRecreatesPerSync).To(Equal(0))
+			Expect(bulkerConfig.PinDockerImageDigests).To(BeFalse())
 			Expect(bulkerConfig.PrivilegedContainers).To(Equal(false))
 			Expect(bulkerConfig.SkipCertVerify).To(Equal(false))
+			Expect(bulkerConfig.SyncReportHistorySize).To(Equal(10))
 		})
 
 		It("reads from the config file and populates the config", func() {
@@ -41,14 +59,45 @@ var _ = Describe("Config", func() {
 			Expect(bulkerConfig.BBSCancelTaskPoolSize).To(Equal(1234))
 			Expect(bulkerConfig.CCBulkBatchSize).To(Equal(uint(117)))
 			Expect(bulkerConfig.CCPollingInterval).To(Equal(Duration(120 * time.Second)))
+			Expect(bulkerConfig.DockerDigestCacheTTL).To(Equal(Duration(90 * time.Second)))
+			Expect(bulkerConfig.CCRequestMaxRetries).To(Equal(5))
+			Expect(bulkerConfig.CCAuthType).To(Equal(CCAuthUAA))
+			Expect(bulkerConfig.CCClientCert).To(Equal("/path/to/cc/client.crt"))
+			Expect(bulkerConfig.CCClientKey).To(Equal("/path/to/cc/client.key"))
+			Expect(bulkerConfig.UAAClientName).To(Equal("nsync"))
+			Expect(bulkerConfig.UAAClientSecret).To(Equal("some-secret"))
+			Expect(bulkerConfig.UAATokenURL).To(Equal("https://uaa.com/oauth/token"))
+			Expect(bulkerConfig.CCRequestRetryBaseDelay).To(Equal(Duration(time.Second)))
+			Expect(bulkerConfig.CCRequestRetryMaxDelay).To(Equal(Duration(30 * time.Second)))
+			Expect(bulkerConfig.DryRun).To(BeTrue())
+			Expect(bulkerConfig.DockerImagePolicy).To(Equal(recipebuilder.ImagePolicy{
+				Default: recipebuilder.ImageRules{
+					Allow: []string{"docker.io/**", "registry.example.com/**"},
+					Deny:  []string{"docker.io/untrusted/*"},
+				},
+				IsolationSegments: map[string]recipebuilder.ImageRules{
+					"secure": {Allow: []string{"registry.example.com/secure/**"}},
+				},
+			}))
+			Expect(bulkerConfig.HealthCheckInterval).To(Equal(Duration(2 * time.Second)))
+			Expect(bulkerConfig.HealthCheckMonitorTimeout).To(Equal(Duration(5 * time.Minute)))
+			Expect(bulkerConfig.HealthCheckTimeout).To(Equal(Duration(3 * time.Second)))
+			Expect(bulkerConfig.InsecureDockerRegistries).To(Equal([]string{"10.0.0.1:5000"}))
+			Expect(bulkerConfig.JournalDir).To(Equal("/var/vcap/data/nsync/journal"))
+			Expect(bulkerConfig.JournalMaxSegments).To(Equal(20))
 			Expect(bulkerConfig.LagerConfig.LogLevel).To(Equal("debug"))
 			Expect(bulkerConfig.Lifecycles).To(Equal([]string{
 				"buildpack/cflinuxfs2:/path/to/bundle",
 				"buildpack/cflinuxfs2:/path/to/another/bundle",
 				"buildpack/somethingelse:/path/to/third/bundle",
 			}))
+			Expect(bulkerConfig.MaxDeletionsPerSync).To(Equal(100))
+			Expect(bulkerConfig.MaxDeletionPercentage).To(Equal(12.5))
+			Expect(bulkerConfig.MaxRecipeRecreatesPerSync).To(Equal(25))
+			Expect(bulkerConfig.PinDockerImageDigests).To(BeTrue())
 			Expect(bulkerConfig.SkipCertVerify).To(BeTrue())
 			Expect(bulkerConfig.DebugServerConfig.DebugAddress).To(Equal("https://debugger.com"))
+			Expect(bulkerConfig.SyncTriggerToken).To(Equal("some-token"))
 		})
 	})
 
@@ -59,35 +108,71 @@ var _ = Describe("Config", func() {
 
 			Expect(listenerConfig.BBSClientSessionCacheSize).To(Equal(0))
 			Expect(listenerConfig.BBSMaxIdleConnsPerHost).To(Equal(0))
+			Expect(listenerConfig.BulkDesireAppWorkers).To(Equal(50))
 			Expect(listenerConfig.CommunicationTimeout).To(Equal(Duration(30 * time.Second)))
+			Expect(listenerConfig.DockerDigestCacheTTL).To(Equal(Duration(5 * time.Minute)))
+			Expect(listenerConfig.DockerImagePolicy).To(BeZero())
+			Expect(listenerConfig.HealthCheckInterval).To(BeZero())
+			Expect(listenerConfig.HealthCheckMonitorTimeout).To(Equal(Duration(10 * time.Minute)))
+			Expect(listenerConfig.HealthCheckTimeout).To(BeZero())
 			Expect(listenerConfig.DropsondePort).To(Equal(3457))
 			Expect(listenerConfig.LagerConfig.LogLevel).To(Equal("info"))
+			Expect(listenerConfig.PinDockerImageDigests).To(BeFalse())
 			Expect(listenerConfig.PrivilegedContainers).To(Equal(false))
+			Expect(listenerConfig.RestartBatchTimeout).To(Equal(Duration(5 * time.Minute)))
+			Expect(listenerConfig.RestartPollInterval).To(Equal(Duration(2 * time.Second)))
+			Expect(listenerConfig.SkipCertVerify).To(Equal(false))
 		})
 
 		It("reads from the config file and populates the config", func() {
 			listenerConfig, err := NewListenerConfig("../fixtures/listener_config.json")
 			Expect(err).ToNot(HaveOccurred())
 
+			Expect(listenerConfig.AllowedClientCommonNames).To(Equal([]string{"cloud-controller", "cc-worker"}))
 			Expect(listenerConfig.BBSAddress).To(Equal("https://foobar.com"))
 			Expect(listenerConfig.BBSCACert).To(Equal("/path/to/cert"))
 			Expect(listenerConfig.BBSClientCert).To(Equal("/path/to/another/cert"))
 			Expect(listenerConfig.BBSClientKey).To(Equal("/path/to/key"))
 			Expect(listenerConfig.BBSClientSessionCacheSize).To(Equal(1234))
 			Expect(listenerConfig.BBSMaxIdleConnsPerHost).To(Equal(10))
+			Expect(listenerConfig.BulkDesireAppWorkers).To(Equal(20))
+			Expect(listenerConfig.CACert).To(Equal("/path/to/listener/ca.crt"))
+			Expect(listenerConfig.CCBaseUrl).To(Equal("https://cc.com"))
+			Expect(listenerConfig.CCPassword).To(Equal("some-password"))
+			Expect(listenerConfig.CCUsername).To(Equal("some-user"))
 			Expect(listenerConfig.CommunicationTimeout).To(Equal(Duration(256 * time.Second)))
 			Expect(listenerConfig.ConsulCluster).To(Equal("https://consul.com"))
 			Expect(listenerConfig.DebugServerConfig.DebugAddress).To(Equal("https://debugger.com"))
 			Expect(listenerConfig.DropsondePort).To(Equal(666))
+			Expect(listenerConfig.DockerDigestCacheTTL).To(Equal(Duration(45 * time.Second)))
+			Expect(listenerConfig.DockerImagePolicy).To(Equal(recipebuilder.ImagePolicy{
+				Default: recipebuilder.ImageRules{
+					Allow: []string{"docker.io/**", "registry.example.com/**"},
+					Deny:  []string{"docker.io/untrusted/*"},
+				},
+				IsolationSegments: map[string]recipebuilder.ImageRules{
+					"secure": {Allow: []string{"registry.example.com/secure/**"}},
+				},
+			}))
 			Expect(listenerConfig.FileServerURL).To(Equal("https://fileserver.com"))
+			Expect(listenerConfig.HealthCheckInterval).To(Equal(Duration(2 * time.Second)))
+			Expect(listenerConfig.HealthCheckMonitorTimeout).To(Equal(Duration(5 * time.Minute)))
+			Expect(listenerConfig.HealthCheckTimeout).To(Equal(Duration(3 * time.Second)))
+			Expect(listenerConfig.InsecureDockerRegistries).To(Equal([]string{"10.0.0.1:5000"}))
 			Expect(listenerConfig.Lifecycles).To(Equal([]string{
 				"buildpack/cflinuxfs2:/path/to/bundle",
 				"buildpack/cflinuxfs2:/path/to/another/bundle",
 				"buildpack/somethingelse:/path/to/third/bundle",
 			}))
 			Expect(listenerConfig.ListenAddress).To(Equal("https://nsync.com/listen"))
+			Expect(listenerConfig.ServerCert).To(Equal("/path/to/listener/server.crt"))
+			Expect(listenerConfig.ServerKey).To(Equal("/path/to/listener/server.key"))
 			Expect(listenerConfig.LagerConfig.LogLevel).To(Equal("debug"))
+			Expect(listenerConfig.PinDockerImageDigests).To(BeTrue())
 			Expect(listenerConfig.PrivilegedContainers).To(Equal(true))
+			Expect(listenerConfig.RestartBatchTimeout).To(Equal(Duration(90 * time.Second)))
+			Expect(listenerConfig.RestartPollInterval).To(Equal(Duration(500 * time.Millisecond)))
+			Expect(listenerConfig.SkipCertVerify).To(BeTrue())
 		})
 	})
 })
@@ -39,11 +39,11 @@ func (h *CancelTaskHandler) CancelTask(resp http.ResponseWriter, req *http.Reque
 	if err != nil {
 		logger.Error("cancel-task-failed", err)
 		if err == models.ErrResourceNotFound {
-			resp.WriteHeader(http.StatusNotFound)
+			writeError(resp, http.StatusNotFound, err)
 			return
 		}
 
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeError(resp, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -56,6 +56,7 @@ var _ = Describe("CancelTaskHandler", func() {
 
 		It("responds with 404 Not Found", func() {
 			Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+			Expect(errorResponse(responseRecorder).Type).To(Equal("ResourceNotFound"))
 		})
 	})
 
@@ -66,6 +67,7 @@ var _ = Describe("CancelTaskHandler", func() {
 
 		It("responds with 500 Internal Server Error", func() {
 			Expect(responseRecorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(errorResponse(responseRecorder).Type).To(Equal("UnknownError"))
 		})
 	})
 
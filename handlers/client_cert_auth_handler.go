@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+)
+
+var (
+	missingClientCertErr    = errors.New("no client certificate presented")
+	unauthorizedClientCNErr = errors.New("client certificate common name is not allowed")
+)
+
+type ClientCertAuthHandler struct {
+	handler            http.Handler
+	allowedCommonNames map[string]struct{}
+	logger             lager.Logger
+}
+
+// NewClientCertAuthHandler only lets through requests that presented a
+// verified client certificate. When allowedCommonNames is empty any
+// certificate signed by the configured CA is accepted.
+func NewClientCertAuthHandler(logger lager.Logger, allowedCommonNames []string, handler http.Handler) *ClientCertAuthHandler {
+	allowed := make(map[string]struct{}, len(allowedCommonNames))
+	for _, commonName := range allowedCommonNames {
+		allowed[commonName] = struct{}{}
+	}
+
+	return &ClientCertAuthHandler{
+		handler:            handler,
+		allowedCommonNames: allowed,
+		logger:             logger,
+	}
+}
+
+func (h *ClientCertAuthHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	logger := h.logger.Session("client-cert-auth", lager.Data{
+		"method":      req.Method,
+		"request":     req.URL.String(),
+		"remote-addr": req.RemoteAddr,
+	})
+
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		logger.Error("rejected-request-without-client-certificate", missingClientCertErr)
+		resp.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	commonName := req.TLS.PeerCertificates[0].Subject.CommonName
+	if len(h.allowedCommonNames) > 0 {
+		if _, ok := h.allowedCommonNames[commonName]; !ok {
+			logger.Error("rejected-client-certificate-common-name", unauthorizedClientCNErr, lager.Data{"common-name": commonName})
+			resp.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	h.handler.ServeHTTP(resp, req)
+}
@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ClientCertAuthHandler", func() {
+	var (
+		logger             *lagertest.TestLogger
+		allowedCommonNames []string
+		wrappedCalled      bool
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	withClientCert := func(commonName string) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: commonName}},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		logger = lagertest.NewTestLogger("test")
+		allowedCommonNames = []string{"cloud-controller"}
+		wrappedCalled = false
+
+		responseRecorder = httptest.NewRecorder()
+
+		request, err = http.NewRequest("DELETE", "/v1/apps/some-guid", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		wrapped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrappedCalled = true
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		handler := handlers.NewClientCertAuthHandler(logger, allowedCommonNames, wrapped)
+		handler.ServeHTTP(responseRecorder, request)
+	})
+
+	Context("when the client presents an allowed certificate", func() {
+		BeforeEach(func() {
+			request.TLS = withClientCert("cloud-controller")
+		})
+
+		It("serves the request", func() {
+			Expect(wrappedCalled).To(BeTrue())
+			Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+		})
+	})
+
+	Context("when the client presents a certificate with another common name", func() {
+		BeforeEach(func() {
+			request.TLS = withClientCert("someone-else")
+		})
+
+		It("rejects the request with 403 Forbidden", func() {
+			Expect(wrappedCalled).To(BeFalse())
+			Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("logs the rejected common name", func() {
+			Expect(logger.TestSink.Buffer).To(gbytes.Say("rejected-client-certificate-common-name"))
+			Expect(logger.TestSink.Buffer).To(gbytes.Say("someone-else"))
+		})
+
+		Context("when no allow-list is configured", func() {
+			BeforeEach(func() {
+				allowedCommonNames = nil
+			})
+
+			It("serves the request", func() {
+				Expect(wrappedCalled).To(BeTrue())
+				Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+			})
+		})
+	})
+
+	Context("when the client presents no certificate", func() {
+		It("rejects the request with 401 Unauthorized", func() {
+			Expect(wrappedCalled).To(BeFalse())
+			Expect(responseRecorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("logs the rejection", func() {
+			Expect(logger.TestSink.Buffer).To(gbytes.Say("rejected-request-without-client-certificate"))
+		})
+	})
+})
@@ -9,7 +9,6 @@ import (
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/nsync/helpers"
 	"code.cloudfoundry.org/nsync/recipebuilder"
-	"code.cloudfoundry.org/runtimeschema/cc_messages"
 	"code.cloudfoundry.org/runtimeschema/metric"
 	"github.com/cloudfoundry-incubator/routing-info/cfroutes"
 	"github.com/cloudfoundry-incubator/routing-info/tcp_routes"
@@ -20,12 +19,12 @@ const (
 )
 
 type DesireAppHandler struct {
-	recipeBuilders map[string]recipebuilder.RecipeBuilder
+	recipeBuilders *recipebuilder.Registry
 	bbsClient      bbs.Client
 	logger         lager.Logger
 }
 
-func NewDesireAppHandler(logger lager.Logger, bbsClient bbs.Client, builders map[string]recipebuilder.RecipeBuilder) DesireAppHandler {
+func NewDesireAppHandler(logger lager.Logger, bbsClient bbs.Client, builders *recipebuilder.Registry) DesireAppHandler {
 	return DesireAppHandler{
 		recipeBuilders: builders,
 		bbsClient:      bbsClient,
@@ -45,11 +44,11 @@ func (h *DesireAppHandler) DesireApp(resp http.ResponseWriter, req *http.Request
 	logger.Info("serving")
 	defer logger.Info("complete")
 
-	desiredApp := cc_messages.DesireAppRequestFromCC{}
+	desiredApp := recipebuilder.DesireAppRequest{}
 	err := json.NewDecoder(req.Body).Decode(&desiredApp)
 	if err != nil {
 		logger.Error("parse-desired-app-request-failed", err)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeError(resp, http.StatusBadRequest, newInvalidRequestError(err))
 		return
 	}
 	logger.Info("request-from-cc", lager.Data{"routing_info": desiredApp.RoutingInfo})
@@ -61,15 +60,30 @@ func (h *DesireAppHandler) DesireApp(resp http.ResponseWriter, req *http.Request
 	logger.Debug("environment", lager.Data{"keys": envNames})
 
 	if processGuid != desiredApp.ProcessGuid {
-		logger.Error("process-guid-mismatch", err, lager.Data{"body-process-guid": desiredApp.ProcessGuid})
-		resp.WriteHeader(http.StatusBadRequest)
+		logger.Error("process-guid-mismatch", processGuidMismatchErr, lager.Data{"body-process-guid": desiredApp.ProcessGuid})
+		writeError(resp, http.StatusBadRequest, processGuidMismatchErr)
 		return
 	}
 
+	statusCode, err := h.createOrUpdateDesiredApp(logger, desiredApp)
+	if err != nil {
+		writeError(resp, statusCode, err)
+		return
+	}
+
+	resp.WriteHeader(statusCode)
+}
+
+func (h *DesireAppHandler) createOrUpdateDesiredApp(
+	logger lager.Logger,
+	desiredApp recipebuilder.DesireAppRequest,
+) (int, error) {
+	var err error
 	statusCode := http.StatusConflict
 
 	for tries := 2; tries > 0 && statusCode == http.StatusConflict; tries-- {
-		existingLRP, err := h.getDesiredLRP(logger, processGuid)
+		var existingLRP *models.DesiredLRP
+		existingLRP, err = h.getDesiredLRP(logger, desiredApp.ProcessGuid)
 		if err != nil {
 			statusCode = http.StatusServiceUnavailable
 			break
@@ -89,8 +103,8 @@ func (h *DesireAppHandler) DesireApp(resp http.ResponseWriter, req *http.Request
 			case models.Error_ResourceExists:
 				statusCode = http.StatusConflict
 			default:
-				if _, ok := err.(recipebuilder.Error); ok {
-					statusCode = http.StatusBadRequest
+				if recipeErr, ok := err.(recipebuilder.Error); ok {
+					statusCode = recipeErrorStatus(recipeErr)
 				} else {
 					statusCode = http.StatusServiceUnavailable
 				}
@@ -101,7 +115,7 @@ func (h *DesireAppHandler) DesireApp(resp http.ResponseWriter, req *http.Request
 		}
 	}
 
-	resp.WriteHeader(statusCode)
+	return statusCode, err
 }
 
 func (h *DesireAppHandler) getDesiredLRP(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
@@ -125,11 +139,12 @@ func (h *DesireAppHandler) getDesiredLRP(logger lager.Logger, processGuid string
 
 func (h *DesireAppHandler) createDesiredApp(
 	logger lager.Logger,
-	desireAppMessage cc_messages.DesireAppRequestFromCC,
+	desireAppMessage recipebuilder.DesireAppRequest,
 ) error {
-	var builder recipebuilder.RecipeBuilder = h.recipeBuilders["buildpack"]
-	if desireAppMessage.DockerImageUrl != "" {
-		builder = h.recipeBuilders["docker"]
+	builder, err := h.recipeBuilders.BuilderForApp(&desireAppMessage.DesireAppRequestFromCC)
+	if err != nil {
+		logger.Error("builder-not-found", err)
+		return err
 	}
 
 	desiredLRP, err := builder.Build(&desireAppMessage)
@@ -152,13 +167,15 @@ func (h *DesireAppHandler) createDesiredApp(
 func (h *DesireAppHandler) updateDesiredApp(
 	logger lager.Logger,
 	existingLRP *models.DesiredLRP,
-	desireAppMessage cc_messages.DesireAppRequestFromCC,
+	desireAppMessage recipebuilder.DesireAppRequest,
 ) error {
-	var builder recipebuilder.RecipeBuilder = h.recipeBuilders["buildpack"]
-	if desireAppMessage.DockerImageUrl != "" {
-		builder = h.recipeBuilders["docker"]
+	builder, err := h.recipeBuilders.BuilderForApp(&desireAppMessage.DesireAppRequestFromCC)
+	if err != nil {
+		logger.Error("builder-not-found", err)
+		return err
 	}
-	ports, err := builder.ExtractExposedPorts(&desireAppMessage)
+
+	ports, err := builder.ExtractExposedPorts(&desireAppMessage.DesireAppRequestFromCC)
 	if err != nil {
 		logger.Error("failed to-get-exposed-port", err)
 		return err
@@ -33,6 +33,7 @@ var _ = Describe("DesireAppHandler", func() {
 		fakeBBS          *fake_bbs.FakeClient
 		buildpackBuilder *fakes.FakeRecipeBuilder
 		dockerBuilder    *fakes.FakeRecipeBuilder
+		registry         *recipebuilder.Registry
 		desireAppRequest cc_messages.DesireAppRequestFromCC
 		metricSender     *fake.FakeMetricSender
 
@@ -47,6 +48,7 @@ var _ = Describe("DesireAppHandler", func() {
 		fakeBBS = new(fake_bbs.FakeClient)
 		buildpackBuilder = new(fakes.FakeRecipeBuilder)
 		dockerBuilder = new(fakes.FakeRecipeBuilder)
+		registry = recipebuilder.NewDefaultRegistry(buildpackBuilder, dockerBuilder)
 
 		routingInfo, err := cc_messages.CCHTTPRoutes{
 			{Hostname: "route1"},
@@ -93,10 +95,7 @@ var _ = Describe("DesireAppHandler", func() {
 			request.Body = ioutil.NopCloser(reader)
 		}
 
-		handler := handlers.NewDesireAppHandler(logger, fakeBBS, map[string]recipebuilder.RecipeBuilder{
-			"buildpack": buildpackBuilder,
-			"docker":    dockerBuilder,
-		})
+		handler := handlers.NewDesireAppHandler(logger, fakeBBS, registry)
 		handler.DesireApp(responseRecorder, request)
 	})
 
@@ -131,7 +130,30 @@ var _ = Describe("DesireAppHandler", func() {
 			_, desiredLRP := fakeBBS.DesireLRPArgsForCall(0)
 			Expect(desiredLRP).To(Equal(newlyDesiredLRP))
 
-			Expect(buildpackBuilder.BuildArgsForCall(0)).To(Equal(&desireAppRequest))
+			Expect(buildpackBuilder.BuildArgsForCall(0)).To(Equal(&recipebuilder.DesireAppRequest{DesireAppRequestFromCC: desireAppRequest}))
+		})
+
+		Context("when CC sends the app's health check settings", func() {
+			var appHealthCheck recipebuilder.AppHealthCheck
+
+			BeforeEach(func() {
+				appHealthCheck = recipebuilder.AppHealthCheck{
+					HealthCheckIntervalInSeconds:          5,
+					HealthCheckInvocationTimeoutInSeconds: 2,
+				}
+
+				jsonBytes, err := json.Marshal(&recipebuilder.DesireAppRequest{
+					DesireAppRequestFromCC: desireAppRequest,
+					AppHealthCheck:         appHealthCheck,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				request.Body = ioutil.NopCloser(bytes.NewReader(jsonBytes))
+			})
+
+			It("passes them to the builder", func() {
+				Expect(buildpackBuilder.BuildCallCount()).To(Equal(1))
+				Expect(buildpackBuilder.BuildArgsForCall(0).AppHealthCheck).To(Equal(appHealthCheck))
+			})
 		})
 
 		It("responds with 202 Accepted", func() {
@@ -150,6 +172,13 @@ var _ = Describe("DesireAppHandler", func() {
 			It("responds with a ServiceUnavailabe error", func() {
 				Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
 			})
+
+			It("describes the BBS error in the body", func() {
+				Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+					Type:    "UnknownError",
+					Message: "oh no",
+				}))
+			})
 		})
 
 		Context("when the bbs fails with a Conflict error", func() {
@@ -178,6 +207,7 @@ var _ = Describe("DesireAppHandler", func() {
 
 				It("fails with a 409 Conflict if the second try is unsuccessful", func() {
 					Expect(responseRecorder.Code).To(Equal(http.StatusConflict))
+					Expect(errorResponse(responseRecorder).Type).To(Equal("ResourceConflict"))
 				})
 			})
 		})
@@ -199,6 +229,27 @@ var _ = Describe("DesireAppHandler", func() {
 			It("responds with 400 Bad Request", func() {
 				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
 			})
+
+			It("describes the recipe builder error in the body", func() {
+				Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+					Type:    recipebuilder.ErrDropletSourceMissing.Type,
+					Message: recipebuilder.ErrDropletSourceMissing.Message,
+				}))
+			})
+		})
+
+		Context("when the image policy rejects the app's image", func() {
+			BeforeEach(func() {
+				buildpackBuilder.BuildReturns(nil, recipebuilder.Error{Type: recipebuilder.ImageNotAllowed, Message: "not allowed"})
+			})
+
+			It("does not desire the LRP", func() {
+				Expect(fakeBBS.DesireLRPCallCount()).To(Equal(0))
+			})
+
+			It("responds with 403 Forbidden", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+			})
 		})
 
 		Context("when the LRP has docker image", func() {
@@ -229,7 +280,7 @@ var _ = Describe("DesireAppHandler", func() {
 				_, desiredLRP := fakeBBS.DesireLRPArgsForCall(0)
 				Expect(desiredLRP).To(Equal(newlyDesiredDockerLRP))
 
-				Expect(dockerBuilder.BuildArgsForCall(0)).To(Equal(&desireAppRequest))
+				Expect(dockerBuilder.BuildArgsForCall(0)).To(Equal(&recipebuilder.DesireAppRequest{DesireAppRequestFromCC: desireAppRequest}))
 			})
 
 			It("responds with 202 Accepted", func() {
@@ -240,6 +291,48 @@ var _ = Describe("DesireAppHandler", func() {
 				Expect(metricSender.GetCounter("LRPsDesired")).To(Equal(uint64(1)))
 			})
 		})
+
+		Context("when another lifecycle is registered for the app", func() {
+			var windowsBuilder *fakes.FakeRecipeBuilder
+
+			BeforeEach(func() {
+				windowsBuilder = new(fakes.FakeRecipeBuilder)
+				windowsBuilder.BuildReturns(newlyDesiredLRP, nil)
+
+				registry.Register("windows", windowsBuilder, func(app *cc_messages.DesireAppRequestFromCC) bool {
+					return app.Stack == "windows2012R2"
+				})
+				desireAppRequest.Stack = "windows2012R2"
+			})
+
+			It("builds the desired LRP with that lifecycle", func() {
+				Expect(windowsBuilder.BuildCallCount()).To(Equal(1))
+				Expect(buildpackBuilder.BuildCallCount()).To(Equal(0))
+				Expect(dockerBuilder.BuildCallCount()).To(Equal(0))
+
+				Expect(fakeBBS.DesireLRPCallCount()).To(Equal(1))
+				_, desiredLRP := fakeBBS.DesireLRPArgsForCall(0)
+				Expect(desiredLRP).To(Equal(newlyDesiredLRP))
+			})
+
+			It("responds with 202 Accepted", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+			})
+		})
+
+		Context("when no lifecycle can build the app", func() {
+			BeforeEach(func() {
+				registry = recipebuilder.NewRegistry("buildpack")
+			})
+
+			It("does not desire the LRP", func() {
+				Expect(fakeBBS.DesireLRPCallCount()).To(Equal(0))
+			})
+
+			It("responds with 400 Bad Request", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
 	})
 
 	Context("when desired LRP already exists", func() {
@@ -460,6 +553,10 @@ var _ = Describe("DesireAppHandler", func() {
 			Eventually(logger.TestSink.Buffer).Should(gbytes.Say("parse-desired-app-request-failed"))
 		})
 
+		It("describes the invalid request in the body", func() {
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
+		})
+
 		It("does not touch the LRP", func() {
 			Expect(fakeBBS.DesireLRPCallCount()).To(Equal(0))
 			Expect(fakeBBS.UpdateDesiredLRPCallCount()).To(Equal(0))
@@ -484,6 +581,13 @@ var _ = Describe("DesireAppHandler", func() {
 			Eventually(logger.TestSink.Buffer).Should(gbytes.Say("desire-app.process-guid-mismatch"))
 		})
 
+		It("describes the mismatch in the body", func() {
+			Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+				Type:    handlers.InvalidRequest,
+				Message: "process_guid in body does not match the url",
+			}))
+		})
+
 		It("does not touch the LRP", func() {
 			Expect(fakeBBS.DesireLRPCallCount()).To(Equal(0))
 			Expect(fakeBBS.UpdateDesiredLRPCallCount()).To(Equal(0))
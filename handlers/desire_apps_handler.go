@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/workpool"
+)
+
+// DesireAppResult reports the outcome of desiring a single app in a batch.
+// Status is the code DesireApp would have responded with for that app.
+type DesireAppResult struct {
+	ProcessGuid string `json:"process_guid"`
+	Status      int    `json:"status"`
+	Error       *Error `json:"error,omitempty"`
+}
+
+type DesireAppsHandler struct {
+	desireAppHandler DesireAppHandler
+	workPoolSize     int
+	logger           lager.Logger
+}
+
+func NewDesireAppsHandler(
+	logger lager.Logger,
+	bbsClient bbs.Client,
+	builders *recipebuilder.Registry,
+	workPoolSize int,
+) DesireAppsHandler {
+	return DesireAppsHandler{
+		desireAppHandler: NewDesireAppHandler(logger, bbsClient, builders),
+		workPoolSize:     workPoolSize,
+		logger:           logger,
+	}
+}
+
+func (h *DesireAppsHandler) DesireApps(resp http.ResponseWriter, req *http.Request) {
+	logger := h.logger.Session("desire-apps", lager.Data{
+		"method":  req.Method,
+		"request": req.URL.String(),
+	})
+
+	logger.Info("serving")
+	defer logger.Info("complete")
+
+	desiredApps := []recipebuilder.DesireAppRequest{}
+	err := json.NewDecoder(req.Body).Decode(&desiredApps)
+	if err != nil {
+		logger.Error("parse-desired-apps-request-failed", err)
+		writeError(resp, http.StatusBadRequest, newInvalidRequestError(err))
+		return
+	}
+
+	processGuids := map[string]struct{}{}
+	for _, desiredApp := range desiredApps {
+		if desiredApp.ProcessGuid == "" {
+			logger.Error("missing-process-guid", missingParameterErr)
+			writeError(resp, http.StatusBadRequest, missingParameterErr)
+			return
+		}
+
+		if _, found := processGuids[desiredApp.ProcessGuid]; found {
+			logger.Error("duplicate-process-guid", duplicateProcessGuidErr, lager.Data{"process_guid": desiredApp.ProcessGuid})
+			writeError(resp, http.StatusBadRequest, duplicateProcessGuidErr)
+			return
+		}
+		processGuids[desiredApp.ProcessGuid] = struct{}{}
+	}
+
+	results := make([]DesireAppResult, len(desiredApps))
+	if len(desiredApps) > 0 {
+		err = h.desireApps(logger, desiredApps, results)
+		if err != nil {
+			writeError(resp, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	writeJSON(resp, http.StatusOK, results)
+}
+
+func (h *DesireAppsHandler) desireApps(
+	logger lager.Logger,
+	desiredApps []recipebuilder.DesireAppRequest,
+	results []DesireAppResult,
+) error {
+	logger.Info("desiring-apps", lager.Data{"size": len(desiredApps)})
+
+	works := make([]func(), len(desiredApps))
+
+	for i := range desiredApps {
+		i := i
+		desiredApp := desiredApps[i]
+
+		works[i] = func() {
+			appLogger := logger.Session("desire-app", lager.Data{"process_guid": desiredApp.ProcessGuid})
+
+			result := DesireAppResult{ProcessGuid: desiredApp.ProcessGuid}
+			statusCode, err := h.desireAppHandler.createOrUpdateDesiredApp(appLogger, desiredApp)
+			result.Status = statusCode
+			if err != nil {
+				appErr := toError(err)
+				result.Error = &appErr
+			}
+
+			results[i] = result
+		}
+	}
+
+	throttler, err := workpool.NewThrottler(h.workPoolSize, works)
+	if err != nil {
+		logger.Error("failed-constructing-throttler", err, lager.Data{"max-workers": h.workPoolSize})
+		return err
+	}
+
+	throttler.Work()
+	logger.Info("desired-apps", lager.Data{"size": len(desiredApps)})
+
+	return nil
+}
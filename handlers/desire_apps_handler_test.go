@@ -0,0 +1,237 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/bulk/fakes"
+	"code.cloudfoundry.org/nsync/handlers"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DesireAppsHandler", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeBBS          *fake_bbs.FakeClient
+		buildpackBuilder *fakes.FakeRecipeBuilder
+		dockerBuilder    *fakes.FakeRecipeBuilder
+		workPoolSize     int
+		desiredApps      []cc_messages.DesireAppRequestFromCC
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		logger = lagertest.NewTestLogger("test")
+		fakeBBS = new(fake_bbs.FakeClient)
+		buildpackBuilder = new(fakes.FakeRecipeBuilder)
+		dockerBuilder = new(fakes.FakeRecipeBuilder)
+		workPoolSize = 5
+
+		desiredApps = []cc_messages.DesireAppRequestFromCC{
+			{ProcessGuid: "new-guid", NumInstances: 1, ETag: "etag-1"},
+			{ProcessGuid: "existing-guid", NumInstances: 2, ETag: "etag-2"},
+			{ProcessGuid: "docker-guid", DockerImageUrl: "docker:///user/repo", NumInstances: 3, ETag: "etag-3"},
+		}
+
+		fakeBBS.DesiredLRPByProcessGuidStub = func(logger lager.Logger, processGuid string) (*models.DesiredLRP, error) {
+			if processGuid == "existing-guid" {
+				return &models.DesiredLRP{ProcessGuid: processGuid}, nil
+			}
+			return nil, models.ErrResourceNotFound
+		}
+
+		buildpackBuilder.BuildStub = func(desiredApp *recipebuilder.DesireAppRequest) (*models.DesiredLRP, error) {
+			return &models.DesiredLRP{ProcessGuid: desiredApp.ProcessGuid}, nil
+		}
+		dockerBuilder.BuildStub = buildpackBuilder.BuildStub
+
+		responseRecorder = httptest.NewRecorder()
+
+		request, err = http.NewRequest("PUT", "/v1/apps", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		if request.Body == nil {
+			jsonBytes, err := json.Marshal(desiredApps)
+			Expect(err).NotTo(HaveOccurred())
+			request.Body = ioutil.NopCloser(bytes.NewReader(jsonBytes))
+		}
+
+		handler := handlers.NewDesireAppsHandler(logger, fakeBBS, recipebuilder.NewDefaultRegistry(buildpackBuilder, dockerBuilder), workPoolSize)
+		handler.DesireApps(responseRecorder, request)
+	})
+
+	decodeResults := func() []handlers.DesireAppResult {
+		var results []handlers.DesireAppResult
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &results)
+		Expect(err).NotTo(HaveOccurred())
+		return results
+	}
+
+	It("creates the apps that do not exist", func() {
+		Expect(fakeBBS.DesireLRPCallCount()).To(Equal(2))
+
+		desiredGuids := []string{}
+		for i := 0; i < fakeBBS.DesireLRPCallCount(); i++ {
+			_, desiredLRP := fakeBBS.DesireLRPArgsForCall(i)
+			desiredGuids = append(desiredGuids, desiredLRP.ProcessGuid)
+		}
+		Expect(desiredGuids).To(ConsistOf("new-guid", "docker-guid"))
+	})
+
+	It("uses the builder for each app's lifecycle", func() {
+		Expect(buildpackBuilder.BuildCallCount()).To(Equal(1))
+		Expect(buildpackBuilder.BuildArgsForCall(0).ProcessGuid).To(Equal("new-guid"))
+
+		Expect(dockerBuilder.BuildCallCount()).To(Equal(1))
+		Expect(dockerBuilder.BuildArgsForCall(0).ProcessGuid).To(Equal("docker-guid"))
+	})
+
+	It("updates the apps that already exist", func() {
+		Expect(fakeBBS.UpdateDesiredLRPCallCount()).To(Equal(1))
+
+		_, processGuid, update := fakeBBS.UpdateDesiredLRPArgsForCall(0)
+		Expect(processGuid).To(Equal("existing-guid"))
+		Expect(*update.Instances).To(Equal(int32(2)))
+		Expect(*update.Annotation).To(Equal("etag-2"))
+	})
+
+	It("responds with a result per app, in request order", func() {
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		Expect(decodeResults()).To(Equal([]handlers.DesireAppResult{
+			{ProcessGuid: "new-guid", Status: http.StatusAccepted},
+			{ProcessGuid: "existing-guid", Status: http.StatusAccepted},
+			{ProcessGuid: "docker-guid", Status: http.StatusAccepted},
+		}))
+	})
+
+	Context("when some apps fail", func() {
+		BeforeEach(func() {
+			buildpackBuilder.BuildReturns(nil, recipebuilder.ErrDropletSourceMissing)
+			buildpackBuilder.BuildStub = nil
+			fakeBBS.UpdateDesiredLRPReturns(errors.New("oh no"))
+		})
+
+		It("reports the status and error type for each failed app", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			results := decodeResults()
+			Expect(results).To(HaveLen(3))
+
+			Expect(results[0].ProcessGuid).To(Equal("new-guid"))
+			Expect(results[0].Status).To(Equal(http.StatusBadRequest))
+			Expect(results[0].Error.Type).To(Equal(recipebuilder.ErrDropletSourceMissing.Type))
+
+			Expect(results[1].ProcessGuid).To(Equal("existing-guid"))
+			Expect(results[1].Status).To(Equal(http.StatusServiceUnavailable))
+			Expect(results[1].Error.Type).To(Equal("UnknownError"))
+
+			Expect(results[2]).To(Equal(handlers.DesireAppResult{ProcessGuid: "docker-guid", Status: http.StatusAccepted}))
+		})
+	})
+
+	Context("when there are more apps than workers", func() {
+		var (
+			lock              sync.Mutex
+			inFlight, maxSeen int
+		)
+
+		BeforeEach(func() {
+			workPoolSize = 2
+			inFlight, maxSeen = 0, 0
+
+			desiredApps = nil
+			for _, guid := range []string{"a", "b", "c", "d", "e", "f"} {
+				desiredApps = append(desiredApps, cc_messages.DesireAppRequestFromCC{ProcessGuid: guid})
+			}
+
+			fakeBBS.DesireLRPStub = func(logger lager.Logger, desiredLRP *models.DesiredLRP) error {
+				lock.Lock()
+				inFlight++
+				if inFlight > maxSeen {
+					maxSeen = inFlight
+				}
+				lock.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				lock.Lock()
+				inFlight--
+				lock.Unlock()
+				return nil
+			}
+		})
+
+		It("desires them concurrently, bounded by the work pool size", func() {
+			Expect(fakeBBS.DesireLRPCallCount()).To(Equal(6))
+			Expect(maxSeen).To(BeNumerically("<=", 2))
+			Expect(decodeResults()).To(HaveLen(6))
+		})
+	})
+
+	Context("when the request is empty", func() {
+		BeforeEach(func() {
+			desiredApps = []cc_messages.DesireAppRequestFromCC{}
+		})
+
+		It("responds with an empty result list", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(MatchJSON("[]"))
+		})
+	})
+
+	Context("when the request body is invalid", func() {
+		BeforeEach(func() {
+			request.Body = ioutil.NopCloser(bytes.NewBufferString("{}"))
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
+			Expect(fakeBBS.DesiredLRPByProcessGuidCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when an app is missing its process guid", func() {
+		BeforeEach(func() {
+			desiredApps[1].ProcessGuid = ""
+		})
+
+		It("rejects the whole request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.MissingParameter))
+			Expect(fakeBBS.DesiredLRPByProcessGuidCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when a process guid appears more than once", func() {
+		BeforeEach(func() {
+			desiredApps[2].ProcessGuid = "new-guid"
+		})
+
+		It("rejects the whole request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
+			Expect(fakeBBS.DesiredLRPByProcessGuidCallCount()).To(Equal(0))
+		})
+	})
+})
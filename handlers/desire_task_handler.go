@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/nsync/recipebuilder"
 	"code.cloudfoundry.org/runtimeschema/cc_messages"
@@ -13,14 +16,14 @@ import (
 
 type TaskHandler struct {
 	logger         lager.Logger
-	recipeBuilders map[string]recipebuilder.RecipeBuilder
+	recipeBuilders *recipebuilder.Registry
 	bbsClient      bbs.Client
 }
 
 func NewTaskHandler(
 	logger lager.Logger,
 	bbsClient bbs.Client,
-	recipeBuilders map[string]recipebuilder.RecipeBuilder,
+	recipeBuilders *recipebuilder.Registry,
 ) TaskHandler {
 	return TaskHandler{
 		logger:         logger,
@@ -42,31 +45,132 @@ func (h *TaskHandler) DesireTask(resp http.ResponseWriter, req *http.Request) {
 	err := json.NewDecoder(req.Body).Decode(&task)
 	if err != nil {
 		logger.Error("parse-task-request-failed", err)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeError(resp, http.StatusBadRequest, newInvalidRequestError(err))
 		return
 	}
 
-	builder, ok := h.recipeBuilders[task.Lifecycle]
+	builder, ok := h.recipeBuilders.BuilderForLifecycle(task.Lifecycle)
 	if !ok {
-		logger.Error("builder-not-found", errors.New("no-builder"), lager.Data{"lifecycle": task.Lifecycle})
-		resp.WriteHeader(http.StatusBadRequest)
+		err := Error{Type: UnknownLifecycle, Message: "no builder for lifecycle " + task.Lifecycle}
+		logger.Error("builder-not-found", err, lager.Data{"lifecycle": task.Lifecycle})
+		writeError(resp, http.StatusBadRequest, err)
 		return
 	}
 
 	desiredTask, err := builder.BuildTask(&task)
 	if err != nil {
 		logger.Error("building-task-failed", err)
-		resp.WriteHeader(http.StatusBadRequest)
+		statusCode := http.StatusBadRequest
+		if recipeErr, ok := err.(recipebuilder.Error); ok {
+			statusCode = recipeErrorStatus(recipeErr)
+		}
+		writeError(resp, statusCode, err)
 		return
 	}
 
 	logger.Info("desiring-task", lager.Data{"task-guid": task.TaskGuid})
 	err = h.bbsClient.DesireTask(logger, task.TaskGuid, cc_messages.RunningTaskDomain, desiredTask)
 	if err != nil {
-		logger.Error("desire-task-failed", err)
-		resp.WriteHeader(http.StatusBadRequest)
-		return
+		if models.ConvertError(err).Type != models.Error_ResourceExists {
+			logger.Error("desire-task-failed", err)
+			writeError(resp, http.StatusBadRequest, err)
+			return
+		}
+
+		statusCode, err := h.checkDuplicateTask(logger, task.TaskGuid, desiredTask)
+		if err != nil {
+			writeError(resp, statusCode, err)
+			return
+		}
 	}
 
 	resp.WriteHeader(http.StatusAccepted)
 }
+
+// checkDuplicateTask decides how to answer a retried desire request for a
+// task the BBS already has: an identical definition is treated as success.
+func (h *TaskHandler) checkDuplicateTask(logger lager.Logger, taskGuid string, desiredTask *models.TaskDefinition) (int, error) {
+	logger = logger.Session("check-duplicate-task", lager.Data{"task-guid": taskGuid})
+
+	existingTask, err := h.bbsClient.TaskByGuid(logger, taskGuid)
+	if err != nil {
+		logger.Error("failed-fetching-existing-task", err)
+		return http.StatusServiceUnavailable, err
+	}
+
+	if existingTask.Domain != cc_messages.RunningTaskDomain {
+		err := Error{
+			Type:    models.Error_ResourceConflict.String(),
+			Message: fmt.Sprintf("task %s already exists in domain %s", taskGuid, existingTask.Domain),
+		}
+		logger.Error("task-exists-in-another-domain", err, lager.Data{"domain": existingTask.Domain})
+		return http.StatusConflict, err
+	}
+
+	if !existingTask.TaskDefinition.Equal(desiredTask) {
+		conflictingFields := diffTaskDefinitions(existingTask.TaskDefinition, desiredTask)
+		err := Error{
+			Type:    models.Error_ResourceConflict.String(),
+			Message: fmt.Sprintf("task %s already exists with a different definition: %s", taskGuid, strings.Join(conflictingFields, ", ")),
+		}
+		logger.Error("task-definition-conflict", err, lager.Data{"conflicting-fields": conflictingFields})
+		return http.StatusConflict, err
+	}
+
+	logger.Info("task-already-desired")
+	return http.StatusAccepted, nil
+}
+
+// diffTaskDefinitions returns the json names of the fields that differ
+// between the two definitions.
+func diffTaskDefinitions(existing, desired *models.TaskDefinition) []string {
+	if existing == nil {
+		existing = &models.TaskDefinition{}
+	}
+	if desired == nil {
+		desired = &models.TaskDefinition{}
+	}
+
+	existingValue := reflect.ValueOf(existing).Elem()
+	desiredValue := reflect.ValueOf(desired).Elem()
+	definitionType := existingValue.Type()
+
+	fields := []string{}
+	for i := 0; i < definitionType.NumField(); i++ {
+		field := definitionType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if !fieldsEqual(existingValue.Field(i), desiredValue.Field(i)) {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				name = field.Name
+			}
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+type equaler interface {
+	Equal(that interface{}) bool
+}
+
+// fieldsEqual follows the generated Equal methods, which treat nil and empty
+// collections alike; definitions read back from the BBS never carry empty ones.
+func fieldsEqual(existing, desired reflect.Value) bool {
+	switch existing.Kind() {
+	case reflect.Slice, reflect.Map:
+		if existing.Len() == 0 && desired.Len() == 0 {
+			return true
+		}
+	}
+
+	if e, ok := existing.Interface().(equaler); ok && existing.Kind() == reflect.Ptr && !existing.IsNil() {
+		return e.Equal(desired.Interface())
+	}
+
+	return reflect.DeepEqual(existing.Interface(), desired.Interface())
+}
@@ -70,9 +70,10 @@ var _ = Describe("DesireTaskHandler", func() {
 			request.Body = ioutil.NopCloser(reader)
 		}
 
-		handler := handlers.NewTaskHandler(logger, fakeBBSClient, map[string]recipebuilder.RecipeBuilder{
-			"test": buildpackBuilder,
-		})
+		registry := recipebuilder.NewRegistry("test")
+		registry.Register("test", buildpackBuilder, nil)
+
+		handler := handlers.NewTaskHandler(logger, fakeBBSClient, registry)
 		handler.DesireTask(responseRecorder, request)
 	})
 
@@ -132,6 +133,7 @@ var _ = Describe("DesireTaskHandler", func() {
 
 			It("responds with a 400 Bad Request", func() {
 				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
 			})
 
 			It("does not send a request to bbs", func() {
@@ -145,7 +147,7 @@ var _ = Describe("DesireTaskHandler", func() {
 
 		Context("when there is an error building the task definition", func() {
 			BeforeEach(func() {
-				buildpackBuilder.BuildTaskReturns(nil, errors.New("boom!"))
+				buildpackBuilder.BuildTaskReturns(nil, recipebuilder.ErrDropletSourceMissing)
 			})
 
 			It("returns a StatusBadRequest", func() {
@@ -154,6 +156,37 @@ var _ = Describe("DesireTaskHandler", func() {
 				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
 			})
 
+			It("describes the recipe builder error in the body", func() {
+				Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+					Type:    recipebuilder.ErrDropletSourceMissing.Type,
+					Message: recipebuilder.ErrDropletSourceMissing.Message,
+				}))
+			})
+
+			It("does not send a request to bbs", func() {
+				Expect(fakeBBSClient.DesireTaskCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the image policy rejects the task's image", func() {
+			var notAllowedErr recipebuilder.Error
+
+			BeforeEach(func() {
+				notAllowedErr = recipebuilder.Error{Type: recipebuilder.ImageNotAllowed, Message: "not allowed"}
+				buildpackBuilder.BuildTaskReturns(nil, notAllowedErr)
+			})
+
+			It("returns a StatusForbidden", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("describes the policy error in the body", func() {
+				Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+					Type:    recipebuilder.ImageNotAllowed,
+					Message: "not allowed",
+				}))
+			})
+
 			It("does not send a request to bbs", func() {
 				Expect(fakeBBSClient.DesireTaskCallCount()).To(Equal(0))
 			})
@@ -170,6 +203,79 @@ var _ = Describe("DesireTaskHandler", func() {
 					Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
 				})
 			})
+
+			Context("because the task already exists", func() {
+				var existingTask *models.Task
+
+				BeforeEach(func() {
+					fakeBBSClient.DesireTaskReturns(models.ErrResourceExists)
+
+					existingDefinition := *newlyDesiredTask
+					existingDefinition.EnvironmentVariables = append([]*models.EnvironmentVariable{}, newlyDesiredTask.EnvironmentVariables...)
+					existingTask = &models.Task{
+						TaskGuid:       "the-task-guid",
+						Domain:         cc_messages.RunningTaskDomain,
+						TaskDefinition: &existingDefinition,
+					}
+					fakeBBSClient.TaskByGuidReturns(existingTask, nil)
+				})
+
+				It("looks up the existing task", func() {
+					Expect(fakeBBSClient.TaskByGuidCallCount()).To(Equal(1))
+					_, guid := fakeBBSClient.TaskByGuidArgsForCall(0)
+					Expect(guid).To(Equal("the-task-guid"))
+				})
+
+				Context("with an identical definition", func() {
+					It("responds with 202 Accepted", func() {
+						Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+					})
+
+					It("logs that the task was already desired", func() {
+						Eventually(logger.TestSink.Buffer).Should(gbytes.Say("task-already-desired"))
+					})
+				})
+
+				Context("with a conflicting definition", func() {
+					BeforeEach(func() {
+						existingTask.TaskDefinition.MemoryMb = 256
+						existingTask.TaskDefinition.LogGuid = "another-log-guid"
+					})
+
+					It("responds with 409 Conflict", func() {
+						Expect(responseRecorder.Code).To(Equal(http.StatusConflict))
+					})
+
+					It("names the conflicting fields in the body", func() {
+						responseError := errorResponse(responseRecorder)
+						Expect(responseError.Type).To(Equal("ResourceConflict"))
+						Expect(responseError.Message).To(ContainSubstring("memory_mb"))
+						Expect(responseError.Message).To(ContainSubstring("log_guid"))
+						Expect(responseError.Message).NotTo(ContainSubstring("disk_mb"))
+					})
+				})
+
+				Context("in another domain", func() {
+					BeforeEach(func() {
+						existingTask.Domain = "some-other-domain"
+					})
+
+					It("responds with 409 Conflict", func() {
+						Expect(responseRecorder.Code).To(Equal(http.StatusConflict))
+						Expect(errorResponse(responseRecorder).Message).To(ContainSubstring("some-other-domain"))
+					})
+				})
+
+				Context("when fetching the existing task fails", func() {
+					BeforeEach(func() {
+						fakeBBSClient.TaskByGuidReturns(nil, errors.New("boom!"))
+					})
+
+					It("responds with 503 Service Unavailable", func() {
+						Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+					})
+				})
+			})
 		})
 
 		Context("when the requested lifecycle does not have a corresponding builder", func() {
@@ -179,6 +285,7 @@ var _ = Describe("DesireTaskHandler", func() {
 
 			It("responds with a 400 Bad Request", func() {
 				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.UnknownLifecycle))
 			})
 
 			It("does not send a request to bbs", func() {
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+)
+
+// Error is the body every handler writes when it fails a request. Type is the
+// recipebuilder.Error type, the BBS models.Error type, or one of the request
+// validation types below.
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+func (err Error) Error() string {
+	return err.Message
+}
+
+const (
+	InvalidRequest   = "InvalidRequest"
+	MissingParameter = "MissingParameter"
+	RestartTimedOut  = "RestartTimedOut"
+	UnknownLifecycle = "UnknownLifecycle"
+)
+
+var (
+	missingParameterErr = Error{Type: MissingParameter, Message: "missing from request"}
+	invalidNumberErr    = Error{Type: InvalidRequest, Message: "not a number"}
+	invalidBatchSizeErr = Error{Type: InvalidRequest, Message: "batch_size must be a positive number"}
+	tooManyIndicesErr   = Error{Type: InvalidRequest, Message: fmt.Sprintf("at most %d indices may be killed at once", maxKillIndices)}
+
+	processGuidMismatchErr  = Error{Type: InvalidRequest, Message: "process_guid in body does not match the url"}
+	duplicateProcessGuidErr = Error{Type: InvalidRequest, Message: "process_guid appears more than once in the request"}
+)
+
+func newInvalidRequestError(err error) Error {
+	return Error{Type: InvalidRequest, Message: err.Error()}
+}
+
+func writeError(resp http.ResponseWriter, statusCode int, err error) {
+	writeJSON(resp, statusCode, ErrorResponse{Error: toError(err)})
+}
+
+func writeJSON(resp http.ResponseWriter, statusCode int, value interface{}) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(statusCode)
+	json.NewEncoder(resp).Encode(value)
+}
+
+// recipeErrorStatus is the response code for a request the recipe builder
+// rejected. Images refused by the registry policy are forbidden rather than
+// malformed.
+func recipeErrorStatus(err recipebuilder.Error) int {
+	if err.Type == recipebuilder.ImageNotAllowed {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func toError(err error) Error {
+	switch err := err.(type) {
+	case Error:
+		return err
+	case recipebuilder.Error:
+		return Error{Type: err.Type, Message: err.Message}
+	}
+
+	bbsError := models.ConvertError(err)
+	return Error{Type: bbsError.Type.String(), Message: bbsError.Message}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+)
+
+type DesiredAppResponse struct {
+	ProcessGuid   string         `json:"process_guid"`
+	Domain        string         `json:"domain"`
+	LogGuid       string         `json:"log_guid"`
+	ETag          string         `json:"etag"`
+	NumInstances  int32          `json:"num_instances"`
+	MemoryMB      int32          `json:"memory_mb"`
+	DiskMB        int32          `json:"disk_mb"`
+	RootFs        string         `json:"rootfs"`
+	Routes        *models.Routes `json:"routes,omitempty"`
+	PlacementTags []string       `json:"placement_tags,omitempty"`
+}
+
+type GetAppHandler struct {
+	bbsClient bbs.Client
+	logger    lager.Logger
+}
+
+func NewGetAppHandler(logger lager.Logger, bbsClient bbs.Client) GetAppHandler {
+	return GetAppHandler{
+		bbsClient: bbsClient,
+		logger:    logger,
+	}
+}
+
+func (h *GetAppHandler) GetApp(resp http.ResponseWriter, req *http.Request) {
+	processGuid := req.FormValue(":process_guid")
+
+	logger := h.logger.Session("get-app", lager.Data{
+		"process_guid": processGuid,
+		"method":       req.Method,
+		"request":      req.URL.String(),
+	})
+
+	logger.Debug("serving")
+	defer logger.Debug("complete")
+
+	if processGuid == "" {
+		logger.Error("missing-process-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	desiredLRP, err := h.bbsClient.DesiredLRPByProcessGuid(logger, processGuid)
+	if err != nil {
+		logger.Error("failed-fetching-desired-lrp", err)
+		writeError(resp, statusForBBSError(err), err)
+		return
+	}
+
+	writeJSON(resp, http.StatusOK, newDesiredAppResponse(desiredLRP.DesiredLRPSchedulingInfo()))
+}
+
+func newDesiredAppResponse(schedulingInfo models.DesiredLRPSchedulingInfo) DesiredAppResponse {
+	return DesiredAppResponse{
+		ProcessGuid:   schedulingInfo.ProcessGuid,
+		Domain:        schedulingInfo.Domain,
+		LogGuid:       schedulingInfo.LogGuid,
+		ETag:          schedulingInfo.Annotation,
+		NumInstances:  schedulingInfo.Instances,
+		MemoryMB:      schedulingInfo.MemoryMb,
+		DiskMB:        schedulingInfo.DiskMb,
+		RootFs:        schedulingInfo.RootFs,
+		Routes:        sanitizeRoutes(&schedulingInfo.Routes),
+		PlacementTags: schedulingInfo.PlacementTags,
+	}
+}
+
+func statusForBBSError(err error) int {
+	if models.ConvertError(err).Type == models.Error_ResourceNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,162 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/handlers"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/routing-info/cfroutes"
+	"github.com/cloudfoundry-incubator/routing-info/tcp_routes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetAppHandler", func() {
+	var (
+		logger  *lagertest.TestLogger
+		fakeBBS *fake_bbs.FakeClient
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeBBS = new(fake_bbs.FakeClient)
+
+		responseRecorder = httptest.NewRecorder()
+
+		var err error
+		request, err = http.NewRequest("GET", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{
+			":process_guid": []string{"process-guid-0"},
+		}
+
+		routes := models.Routes{}
+		fakeBBS.DesiredLRPByProcessGuidReturns(&models.DesiredLRP{
+			ProcessGuid:   "process-guid-0",
+			Domain:        "cf-apps",
+			LogGuid:       "log-guid-0",
+			Annotation:    "some-etag",
+			Instances:     3,
+			MemoryMb:      256,
+			DiskMb:        1024,
+			RootFs:        "preloaded:cflinuxfs2",
+			Routes:        &routes,
+			PlacementTags: []string{"isolation-segment"},
+		}, nil)
+	})
+
+	JustBeforeEach(func() {
+		handler := handlers.NewGetAppHandler(logger, fakeBBS)
+		handler.GetApp(responseRecorder, request)
+	})
+
+	It("fetches the desired LRP from the BBS", func() {
+		Expect(fakeBBS.DesiredLRPByProcessGuidCallCount()).To(Equal(1))
+		_, processGuid := fakeBBS.DesiredLRPByProcessGuidArgsForCall(0)
+		Expect(processGuid).To(Equal("process-guid-0"))
+	})
+
+	It("responds with the scheduling info of the desired LRP", func() {
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+		var response handlers.DesiredAppResponse
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(response).To(Equal(handlers.DesiredAppResponse{
+			ProcessGuid:  "process-guid-0",
+			Domain:       "cf-apps",
+			LogGuid:      "log-guid-0",
+			ETag:         "some-etag",
+			NumInstances: 3,
+			MemoryMB:     256,
+			DiskMB:       1024,
+			RootFs:       "preloaded:cflinuxfs2",
+			Routes: &models.Routes{
+				cfroutes.CF_ROUTER:    nil,
+				tcp_routes.TCP_ROUTER: nil,
+			},
+			PlacementTags: []string{"isolation-segment"},
+		}))
+	})
+
+	Context("when the desired LRP has ssh and nsync routes", func() {
+		var cfRouteMessage json.RawMessage
+
+		BeforeEach(func() {
+			cfRouteMessage = json.RawMessage(`[{"hostnames":["some-host"],"port":8080}]`)
+			sshRouteMessage := json.RawMessage(`{"container_port":2222,"private_key":"ssh-private-key","host_fingerprint":"fingerprint"}`)
+			versionMessage := json.RawMessage(`"buildpack-v1"`)
+
+			fakeBBS.DesiredLRPByProcessGuidReturns(&models.DesiredLRP{
+				ProcessGuid: "process-guid-0",
+				Routes: &models.Routes{
+					cfroutes.CF_ROUTER:                  &cfRouteMessage,
+					ssh_routes.DIEGO_SSH:                &sshRouteMessage,
+					recipebuilder.RecipeVersionRouteKey: &versionMessage,
+				},
+			}, nil)
+		})
+
+		It("responds with the router routes only", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).NotTo(ContainSubstring("ssh-private-key"))
+
+			var response handlers.DesiredAppResponse
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(*response.Routes).To(HaveKey(cfroutes.CF_ROUTER))
+			Expect(*response.Routes).NotTo(HaveKey(ssh_routes.DIEGO_SSH))
+			Expect(*response.Routes).NotTo(HaveKey(recipebuilder.RecipeVersionRouteKey))
+		})
+	})
+
+	Context("when the desired LRP does not exist", func() {
+		BeforeEach(func() {
+			fakeBBS.DesiredLRPByProcessGuidReturns(nil, models.ErrResourceNotFound)
+		})
+
+		It("responds with 404 Not Found", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+			Expect(errorResponse(responseRecorder).Type).To(Equal("ResourceNotFound"))
+		})
+	})
+
+	Context("when the bbs fails", func() {
+		BeforeEach(func() {
+			fakeBBS.DesiredLRPByProcessGuidReturns(nil, errors.New("oh no"))
+		})
+
+		It("responds with 503 Service Unavailable", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Context("when the process guid is missing", func() {
+		BeforeEach(func() {
+			request.Form.Del(":process_guid")
+		})
+
+		It("does not call the bbs", func() {
+			Expect(fakeBBS.DesiredLRPByProcessGuidCallCount()).To(Equal(0))
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.MissingParameter))
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+)
+
+// Instance states as Cloud Controller reports them; Diego's UNCLAIMED and
+// CLAIMED are both STARTING from CC's point of view.
+const (
+	InstanceStateStarting = "STARTING"
+	InstanceStateRunning  = "RUNNING"
+	InstanceStateCrashed  = "CRASHED"
+	InstanceStateUnknown  = "UNKNOWN"
+)
+
+type AppInstance struct {
+	ProcessGuid    string `json:"process_guid"`
+	InstanceGuid   string `json:"instance_guid"`
+	Index          int32  `json:"index"`
+	State          string `json:"state"`
+	Since          int64  `json:"since"`
+	CellId         string `json:"cell_id,omitempty"`
+	Address        string `json:"address,omitempty"`
+	CrashCount     int32  `json:"crash_count"`
+	CrashReason    string `json:"crash_reason,omitempty"`
+	PlacementError string `json:"placement_error,omitempty"`
+	Evacuating     bool   `json:"evacuating"`
+}
+
+type GetAppInstancesHandler struct {
+	bbsClient bbs.Client
+	logger    lager.Logger
+}
+
+func NewGetAppInstancesHandler(logger lager.Logger, bbsClient bbs.Client) GetAppInstancesHandler {
+	return GetAppInstancesHandler{
+		bbsClient: bbsClient,
+		logger:    logger,
+	}
+}
+
+func (h *GetAppInstancesHandler) GetAppInstances(resp http.ResponseWriter, req *http.Request) {
+	processGuid := req.FormValue(":process_guid")
+
+	logger := h.logger.Session("get-app-instances", lager.Data{
+		"process_guid": processGuid,
+		"method":       req.Method,
+		"request":      req.URL.String(),
+	})
+
+	logger.Debug("serving")
+	defer logger.Debug("complete")
+
+	if processGuid == "" {
+		logger.Error("missing-process-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	actualLRPGroups, err := h.bbsClient.ActualLRPGroupsByProcessGuid(logger, processGuid)
+	if err != nil {
+		logger.Error("failed-fetching-actual-lrp-groups", err)
+		writeError(resp, statusForBBSError(err), err)
+		return
+	}
+
+	instances := make([]AppInstance, 0, len(actualLRPGroups))
+	for _, group := range actualLRPGroups {
+		actualLRP, evacuating := group.Resolve()
+		if actualLRP == nil {
+			continue
+		}
+		instances = append(instances, newAppInstance(actualLRP, evacuating))
+	}
+
+	sort.Sort(byIndex(instances))
+
+	writeJSON(resp, http.StatusOK, instances)
+}
+
+func newAppInstance(actualLRP *models.ActualLRP, evacuating bool) AppInstance {
+	return AppInstance{
+		ProcessGuid:    actualLRP.ProcessGuid,
+		InstanceGuid:   actualLRP.InstanceGuid,
+		Index:          actualLRP.Index,
+		State:          instanceState(actualLRP.State),
+		Since:          actualLRP.Since,
+		CellId:         actualLRP.CellId,
+		Address:        actualLRP.Address,
+		CrashCount:     actualLRP.CrashCount,
+		CrashReason:    actualLRP.CrashReason,
+		PlacementError: actualLRP.PlacementError,
+		Evacuating:     evacuating,
+	}
+}
+
+func instanceState(state string) string {
+	switch state {
+	case models.ActualLRPStateUnclaimed, models.ActualLRPStateClaimed:
+		return InstanceStateStarting
+	case models.ActualLRPStateRunning:
+		return InstanceStateRunning
+	case models.ActualLRPStateCrashed:
+		return InstanceStateCrashed
+	default:
+		return InstanceStateUnknown
+	}
+}
+
+type byIndex []AppInstance
+
+func (instances byIndex) Len() int           { return len(instances) }
+func (instances byIndex) Less(i, j int) bool { return instances[i].Index < instances[j].Index }
+func (instances byIndex) Swap(i, j int)      { instances[i], instances[j] = instances[j], instances[i] }
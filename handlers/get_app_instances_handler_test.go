@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetAppInstancesHandler", func() {
+	var (
+		logger  *lagertest.TestLogger
+		fakeBBS *fake_bbs.FakeClient
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	actualLRP := func(index int32, state string) *models.ActualLRP {
+		return &models.ActualLRP{
+			ActualLRPKey:         models.NewActualLRPKey("process-guid-0", index, "cf-apps"),
+			ActualLRPInstanceKey: models.NewActualLRPInstanceKey("instance-guid", "cell-id"),
+			State:                state,
+			Since:                1234,
+		}
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeBBS = new(fake_bbs.FakeClient)
+
+		responseRecorder = httptest.NewRecorder()
+
+		var err error
+		request, err = http.NewRequest("GET", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{
+			":process_guid": []string{"process-guid-0"},
+		}
+
+		crashed := actualLRP(1, models.ActualLRPStateCrashed)
+		crashed.CrashCount = 3
+		crashed.CrashReason = "out of memory"
+
+		unclaimed := actualLRP(2, models.ActualLRPStateUnclaimed)
+		unclaimed.ActualLRPInstanceKey = models.ActualLRPInstanceKey{}
+		unclaimed.PlacementError = "insufficient resources"
+
+		fakeBBS.ActualLRPGroupsByProcessGuidReturns([]*models.ActualLRPGroup{
+			{Instance: unclaimed},
+			{Instance: crashed},
+			{Evacuating: actualLRP(0, models.ActualLRPStateRunning)},
+		}, nil)
+	})
+
+	JustBeforeEach(func() {
+		handler := handlers.NewGetAppInstancesHandler(logger, fakeBBS)
+		handler.GetAppInstances(responseRecorder, request)
+	})
+
+	It("fetches the actual LRP groups from the BBS", func() {
+		Expect(fakeBBS.ActualLRPGroupsByProcessGuidCallCount()).To(Equal(1))
+		_, processGuid := fakeBBS.ActualLRPGroupsByProcessGuidArgsForCall(0)
+		Expect(processGuid).To(Equal("process-guid-0"))
+	})
+
+	It("responds with the resolved instances ordered by index", func() {
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+		var instances []handlers.AppInstance
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &instances)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(instances).To(Equal([]handlers.AppInstance{
+			{
+				ProcessGuid:  "process-guid-0",
+				InstanceGuid: "instance-guid",
+				Index:        0,
+				State:        handlers.InstanceStateRunning,
+				Since:        1234,
+				CellId:       "cell-id",
+				Evacuating:   true,
+			},
+			{
+				ProcessGuid:  "process-guid-0",
+				InstanceGuid: "instance-guid",
+				Index:        1,
+				State:        handlers.InstanceStateCrashed,
+				Since:        1234,
+				CellId:       "cell-id",
+				CrashCount:   3,
+				CrashReason:  "out of memory",
+			},
+			{
+				ProcessGuid:    "process-guid-0",
+				Index:          2,
+				State:          handlers.InstanceStateStarting,
+				Since:          1234,
+				PlacementError: "insufficient resources",
+			},
+		}))
+	})
+
+	Context("when there are no instances", func() {
+		BeforeEach(func() {
+			fakeBBS.ActualLRPGroupsByProcessGuidReturns([]*models.ActualLRPGroup{}, nil)
+		})
+
+		It("responds with an empty list", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(MatchJSON("[]"))
+		})
+	})
+
+	Context("when the bbs fails", func() {
+		BeforeEach(func() {
+			fakeBBS.ActualLRPGroupsByProcessGuidReturns(nil, errors.New("oh no"))
+		})
+
+		It("responds with 503 Service Unavailable", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(errorResponse(responseRecorder).Message).To(Equal("oh no"))
+		})
+	})
+
+	Context("when the process guid is missing", func() {
+		BeforeEach(func() {
+			request.Form.Del(":process_guid")
+		})
+
+		It("does not call the bbs", func() {
+			Expect(fakeBBS.ActualLRPGroupsByProcessGuidCallCount()).To(Equal(0))
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
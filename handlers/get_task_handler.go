@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+// Terminal task states in CC's vocabulary; cc_messages only names the
+// states the bulker reconciles on.
+const (
+	TaskStateSucceeded = "SUCCEEDED"
+	TaskStateFailed    = "FAILED"
+)
+
+type TaskResponse struct {
+	TaskGuid      string `json:"task_guid"`
+	State         string `json:"state"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	Result        string `json:"result,omitempty"`
+	CellId        string `json:"cell_id,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+type GetTaskHandler struct {
+	logger    lager.Logger
+	bbsClient bbs.Client
+}
+
+func NewGetTaskHandler(logger lager.Logger, bbsClient bbs.Client) GetTaskHandler {
+	return GetTaskHandler{
+		logger:    logger,
+		bbsClient: bbsClient,
+	}
+}
+
+func (h *GetTaskHandler) GetTask(resp http.ResponseWriter, req *http.Request) {
+	taskGuid := req.FormValue(":task_guid")
+
+	logger := h.logger.Session("get-task", lager.Data{
+		"task_guid": taskGuid,
+		"method":    req.Method,
+		"request":   req.URL.String(),
+	})
+
+	logger.Debug("serving")
+	defer logger.Debug("complete")
+
+	if taskGuid == "" {
+		logger.Error("missing-task-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	task, err := h.bbsClient.TaskByGuid(logger, taskGuid)
+	if err != nil {
+		logger.Error("failed-fetching-task", err)
+		writeError(resp, statusForBBSError(err), err)
+		return
+	}
+
+	if task.Domain != cc_messages.RunningTaskDomain {
+		logger.Info("task-not-in-cc-domain", lager.Data{"domain": task.Domain})
+		writeError(resp, http.StatusNotFound, models.ErrResourceNotFound)
+		return
+	}
+
+	writeJSON(resp, http.StatusOK, newTaskResponse(task))
+}
+
+func newTaskResponse(task *models.Task) TaskResponse {
+	return TaskResponse{
+		TaskGuid:      task.TaskGuid,
+		State:         ccTaskState(task),
+		FailureReason: task.FailureReason,
+		Result:        task.Result,
+		CellId:        task.CellId,
+		CreatedAt:     task.CreatedAt,
+		UpdatedAt:     task.UpdatedAt,
+	}
+}
+
+// CC considers a task running from the moment it is desired, so pending
+// tasks are reported as running.
+func ccTaskState(task *models.Task) string {
+	switch task.State {
+	case models.Task_Completed, models.Task_Resolving:
+		if task.Failed {
+			return TaskStateFailed
+		}
+		return TaskStateSucceeded
+	default:
+		return cc_messages.TaskStateRunning
+	}
+}
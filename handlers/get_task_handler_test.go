@@ -0,0 +1,162 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/handlers"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetTaskHandler", func() {
+	var (
+		logger        *lagertest.TestLogger
+		fakeBBSClient *fake_bbs.FakeClient
+		task          *models.Task
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		logger = lagertest.NewTestLogger("test")
+		fakeBBSClient = new(fake_bbs.FakeClient)
+
+		task = &models.Task{
+			TaskGuid:  "some-guid",
+			Domain:    cc_messages.RunningTaskDomain,
+			State:     models.Task_Running,
+			CellId:    "cell-1",
+			CreatedAt: 100,
+			UpdatedAt: 200,
+		}
+		fakeBBSClient.TaskByGuidReturns(task, nil)
+
+		responseRecorder = httptest.NewRecorder()
+
+		request, err = http.NewRequest("GET", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{
+			":task_guid": []string{"some-guid"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		handler := handlers.NewGetTaskHandler(logger, fakeBBSClient)
+		handler.GetTask(responseRecorder, request)
+	})
+
+	decodeTask := func() handlers.TaskResponse {
+		var response handlers.TaskResponse
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+		Expect(err).NotTo(HaveOccurred())
+		return response
+	}
+
+	It("looks the task up in the BBS", func() {
+		Expect(fakeBBSClient.TaskByGuidCallCount()).To(Equal(1))
+		_, taskGuid := fakeBBSClient.TaskByGuidArgsForCall(0)
+		Expect(taskGuid).To(Equal("some-guid"))
+	})
+
+	It("responds with the task in CC's vocabulary", func() {
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		Expect(decodeTask()).To(Equal(handlers.TaskResponse{
+			TaskGuid:  "some-guid",
+			State:     cc_messages.TaskStateRunning,
+			CellId:    "cell-1",
+			CreatedAt: 100,
+			UpdatedAt: 200,
+		}))
+	})
+
+	Context("when the task is still pending", func() {
+		BeforeEach(func() {
+			task.State = models.Task_Pending
+		})
+
+		It("reports it as running", func() {
+			Expect(decodeTask().State).To(Equal(cc_messages.TaskStateRunning))
+		})
+	})
+
+	Context("when the task completed successfully", func() {
+		BeforeEach(func() {
+			task.State = models.Task_Completed
+			task.Result = "some-result"
+		})
+
+		It("reports it as succeeded", func() {
+			response := decodeTask()
+			Expect(response.State).To(Equal(handlers.TaskStateSucceeded))
+			Expect(response.Result).To(Equal("some-result"))
+		})
+	})
+
+	Context("when the task failed", func() {
+		BeforeEach(func() {
+			task.State = models.Task_Resolving
+			task.Failed = true
+			task.FailureReason = "boom"
+		})
+
+		It("reports it as failed", func() {
+			response := decodeTask()
+			Expect(response.State).To(Equal(handlers.TaskStateFailed))
+			Expect(response.FailureReason).To(Equal("boom"))
+		})
+	})
+
+	Context("when the task does not belong to CC", func() {
+		BeforeEach(func() {
+			task.Domain = "some-other-domain"
+		})
+
+		It("responds with 404 Not Found", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the task does not exist", func() {
+		BeforeEach(func() {
+			fakeBBSClient.TaskByGuidReturns(nil, models.ErrResourceNotFound)
+		})
+
+		It("responds with 404 Not Found", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+			Expect(errorResponse(responseRecorder).Type).To(Equal("ResourceNotFound"))
+		})
+	})
+
+	Context("when the bbs fails", func() {
+		BeforeEach(func() {
+			fakeBBSClient.TaskByGuidReturns(nil, errors.New("oh no"))
+		})
+
+		It("responds with 503 Service Unavailable", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Context("when the task guid is missing", func() {
+		BeforeEach(func() {
+			request.Form.Del(":task_guid")
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeBBSClient.TaskByGuidCallCount()).To(Equal(0))
+		})
+	})
+})
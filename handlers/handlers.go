@@ -6,23 +6,48 @@ import (
 	"code.cloudfoundry.org/bbs"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/nsync"
+	"code.cloudfoundry.org/nsync/bulk"
 	"code.cloudfoundry.org/nsync/recipebuilder"
 	"github.com/tedsuo/rata"
 )
 
-func New(logger lager.Logger, bbsClient bbs.Client, recipebuilders map[string]recipebuilder.RecipeBuilder) http.Handler {
+func New(
+	logger lager.Logger,
+	bbsClient bbs.Client,
+	recipebuilders *recipebuilder.Registry,
+	fetcher bulk.Fetcher,
+	ccHTTPClient *http.Client,
+	desireAppsWorkPoolSize int,
+	restartConfig RestartConfig,
+) http.Handler {
 	desireAppHandler := NewDesireAppHandler(logger, bbsClient, recipebuilders)
+	desireAppsHandler := NewDesireAppsHandler(logger, bbsClient, recipebuilders, desireAppsWorkPoolSize)
 	stopAppHandler := NewStopAppHandler(logger, bbsClient)
 	killIndexHandler := NewKillIndexHandler(logger, bbsClient)
+	resyncAppHandler := NewResyncAppHandler(logger, bbsClient, recipebuilders, fetcher, ccHTTPClient)
+	restartAppHandler := NewRestartAppHandler(logger, bbsClient, restartConfig)
+	getAppHandler := NewGetAppHandler(logger, bbsClient)
+	getAppInstancesHandler := NewGetAppInstancesHandler(logger, bbsClient)
 	taskHandler := NewTaskHandler(logger, bbsClient, recipebuilders)
 	cancelTaskHandler := NewCancelTaskHandler(logger, bbsClient)
+	getTaskHandler := NewGetTaskHandler(logger, bbsClient)
+	listTasksHandler := NewListTasksHandler(logger, bbsClient)
 
 	actions := rata.Handlers{
-		nsync.DesireAppRoute:  http.HandlerFunc(desireAppHandler.DesireApp),
-		nsync.StopAppRoute:    http.HandlerFunc(stopAppHandler.StopApp),
-		nsync.KillIndexRoute:  http.HandlerFunc(killIndexHandler.KillIndex),
-		nsync.TasksRoute:      http.HandlerFunc(taskHandler.DesireTask),
-		nsync.CancelTaskRoute: http.HandlerFunc(cancelTaskHandler.CancelTask),
+		nsync.DesireAppRoute:       http.HandlerFunc(desireAppHandler.DesireApp),
+		nsync.DesireAppsRoute:      http.HandlerFunc(desireAppsHandler.DesireApps),
+		nsync.StopAppRoute:         http.HandlerFunc(stopAppHandler.StopApp),
+		nsync.KillIndexRoute:       http.HandlerFunc(killIndexHandler.KillIndex),
+		nsync.KillIndicesRoute:     http.HandlerFunc(killIndexHandler.KillIndices),
+		nsync.ResyncAppRoute:       http.HandlerFunc(resyncAppHandler.ResyncApp),
+		nsync.RestartAppRoute:      http.HandlerFunc(restartAppHandler.RestartApp),
+		nsync.GetRestartJobRoute:   http.HandlerFunc(restartAppHandler.GetRestartJob),
+		nsync.GetAppRoute:          http.HandlerFunc(getAppHandler.GetApp),
+		nsync.GetAppInstancesRoute: http.HandlerFunc(getAppInstancesHandler.GetAppInstances),
+		nsync.TasksRoute:           http.HandlerFunc(taskHandler.DesireTask),
+		nsync.CancelTaskRoute:      http.HandlerFunc(cancelTaskHandler.CancelTask),
+		nsync.GetTaskRoute:         http.HandlerFunc(getTaskHandler.GetTask),
+		nsync.ListTasksRoute:       http.HandlerFunc(listTasksHandler.ListTasks),
 	}
 
 	handler, err := rata.NewRouter(nsync.Routes, actions)
@@ -1,6 +1,10 @@
 package handlers_test
 
 import (
+	"encoding/json"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/nsync/handlers"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +15,13 @@ func TestHandlers(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Handlers Suite")
 }
+
+func errorResponse(responseRecorder *httptest.ResponseRecorder) handlers.Error {
+	Expect(responseRecorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+	var response handlers.ErrorResponse
+	err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+	Expect(err).NotTo(HaveOccurred())
+
+	return response.Error
+}
@@ -1,20 +1,36 @@
 package handlers
 
 import (
-	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 
 	"code.cloudfoundry.org/bbs"
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/workpool"
 )
 
-var (
-	missingParameterErr = errors.New("missing from request")
-	invalidNumberErr    = errors.New("not a number")
+const (
+	maxKillIndices          = 1000
+	killIndicesWorkPoolSize = 20
+
+	// BBS indices are int32s.
+	maxKillIndex = math.MaxInt32
 )
 
+// KillIndexResult reports the outcome of retiring a single index. Status is
+// 202 when the instance was retired, 404 when it does not exist, and 503 when
+// the BBS failed.
+type KillIndexResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  *Error `json:"error,omitempty"`
+}
+
 type KillIndexHandler struct {
 	bbsClient bbs.Client
 	logger    lager.Logger
@@ -43,20 +59,20 @@ func (h *KillIndexHandler) KillIndex(resp http.ResponseWriter, req *http.Request
 
 	if processGuid == "" {
 		logger.Error("missing-process-guid", missingParameterErr)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
 		return
 	}
 
 	if indexString == "" {
 		logger.Error("missing-index", missingParameterErr)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
 		return
 	}
 
 	index, err := strconv.Atoi(indexString)
 	if err != nil {
 		logger.Error("invalid-index", invalidNumberErr)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeError(resp, http.StatusBadRequest, invalidNumberErr)
 		return
 	}
 
@@ -67,7 +83,7 @@ func (h *KillIndexHandler) KillIndex(resp http.ResponseWriter, req *http.Request
 		if bbsError.Type == models.Error_ResourceNotFound {
 			status = http.StatusNotFound
 		}
-		resp.WriteHeader(status)
+		writeError(resp, status, err)
 		return
 	}
 
@@ -95,3 +111,122 @@ func (h *KillIndexHandler) killActualLRPByProcessGuidAndIndex(logger lager.Logge
 
 	return nil
 }
+
+func (h *KillIndexHandler) KillIndices(resp http.ResponseWriter, req *http.Request) {
+	processGuid := req.FormValue(":process_guid")
+	indicesString := req.FormValue("indices")
+
+	logger := h.logger.Session("kill-indices", lager.Data{
+		"process_guid": processGuid,
+		"indices":      indicesString,
+		"method":       req.Method,
+		"request":      req.URL.String(),
+	})
+
+	logger.Info("serving")
+	defer logger.Info("complete")
+
+	if processGuid == "" {
+		logger.Error("missing-process-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	if indicesString == "" {
+		logger.Error("missing-indices", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	indices, err := parseIndices(indicesString)
+	if err != nil {
+		logger.Error("invalid-indices", err)
+		writeError(resp, http.StatusBadRequest, err)
+		return
+	}
+
+	results := make([]KillIndexResult, len(indices))
+	works := make([]func(), len(indices))
+	for i := range indices {
+		i := i
+		index := indices[i]
+
+		works[i] = func() {
+			indexLogger := logger.Session("kill-index", lager.Data{"index": index})
+
+			result := KillIndexResult{Index: index, Status: http.StatusAccepted}
+			err := h.killActualLRPByProcessGuidAndIndex(indexLogger, processGuid, index)
+			if err != nil {
+				result.Status = http.StatusServiceUnavailable
+				if models.ConvertError(err).Type == models.Error_ResourceNotFound {
+					result.Status = http.StatusNotFound
+				}
+				indexErr := toError(err)
+				result.Error = &indexErr
+			}
+
+			results[i] = result
+		}
+	}
+
+	throttler, err := workpool.NewThrottler(killIndicesWorkPoolSize, works)
+	if err != nil {
+		logger.Error("failed-constructing-throttler", err, lager.Data{"max-workers": killIndicesWorkPoolSize})
+		writeError(resp, http.StatusInternalServerError, err)
+		return
+	}
+	throttler.Work()
+
+	writeJSON(resp, http.StatusOK, results)
+}
+
+// parseIndices parses a comma separated list of indices and inclusive ranges,
+// e.g. "0,3,5-7", into sorted, distinct indices.
+func parseIndices(indicesString string) ([]int, error) {
+	seen := map[int]struct{}{}
+
+	for _, part := range strings.Split(indicesString, ",") {
+		part = strings.TrimSpace(part)
+
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || first < 0 || first > maxKillIndex {
+			return nil, invalidIndicesError(part)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil || last < first || last > maxKillIndex {
+				return nil, invalidIndicesError(part)
+			}
+		}
+
+		if last-first >= maxKillIndices {
+			return nil, tooManyIndicesErr
+		}
+
+		for index := first; ; index++ {
+			seen[index] = struct{}{}
+			if index == last {
+				break
+			}
+		}
+
+		if len(seen) > maxKillIndices {
+			return nil, tooManyIndicesErr
+		}
+	}
+
+	indices := make([]int, 0, len(seen))
+	for index := range seen {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	return indices, nil
+}
+
+func invalidIndicesError(part string) Error {
+	return Error{Type: InvalidRequest, Message: fmt.Sprintf("invalid index or range %q", part)}
+}
@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -71,6 +72,10 @@ var _ = Describe("KillIndexHandler", func() {
 
 		It("responds with a ServiceUnavailable error", func() {
 			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+				Type:    "UnknownError",
+				Message: "oh no",
+			}))
 		})
 	})
 
@@ -123,6 +128,7 @@ var _ = Describe("KillIndexHandler", func() {
 
 		It("responds with 400 Bad Request", func() {
 			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
 		})
 	})
 
@@ -141,3 +147,169 @@ var _ = Describe("KillIndexHandler", func() {
 		})
 	})
 })
+
+var _ = Describe("KillIndexHandler.KillIndices", func() {
+	var (
+		logger  *lagertest.TestLogger
+		fakeBBS *fake_bbs.FakeClient
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeBBS = new(fake_bbs.FakeClient)
+
+		responseRecorder = httptest.NewRecorder()
+
+		var err error
+		request, err = http.NewRequest("DELETE", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{
+			":process_guid": []string{"process-guid-0"},
+			"indices":       []string{"0,3,5-7"},
+		}
+
+		fakeBBS.ActualLRPGroupByProcessGuidAndIndexStub = func(logger lager.Logger, processGuid string, index int) (*models.ActualLRPGroup, error) {
+			switch index {
+			case 5:
+				return nil, models.ErrResourceNotFound
+			case 6:
+				return nil, errors.New("oh no")
+			}
+			return &models.ActualLRPGroup{
+				Instance: model_helpers.NewValidActualLRP(processGuid, int32(index)),
+			}, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		killHandler := handlers.NewKillIndexHandler(logger, fakeBBS)
+		killHandler.KillIndices(responseRecorder, request)
+	})
+
+	decodeResults := func() []handlers.KillIndexResult {
+		var results []handlers.KillIndexResult
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &results)
+		Expect(err).NotTo(HaveOccurred())
+		return results
+	}
+
+	It("retires every instance it finds", func() {
+		Expect(fakeBBS.RetireActualLRPCallCount()).To(Equal(3))
+
+		retired := []int32{}
+		for i := 0; i < fakeBBS.RetireActualLRPCallCount(); i++ {
+			_, actualLRPKey := fakeBBS.RetireActualLRPArgsForCall(i)
+			Expect(actualLRPKey.ProcessGuid).To(Equal("process-guid-0"))
+			retired = append(retired, actualLRPKey.Index)
+		}
+		Expect(retired).To(ConsistOf(int32(0), int32(3), int32(7)))
+	})
+
+	It("responds with a result per index, telling not found apart from bbs failures", func() {
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+		results := decodeResults()
+		Expect(results).To(HaveLen(5))
+
+		Expect(results[0]).To(Equal(handlers.KillIndexResult{Index: 0, Status: http.StatusAccepted}))
+		Expect(results[1]).To(Equal(handlers.KillIndexResult{Index: 3, Status: http.StatusAccepted}))
+
+		Expect(results[2].Index).To(Equal(5))
+		Expect(results[2].Status).To(Equal(http.StatusNotFound))
+		Expect(results[2].Error.Type).To(Equal("ResourceNotFound"))
+
+		Expect(results[3].Index).To(Equal(6))
+		Expect(results[3].Status).To(Equal(http.StatusServiceUnavailable))
+		Expect(results[3].Error.Type).To(Equal("UnknownError"))
+
+		Expect(results[4]).To(Equal(handlers.KillIndexResult{Index: 7, Status: http.StatusAccepted}))
+	})
+
+	Context("when retiring an instance fails", func() {
+		BeforeEach(func() {
+			request.Form.Set("indices", "0")
+			fakeBBS.RetireActualLRPReturns(errors.New("oh no"))
+		})
+
+		It("reports the failure for that index", func() {
+			results := decodeResults()
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Status).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Context("when indices overlap", func() {
+		BeforeEach(func() {
+			request.Form.Set("indices", "3, 0-3,2")
+		})
+
+		It("retires each index once, in order", func() {
+			results := decodeResults()
+			indices := []int{}
+			for _, result := range results {
+				indices = append(indices, result.Index)
+			}
+			Expect(indices).To(Equal([]int{0, 1, 2, 3}))
+			Expect(fakeBBS.RetireActualLRPCallCount()).To(Equal(4))
+		})
+	})
+
+	Context("when a range ends at the largest index", func() {
+		BeforeEach(func() {
+			request.Form.Set("indices", "2147483646-2147483647")
+		})
+
+		It("retires both indices", func() {
+			results := decodeResults()
+			Expect(results).To(HaveLen(2))
+			Expect(results[0].Index).To(Equal(2147483646))
+			Expect(results[1].Index).To(Equal(2147483647))
+		})
+	})
+
+	Context("when the indices are invalid", func() {
+		for _, indices := range []string{
+			"a", "1,", "-1", "3-1", "1-b", "0-100000",
+			"2147483648", "2147483647-2147483648", "9223372036854775806-9223372036854775807",
+		} {
+			indices := indices
+
+			Context("with "+indices, func() {
+				BeforeEach(func() {
+					request.Form.Set("indices", indices)
+				})
+
+				It("responds with 400 Bad Request without calling the bbs", func() {
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+					Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
+					Expect(fakeBBS.ActualLRPGroupByProcessGuidAndIndexCallCount()).To(Equal(0))
+				})
+			})
+		}
+	})
+
+	Context("when the indices are missing", func() {
+		BeforeEach(func() {
+			request.Form.Del("indices")
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.MissingParameter))
+		})
+	})
+
+	Context("when the process guid is missing", func() {
+		BeforeEach(func() {
+			request.Form.Del(":process_guid")
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeBBS.ActualLRPGroupByProcessGuidAndIndexCallCount()).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+type ListTasksHandler struct {
+	logger    lager.Logger
+	bbsClient bbs.Client
+}
+
+func NewListTasksHandler(logger lager.Logger, bbsClient bbs.Client) ListTasksHandler {
+	return ListTasksHandler{
+		logger:    logger,
+		bbsClient: bbsClient,
+	}
+}
+
+// ListTasks lists the tasks CC desired, optionally filtered by the CC task
+// state (`state`) and the cell they were placed on (`cell_id`).
+func (h *ListTasksHandler) ListTasks(resp http.ResponseWriter, req *http.Request) {
+	state := req.FormValue("state")
+	cellID := req.FormValue("cell_id")
+
+	logger := h.logger.Session("list-tasks", lager.Data{
+		"state":   state,
+		"cell_id": cellID,
+		"method":  req.Method,
+		"request": req.URL.String(),
+	})
+
+	logger.Debug("serving")
+	defer logger.Debug("complete")
+
+	switch state {
+	case "", cc_messages.TaskStateRunning, TaskStateSucceeded, TaskStateFailed:
+	default:
+		err := Error{Type: InvalidRequest, Message: "unknown task state " + state}
+		logger.Error("invalid-state-filter", err)
+		writeError(resp, http.StatusBadRequest, err)
+		return
+	}
+
+	var tasks []*models.Task
+	var err error
+	if cellID != "" {
+		tasks, err = h.bbsClient.TasksByCellID(logger, cellID)
+	} else {
+		tasks, err = h.bbsClient.TasksByDomain(logger, cc_messages.RunningTaskDomain)
+	}
+	if err != nil {
+		logger.Error("failed-fetching-tasks", err)
+		writeError(resp, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	responses := make([]TaskResponse, 0, len(tasks))
+	for _, task := range tasks {
+		if task.Domain != cc_messages.RunningTaskDomain {
+			continue
+		}
+
+		response := newTaskResponse(task)
+		if state != "" && response.State != state {
+			continue
+		}
+
+		responses = append(responses, response)
+	}
+
+	writeJSON(resp, http.StatusOK, responses)
+}
@@ -0,0 +1,134 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/handlers"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListTasksHandler", func() {
+	var (
+		logger        *lagertest.TestLogger
+		fakeBBSClient *fake_bbs.FakeClient
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		logger = lagertest.NewTestLogger("test")
+		fakeBBSClient = new(fake_bbs.FakeClient)
+
+		fakeBBSClient.TasksByDomainReturns([]*models.Task{
+			{TaskGuid: "running-guid", Domain: cc_messages.RunningTaskDomain, State: models.Task_Running, CellId: "cell-1"},
+			{TaskGuid: "succeeded-guid", Domain: cc_messages.RunningTaskDomain, State: models.Task_Completed},
+			{TaskGuid: "failed-guid", Domain: cc_messages.RunningTaskDomain, State: models.Task_Completed, Failed: true},
+		}, nil)
+
+		responseRecorder = httptest.NewRecorder()
+
+		request, err = http.NewRequest("GET", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{}
+	})
+
+	JustBeforeEach(func() {
+		handler := handlers.NewListTasksHandler(logger, fakeBBSClient)
+		handler.ListTasks(responseRecorder, request)
+	})
+
+	taskGuids := func() []string {
+		var response []handlers.TaskResponse
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+		Expect(err).NotTo(HaveOccurred())
+
+		guids := []string{}
+		for _, task := range response {
+			guids = append(guids, task.TaskGuid)
+		}
+		return guids
+	}
+
+	It("lists the tasks in the CC domain", func() {
+		Expect(fakeBBSClient.TasksByDomainCallCount()).To(Equal(1))
+		_, domain := fakeBBSClient.TasksByDomainArgsForCall(0)
+		Expect(domain).To(Equal(cc_messages.RunningTaskDomain))
+
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		Expect(taskGuids()).To(Equal([]string{"running-guid", "succeeded-guid", "failed-guid"}))
+	})
+
+	Context("when filtering by state", func() {
+		BeforeEach(func() {
+			request.Form.Set("state", handlers.TaskStateFailed)
+		})
+
+		It("only lists tasks in that state", func() {
+			Expect(taskGuids()).To(Equal([]string{"failed-guid"}))
+		})
+	})
+
+	Context("when filtering by an unknown state", func() {
+		BeforeEach(func() {
+			request.Form.Set("state", "NAPPING")
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
+			Expect(fakeBBSClient.TasksByDomainCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when filtering by cell", func() {
+		BeforeEach(func() {
+			request.Form.Set("cell_id", "cell-1")
+			fakeBBSClient.TasksByCellIDReturns([]*models.Task{
+				{TaskGuid: "cc-guid", Domain: cc_messages.RunningTaskDomain, State: models.Task_Running, CellId: "cell-1"},
+				{TaskGuid: "other-guid", Domain: "other-domain", State: models.Task_Running, CellId: "cell-1"},
+			}, nil)
+		})
+
+		It("lists the CC tasks on that cell", func() {
+			Expect(fakeBBSClient.TasksByCellIDCallCount()).To(Equal(1))
+			_, cellID := fakeBBSClient.TasksByCellIDArgsForCall(0)
+			Expect(cellID).To(Equal("cell-1"))
+
+			Expect(taskGuids()).To(Equal([]string{"cc-guid"}))
+		})
+	})
+
+	Context("when there are no tasks", func() {
+		BeforeEach(func() {
+			fakeBBSClient.TasksByDomainReturns(nil, nil)
+		})
+
+		It("responds with an empty list", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(MatchJSON("[]"))
+		})
+	})
+
+	Context("when the bbs fails", func() {
+		BeforeEach(func() {
+			fakeBBSClient.TasksByDomainReturns(nil, errors.New("oh no"))
+		})
+
+		It("responds with 503 Service Unavailable", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"github.com/nu7hatch/gouuid"
+)
+
+const (
+	RestartJobRunning   = "RUNNING"
+	RestartJobSucceeded = "SUCCEEDED"
+	RestartJobFailed    = "FAILED"
+)
+
+const maxFinishedRestartJobs = 100
+
+type RestartConfig struct {
+	Clock        clock.Clock
+	PollInterval time.Duration
+	BatchTimeout time.Duration
+}
+
+// RestartJob is the progress of a rolling restart as reported to CC.
+type RestartJob struct {
+	JobGuid          string  `json:"job_guid"`
+	ProcessGuid      string  `json:"process_guid"`
+	State            string  `json:"state"`
+	BatchSize        int     `json:"batch_size"`
+	TotalInstances   int     `json:"total_instances"`
+	RestartedIndices []int32 `json:"restarted_indices"`
+	CurrentBatch     []int32 `json:"current_batch"`
+	Error            *Error  `json:"error,omitempty"`
+	StartedAt        int64   `json:"started_at"`
+	UpdatedAt        int64   `json:"updated_at"`
+}
+
+// RestartAppHandler runs rolling restarts in the background. Restart jobs are
+// kept in memory by the listener that started them: they are lost when it
+// exits and other listeners do not know about them. Run a single listener, or
+// route a job's status requests to the listener that accepted it; any other
+// listener reports the job as not found.
+type RestartAppHandler struct {
+	bbsClient bbs.Client
+	config    RestartConfig
+	jobs      *restartJobs
+	logger    lager.Logger
+}
+
+func NewRestartAppHandler(logger lager.Logger, bbsClient bbs.Client, config RestartConfig) RestartAppHandler {
+	return RestartAppHandler{
+		bbsClient: bbsClient,
+		config:    config,
+		jobs:      newRestartJobs(config.Clock),
+		logger:    logger,
+	}
+}
+
+func (h *RestartAppHandler) RestartApp(resp http.ResponseWriter, req *http.Request) {
+	processGuid := req.FormValue(":process_guid")
+	batchSizeString := req.FormValue("batch_size")
+
+	logger := h.logger.Session("restart-app", lager.Data{
+		"process_guid": processGuid,
+		"batch_size":   batchSizeString,
+		"method":       req.Method,
+		"request":      req.URL.String(),
+	})
+
+	logger.Info("serving")
+	defer logger.Info("complete")
+
+	if processGuid == "" {
+		logger.Error("missing-process-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	batchSize := 1
+	if batchSizeString != "" {
+		var err error
+		batchSize, err = strconv.Atoi(batchSizeString)
+		if err != nil || batchSize < 1 {
+			logger.Error("invalid-batch-size", invalidBatchSizeErr)
+			writeError(resp, http.StatusBadRequest, invalidBatchSizeErr)
+			return
+		}
+	}
+
+	actualLRPGroups, err := h.bbsClient.ActualLRPGroupsByProcessGuid(logger, processGuid)
+	if err != nil {
+		logger.Error("failed-fetching-actual-lrp-groups", err)
+		writeError(resp, statusForBBSError(err), err)
+		return
+	}
+
+	indices := make([]int32, 0, len(actualLRPGroups))
+	for _, group := range actualLRPGroups {
+		actualLRP, _ := group.Resolve()
+		if actualLRP == nil {
+			continue
+		}
+		indices = append(indices, actualLRP.Index)
+	}
+
+	if len(indices) == 0 {
+		logger.Info("no-instances-to-restart")
+		writeError(resp, http.StatusNotFound, models.ErrResourceNotFound)
+		return
+	}
+	sort.Sort(int32s(indices))
+
+	job, err := h.jobs.start(processGuid, batchSize, len(indices))
+	if err != nil {
+		logger.Error("failed-starting-restart-job", err)
+		writeError(resp, http.StatusConflict, err)
+		return
+	}
+
+	logger.Info("started-restart-job", lager.Data{"job_guid": job.JobGuid, "indices": indices})
+	go h.restart(h.logger, job.JobGuid, processGuid, indices, batchSize)
+
+	resp.Header().Set("Location", "/v1/restarts/"+job.JobGuid)
+	writeJSON(resp, http.StatusAccepted, job)
+}
+
+func (h *RestartAppHandler) GetRestartJob(resp http.ResponseWriter, req *http.Request) {
+	jobGuid := req.FormValue(":job_guid")
+
+	logger := h.logger.Session("get-restart-job", lager.Data{
+		"job_guid": jobGuid,
+		"method":   req.Method,
+		"request":  req.URL.String(),
+	})
+
+	logger.Debug("serving")
+	defer logger.Debug("complete")
+
+	if jobGuid == "" {
+		logger.Error("missing-job-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	job, found := h.jobs.get(jobGuid)
+	if !found {
+		logger.Info("restart-job-not-found")
+		writeError(resp, http.StatusNotFound, Error{
+			Type:    models.Error_ResourceNotFound.String(),
+			Message: fmt.Sprintf("restart job %s is not known to this listener", jobGuid),
+		})
+		return
+	}
+
+	writeJSON(resp, http.StatusOK, job)
+}
+
+func (h *RestartAppHandler) restart(logger lager.Logger, jobGuid, processGuid string, indices []int32, batchSize int) {
+	logger = logger.Session("rolling-restart", lager.Data{
+		"job_guid":     jobGuid,
+		"process_guid": processGuid,
+	})
+
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	for start := 0; start < len(indices); start += batchSize {
+		end := start + batchSize
+		if end > len(indices) {
+			end = len(indices)
+		}
+		batch := indices[start:end]
+
+		h.jobs.update(jobGuid, func(job *RestartJob) {
+			job.CurrentBatch = batch
+		})
+
+		err := h.restartBatch(logger, processGuid, batch)
+		if err != nil {
+			logger.Error("failed-restarting-batch", err, lager.Data{"indices": batch})
+			h.jobs.finish(jobGuid, err)
+			return
+		}
+
+		h.jobs.update(jobGuid, func(job *RestartJob) {
+			job.RestartedIndices = append(job.RestartedIndices, batch...)
+			job.CurrentBatch = []int32{}
+		})
+	}
+
+	h.jobs.finish(jobGuid, nil)
+}
+
+func (h *RestartAppHandler) restartBatch(logger lager.Logger, processGuid string, batch []int32) error {
+	logger = logger.Session("restart-batch", lager.Data{"indices": batch})
+
+	retired := map[int32]string{}
+	for _, index := range batch {
+		actualLRPGroup, err := h.bbsClient.ActualLRPGroupByProcessGuidAndIndex(logger, processGuid, int(index))
+		if err != nil {
+			if models.ConvertError(err).Type == models.Error_ResourceNotFound {
+				logger.Info("skipping-missing-actual-lrp", lager.Data{"index": index})
+				continue
+			}
+			logger.Error("failed-fetching-actual-lrp-group", err, lager.Data{"index": index})
+			return err
+		}
+
+		var actualLRP *models.ActualLRP
+		if actualLRPGroup != nil {
+			actualLRP, _ = actualLRPGroup.Resolve()
+		}
+		if actualLRP == nil {
+			logger.Info("skipping-missing-actual-lrp", lager.Data{"index": index})
+			continue
+		}
+
+		logger.Debug("retiring-actual-lrp", lager.Data{"index": index, "instance_guid": actualLRP.InstanceGuid})
+		err = h.bbsClient.RetireActualLRP(logger, &actualLRP.ActualLRPKey)
+		if err != nil {
+			logger.Error("failed-to-retire-actual-lrp", err, lager.Data{"index": index})
+			return err
+		}
+
+		retired[index] = actualLRP.InstanceGuid
+	}
+
+	return h.waitForReplacements(logger, processGuid, retired)
+}
+
+func (h *RestartAppHandler) waitForReplacements(logger lager.Logger, processGuid string, retired map[int32]string) error {
+	timer := h.config.Clock.NewTimer(h.config.BatchTimeout)
+	defer timer.Stop()
+
+	ticker := h.config.Clock.NewTicker(h.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending := h.pendingReplacements(logger, processGuid, retired)
+		if len(pending) == 0 {
+			logger.Debug("replacements-running")
+			return nil
+		}
+
+		select {
+		case <-ticker.C():
+		case <-timer.C():
+			err := Error{
+				Type:    RestartTimedOut,
+				Message: fmt.Sprintf("timed out waiting for indices %v to be running", pending),
+			}
+			logger.Error("timed-out-waiting-for-replacements", err, lager.Data{"pending": pending})
+			return err
+		}
+	}
+}
+
+// pendingReplacements returns the retired indices that are not yet running a
+// new instance. Lookup failures count as pending so that a transient BBS error
+// only delays the restart until the batch times out.
+func (h *RestartAppHandler) pendingReplacements(logger lager.Logger, processGuid string, retired map[int32]string) []int32 {
+	pending := []int32{}
+	for index, retiredInstanceGuid := range retired {
+		actualLRPGroup, err := h.bbsClient.ActualLRPGroupByProcessGuidAndIndex(logger, processGuid, int(index))
+		if err != nil {
+			if models.ConvertError(err).Type != models.Error_ResourceNotFound {
+				logger.Error("failed-fetching-actual-lrp-group", err, lager.Data{"index": index})
+			}
+			pending = append(pending, index)
+			continue
+		}
+
+		actualLRP, evacuating := actualLRPGroup.Resolve()
+		if actualLRP == nil || evacuating ||
+			actualLRP.State != models.ActualLRPStateRunning ||
+			actualLRP.InstanceGuid == retiredInstanceGuid {
+			pending = append(pending, index)
+		}
+	}
+
+	sort.Sort(int32s(pending))
+	return pending
+}
+
+type restartJobs struct {
+	clock clock.Clock
+
+	lock     sync.Mutex
+	jobs     map[string]*RestartJob
+	active   map[string]string
+	finished []string
+}
+
+func newRestartJobs(clock clock.Clock) *restartJobs {
+	return &restartJobs{
+		clock:  clock,
+		jobs:   map[string]*RestartJob{},
+		active: map[string]string{},
+	}
+}
+
+func (r *restartJobs) start(processGuid string, batchSize, totalInstances int) (RestartJob, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if jobGuid, found := r.active[processGuid]; found {
+		return RestartJob{}, Error{
+			Type:    models.Error_ResourceConflict.String(),
+			Message: fmt.Sprintf("restart job %s is already in progress for %s", jobGuid, processGuid),
+		}
+	}
+
+	guid, err := uuid.NewV4()
+	if err != nil {
+		return RestartJob{}, err
+	}
+
+	now := r.clock.Now().UnixNano()
+	job := &RestartJob{
+		JobGuid:          guid.String(),
+		ProcessGuid:      processGuid,
+		State:            RestartJobRunning,
+		BatchSize:        batchSize,
+		TotalInstances:   totalInstances,
+		RestartedIndices: []int32{},
+		CurrentBatch:     []int32{},
+		StartedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	r.jobs[job.JobGuid] = job
+	r.active[processGuid] = job.JobGuid
+
+	return job.snapshot(), nil
+}
+
+func (r *restartJobs) get(jobGuid string) (RestartJob, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	job, found := r.jobs[jobGuid]
+	if !found {
+		return RestartJob{}, false
+	}
+	return job.snapshot(), true
+}
+
+func (r *restartJobs) update(jobGuid string, update func(*RestartJob)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	job, found := r.jobs[jobGuid]
+	if !found {
+		return
+	}
+	update(job)
+	job.UpdatedAt = r.clock.Now().UnixNano()
+}
+
+func (r *restartJobs) finish(jobGuid string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	job, found := r.jobs[jobGuid]
+	if !found {
+		return
+	}
+	job.State = RestartJobSucceeded
+	if err != nil {
+		jobErr := toError(err)
+		job.State = RestartJobFailed
+		job.Error = &jobErr
+	}
+	job.UpdatedAt = r.clock.Now().UnixNano()
+
+	delete(r.active, job.ProcessGuid)
+
+	r.finished = append(r.finished, jobGuid)
+	if len(r.finished) > maxFinishedRestartJobs {
+		delete(r.jobs, r.finished[0])
+		r.finished = r.finished[1:]
+	}
+}
+
+func (job *RestartJob) snapshot() RestartJob {
+	snapshot := *job
+	snapshot.RestartedIndices = append([]int32{}, job.RestartedIndices...)
+	snapshot.CurrentBatch = append([]int32{}, job.CurrentBatch...)
+	return snapshot
+}
+
+type int32s []int32
+
+func (s int32s) Len() int           { return len(s) }
+func (s int32s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int32s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
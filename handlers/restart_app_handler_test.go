@@ -0,0 +1,350 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RestartAppHandler", func() {
+	const (
+		pollInterval = time.Second
+		batchTimeout = time.Minute
+	)
+
+	var (
+		logger    *lagertest.TestLogger
+		fakeBBS   *fake_bbs.FakeClient
+		fakeClock *fakeclock.FakeClock
+		handler   handlers.RestartAppHandler
+
+		lock       sync.Mutex
+		actualLRPs map[int32]*models.ActualLRP
+	)
+
+	actualLRP := func(index int32, instanceGuid, state string) *models.ActualLRP {
+		return &models.ActualLRP{
+			ActualLRPKey:         models.NewActualLRPKey("process-guid", index, "cf-apps"),
+			ActualLRPInstanceKey: models.NewActualLRPInstanceKey(instanceGuid, "cell-id"),
+			State:                state,
+		}
+	}
+
+	bringUp := func(index int32) {
+		lock.Lock()
+		defer lock.Unlock()
+		actualLRPs[index] = actualLRP(index, fmt.Sprintf("new-guid-%d", index), models.ActualLRPStateRunning)
+	}
+
+	poll := func() {
+		Eventually(fakeClock.WatcherCount).Should(Equal(2))
+		fakeClock.Increment(pollInterval)
+	}
+
+	restartApp := func(processGuid, batchSize string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("POST", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{":process_guid": []string{processGuid}}
+		if batchSize != "" {
+			request.Form.Set("batch_size", batchSize)
+		}
+
+		responseRecorder := httptest.NewRecorder()
+		handler.RestartApp(responseRecorder, request)
+		return responseRecorder
+	}
+
+	getRestartJob := func(jobGuid string) (int, handlers.RestartJob) {
+		request, err := http.NewRequest("GET", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{":job_guid": []string{jobGuid}}
+
+		responseRecorder := httptest.NewRecorder()
+		handler.GetRestartJob(responseRecorder, request)
+
+		var job handlers.RestartJob
+		if responseRecorder.Code == http.StatusOK {
+			err = json.Unmarshal(responseRecorder.Body.Bytes(), &job)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		return responseRecorder.Code, job
+	}
+
+	decodeJob := func(responseRecorder *httptest.ResponseRecorder) handlers.RestartJob {
+		var job handlers.RestartJob
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &job)
+		Expect(err).NotTo(HaveOccurred())
+		return job
+	}
+
+	retiredIndex := func(i int) int32 {
+		_, key := fakeBBS.RetireActualLRPArgsForCall(i)
+		return key.Index
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeBBS = new(fake_bbs.FakeClient)
+		fakeClock = fakeclock.NewFakeClock(time.Unix(0, 1000))
+
+		actualLRPs = map[int32]*models.ActualLRP{}
+		for index := int32(0); index < 3; index++ {
+			actualLRPs[index] = actualLRP(index, fmt.Sprintf("old-guid-%d", index), models.ActualLRPStateRunning)
+		}
+
+		fakeBBS.ActualLRPGroupsByProcessGuidStub = func(logger lager.Logger, processGuid string) ([]*models.ActualLRPGroup, error) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			groups := []*models.ActualLRPGroup{}
+			for index := int32(2); index >= 0; index-- {
+				groups = append(groups, &models.ActualLRPGroup{Instance: actualLRPs[index]})
+			}
+			return groups, nil
+		}
+
+		fakeBBS.ActualLRPGroupByProcessGuidAndIndexStub = func(logger lager.Logger, processGuid string, index int) (*models.ActualLRPGroup, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			return &models.ActualLRPGroup{Instance: actualLRPs[int32(index)]}, nil
+		}
+
+		fakeBBS.RetireActualLRPStub = func(logger lager.Logger, key *models.ActualLRPKey) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			unclaimed := actualLRP(key.Index, "", models.ActualLRPStateUnclaimed)
+			unclaimed.ActualLRPInstanceKey = models.ActualLRPInstanceKey{}
+			actualLRPs[key.Index] = unclaimed
+			return nil
+		}
+
+		handler = handlers.NewRestartAppHandler(logger, fakeBBS, handlers.RestartConfig{
+			Clock:        fakeClock,
+			PollInterval: pollInterval,
+			BatchTimeout: batchTimeout,
+		})
+	})
+
+	It("responds with 202 Accepted and the new job", func() {
+		responseRecorder := restartApp("process-guid", "")
+		Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+
+		job := decodeJob(responseRecorder)
+		Expect(job.JobGuid).NotTo(BeEmpty())
+		Expect(job.ProcessGuid).To(Equal("process-guid"))
+		Expect(job.State).To(Equal(handlers.RestartJobRunning))
+		Expect(job.BatchSize).To(Equal(1))
+		Expect(job.TotalInstances).To(Equal(3))
+		Expect(job.StartedAt).To(Equal(fakeClock.Now().UnixNano()))
+
+		Expect(responseRecorder.Header().Get("Location")).To(Equal("/v1/restarts/" + job.JobGuid))
+	})
+
+	It("retires one index at a time, waiting for each replacement to run", func() {
+		restartApp("process-guid", "")
+
+		Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(1))
+		Expect(retiredIndex(0)).To(Equal(int32(0)))
+
+		poll()
+		Consistently(fakeBBS.RetireActualLRPCallCount).Should(Equal(1))
+
+		bringUp(0)
+		poll()
+		Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(2))
+		Expect(retiredIndex(1)).To(Equal(int32(1)))
+	})
+
+	It("reports progress through the job status", func() {
+		job := decodeJob(restartApp("process-guid", ""))
+
+		Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(1))
+		_, status := getRestartJob(job.JobGuid)
+		Expect(status.CurrentBatch).To(Equal([]int32{0}))
+		Expect(status.RestartedIndices).To(BeEmpty())
+
+		for index := int32(0); index < 3; index++ {
+			Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(int(index) + 1))
+			bringUp(index)
+			poll()
+		}
+
+		Eventually(func() string {
+			_, status := getRestartJob(job.JobGuid)
+			return status.State
+		}).Should(Equal(handlers.RestartJobSucceeded))
+
+		_, status = getRestartJob(job.JobGuid)
+		Expect(status.RestartedIndices).To(Equal([]int32{0, 1, 2}))
+		Expect(status.CurrentBatch).To(BeEmpty())
+		Expect(status.Error).To(BeNil())
+	})
+
+	Context("when a batch size is given", func() {
+		It("retires that many indices at a time", func() {
+			restartApp("process-guid", "2")
+
+			Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(2))
+			Expect([]int32{retiredIndex(0), retiredIndex(1)}).To(Equal([]int32{0, 1}))
+
+			bringUp(0)
+			poll()
+			Consistently(fakeBBS.RetireActualLRPCallCount).Should(Equal(2))
+
+			bringUp(1)
+			poll()
+			Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(3))
+			Expect(retiredIndex(2)).To(Equal(int32(2)))
+		})
+	})
+
+	Context("when a replacement does not come up in time", func() {
+		It("fails the job", func() {
+			job := decodeJob(restartApp("process-guid", ""))
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(2))
+			fakeClock.Increment(batchTimeout)
+
+			Eventually(func() string {
+				_, status := getRestartJob(job.JobGuid)
+				return status.State
+			}).Should(Equal(handlers.RestartJobFailed))
+
+			_, status := getRestartJob(job.JobGuid)
+			Expect(status.Error.Type).To(Equal(handlers.RestartTimedOut))
+			Expect(status.RestartedIndices).To(BeEmpty())
+			Expect(fakeBBS.RetireActualLRPCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when retiring an instance fails", func() {
+		BeforeEach(func() {
+			fakeBBS.RetireActualLRPStub = nil
+			fakeBBS.RetireActualLRPReturns(models.ErrResourceNotFound)
+		})
+
+		It("fails the job with the BBS error", func() {
+			job := decodeJob(restartApp("process-guid", ""))
+
+			Eventually(func() string {
+				_, status := getRestartJob(job.JobGuid)
+				return status.State
+			}).Should(Equal(handlers.RestartJobFailed))
+
+			_, status := getRestartJob(job.JobGuid)
+			Expect(status.Error.Type).To(Equal("ResourceNotFound"))
+		})
+	})
+
+	Context("when a restart is already in progress for the app", func() {
+		It("responds with 409 Conflict", func() {
+			Expect(restartApp("process-guid", "").Code).To(Equal(http.StatusAccepted))
+
+			responseRecorder := restartApp("process-guid", "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusConflict))
+			Expect(errorResponse(responseRecorder).Type).To(Equal("ResourceConflict"))
+		})
+	})
+
+	Context("when the batch size is invalid", func() {
+		It("responds with 400 Bad Request", func() {
+			responseRecorder := restartApp("process-guid", "0")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.InvalidRequest))
+			Expect(fakeBBS.ActualLRPGroupsByProcessGuidCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the process guid is missing", func() {
+		It("responds with 400 Bad Request", func() {
+			responseRecorder := restartApp("", "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.MissingParameter))
+		})
+	})
+
+	Context("when the app has no instances", func() {
+		BeforeEach(func() {
+			fakeBBS.ActualLRPGroupsByProcessGuidStub = nil
+			fakeBBS.ActualLRPGroupsByProcessGuidReturns([]*models.ActualLRPGroup{}, nil)
+		})
+
+		It("responds with 404 Not Found", func() {
+			Expect(restartApp("process-guid", "").Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when fetching the instances fails", func() {
+		BeforeEach(func() {
+			fakeBBS.ActualLRPGroupsByProcessGuidStub = nil
+			fakeBBS.ActualLRPGroupsByProcessGuidReturns(nil, errors.New("oh no"))
+		})
+
+		It("responds with 503 Service Unavailable", func() {
+			Expect(restartApp("process-guid", "").Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Context("when an instance is gone by the time its batch is restarted", func() {
+		BeforeEach(func() {
+			fakeBBS.ActualLRPGroupByProcessGuidAndIndexStub = func(logger lager.Logger, processGuid string, index int) (*models.ActualLRPGroup, error) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				switch index {
+				case 0:
+					return &models.ActualLRPGroup{}, nil
+				case 1:
+					return nil, models.ErrResourceNotFound
+				}
+				return &models.ActualLRPGroup{Instance: actualLRPs[int32(index)]}, nil
+			}
+		})
+
+		It("skips it and restarts the rest", func() {
+			job := decodeJob(restartApp("process-guid", ""))
+
+			Eventually(fakeBBS.RetireActualLRPCallCount).Should(Equal(1))
+			Expect(retiredIndex(0)).To(Equal(int32(2)))
+
+			bringUp(2)
+			poll()
+
+			Eventually(func() string {
+				_, status := getRestartJob(job.JobGuid)
+				return status.State
+			}).Should(Equal(handlers.RestartJobSucceeded))
+			Expect(fakeBBS.RetireActualLRPCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when the restart job does not exist", func() {
+		It("responds with 404 Not Found", func() {
+			request, err := http.NewRequest("GET", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			request.Form = url.Values{":job_guid": []string{"unknown-job-guid"}}
+
+			responseRecorder := httptest.NewRecorder()
+			handler.GetRestartJob(responseRecorder, request)
+
+			Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+			Expect(errorResponse(responseRecorder).Type).To(Equal("ResourceNotFound"))
+		})
+	})
+})
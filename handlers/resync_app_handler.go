@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nsync/bulk"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+type ResyncAppHandler struct {
+	desireAppHandler DesireAppHandler
+	fetcher          bulk.Fetcher
+	httpClient       *http.Client
+	bbsClient        bbs.Client
+	logger           lager.Logger
+}
+
+func NewResyncAppHandler(
+	logger lager.Logger,
+	bbsClient bbs.Client,
+	builders *recipebuilder.Registry,
+	fetcher bulk.Fetcher,
+	httpClient *http.Client,
+) ResyncAppHandler {
+	return ResyncAppHandler{
+		desireAppHandler: NewDesireAppHandler(logger, bbsClient, builders),
+		fetcher:          fetcher,
+		httpClient:       httpClient,
+		bbsClient:        bbsClient,
+		logger:           logger,
+	}
+}
+
+func (h *ResyncAppHandler) ResyncApp(resp http.ResponseWriter, req *http.Request) {
+	processGuid := req.FormValue(":process_guid")
+
+	logger := h.logger.Session("resync-app", lager.Data{
+		"process_guid": processGuid,
+		"method":       req.Method,
+		"request":      req.URL.String(),
+	})
+
+	logger.Info("serving")
+	defer logger.Info("complete")
+
+	if processGuid == "" {
+		logger.Error("missing-process-guid", missingParameterErr)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
+		return
+	}
+
+	desiredApp, found, err := h.fetchDesiredApp(logger, processGuid)
+	if err != nil {
+		writeError(resp, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	var statusCode int
+	if found {
+		statusCode, err = h.desireAppHandler.createOrUpdateDesiredApp(logger, desiredApp)
+	} else {
+		statusCode, err = h.removeDesiredApp(logger, processGuid)
+	}
+
+	if err != nil {
+		writeError(resp, statusCode, err)
+		return
+	}
+
+	resp.WriteHeader(statusCode)
+}
+
+func (h *ResyncAppHandler) fetchDesiredApp(logger lager.Logger, processGuid string) (recipebuilder.DesireAppRequest, bool, error) {
+	logger = logger.Session("fetch-desired-app-from-cc")
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	fingerprints := make(chan []cc_messages.CCDesiredAppFingerprint, 1)
+	fingerprints <- []cc_messages.CCDesiredAppFingerprint{{ProcessGuid: processGuid}}
+	close(fingerprints)
+
+	desiredAppsCh, errorCh := h.fetcher.FetchDesiredApps(logger, cancel, h.httpClient, fingerprints)
+
+	var desiredApps []recipebuilder.DesireAppRequest
+	for batch := range desiredAppsCh {
+		desiredApps = append(desiredApps, batch...)
+	}
+
+	for err := range errorCh {
+		logger.Error("failed-fetching-desired-app", err)
+		return recipebuilder.DesireAppRequest{}, false, err
+	}
+
+	for _, desiredApp := range desiredApps {
+		if desiredApp.ProcessGuid == processGuid {
+			logger.Debug("fetched-desired-app", lager.Data{"etag": desiredApp.ETag})
+			return desiredApp, true, nil
+		}
+	}
+
+	logger.Info("desired-app-not-found")
+	return recipebuilder.DesireAppRequest{}, false, nil
+}
+
+func (h *ResyncAppHandler) removeDesiredApp(logger lager.Logger, processGuid string) (int, error) {
+	logger.Debug("removing-desired-lrp")
+	err := h.bbsClient.RemoveDesiredLRP(logger, processGuid)
+	if err != nil {
+		bbsError := models.ConvertError(err)
+		if bbsError.Type == models.Error_ResourceNotFound {
+			logger.Info("desired-lrp-not-found")
+			return http.StatusNotFound, err
+		}
+
+		logger.Error("failed-to-remove-desired-lrp", err)
+		return http.StatusServiceUnavailable, err
+	}
+	logger.Debug("removed-desired-lrp")
+
+	return http.StatusAccepted, nil
+}
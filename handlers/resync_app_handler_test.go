@@ -0,0 +1,219 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/bbs/fake_bbs"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/bulk/fakes"
+	"code.cloudfoundry.org/nsync/handlers"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/cloudfoundry/dropsonde/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResyncAppHandler", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeBBS          *fake_bbs.FakeClient
+		fetcher          *fakes.FakeFetcher
+		buildpackBuilder *fakes.FakeRecipeBuilder
+		httpClient       *http.Client
+
+		desiredApps []recipebuilder.DesireAppRequest
+		fetchErr    error
+
+		request          *http.Request
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		logger = lagertest.NewTestLogger("test")
+		fakeBBS = new(fake_bbs.FakeClient)
+		fetcher = new(fakes.FakeFetcher)
+		buildpackBuilder = new(fakes.FakeRecipeBuilder)
+		httpClient = &http.Client{}
+
+		metrics.Initialize(fake.NewFakeMetricSender(), nil)
+
+		desiredApps = []recipebuilder.DesireAppRequest{
+			{
+				DesireAppRequestFromCC: cc_messages.DesireAppRequestFromCC{
+					ProcessGuid:  "some-guid",
+					DropletUri:   "http://the-droplet.uri.com",
+					Stack:        "some-stack",
+					StartCommand: "the-start-command",
+					NumInstances: 2,
+					ETag:         "some-etag",
+				},
+			},
+		}
+		fetchErr = nil
+
+		fetcher.FetchDesiredAppsStub = func(
+			logger lager.Logger,
+			cancel <-chan struct{},
+			httpClient *http.Client,
+			fingerprints <-chan []cc_messages.CCDesiredAppFingerprint,
+		) (<-chan []recipebuilder.DesireAppRequest, <-chan error) {
+			for range fingerprints {
+			}
+
+			desiredAppsCh := make(chan []recipebuilder.DesireAppRequest, 1)
+			errorsCh := make(chan error, 1)
+
+			if fetchErr != nil {
+				errorsCh <- fetchErr
+			} else {
+				desiredAppsCh <- desiredApps
+			}
+
+			close(desiredAppsCh)
+			close(errorsCh)
+
+			return desiredAppsCh, errorsCh
+		}
+
+		fakeBBS.DesiredLRPByProcessGuidReturns(nil, models.ErrResourceNotFound)
+		buildpackBuilder.BuildReturns(&models.DesiredLRP{ProcessGuid: "some-guid"}, nil)
+
+		responseRecorder = httptest.NewRecorder()
+
+		request, err = http.NewRequest("POST", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Form = url.Values{
+			":process_guid": []string{"some-guid"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		registry := recipebuilder.NewRegistry("buildpack")
+		registry.Register("buildpack", buildpackBuilder, nil)
+
+		handler := handlers.NewResyncAppHandler(logger, fakeBBS, registry, fetcher, httpClient)
+		handler.ResyncApp(responseRecorder, request)
+	})
+
+	It("fetches only the requested app from CC", func() {
+		Expect(fetcher.FetchDesiredAppsCallCount()).To(Equal(1))
+
+		_, _, client, _ := fetcher.FetchDesiredAppsArgsForCall(0)
+		Expect(client).To(Equal(httpClient))
+	})
+
+	Context("when the desired LRP does not exist in the BBS", func() {
+		It("desires the LRP built from the CC state", func() {
+			Expect(buildpackBuilder.BuildCallCount()).To(Equal(1))
+			Expect(*buildpackBuilder.BuildArgsForCall(0)).To(Equal(desiredApps[0]))
+
+			Expect(fakeBBS.DesireLRPCallCount()).To(Equal(1))
+			_, desiredLRP := fakeBBS.DesireLRPArgsForCall(0)
+			Expect(desiredLRP.ProcessGuid).To(Equal("some-guid"))
+		})
+
+		It("responds with 202 Accepted", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+		})
+	})
+
+	Context("when the desired LRP already exists in the BBS", func() {
+		BeforeEach(func() {
+			fakeBBS.DesiredLRPByProcessGuidReturns(&models.DesiredLRP{
+				ProcessGuid: "some-guid",
+				Annotation:  "old-etag",
+			}, nil)
+		})
+
+		It("updates the LRP from the CC state", func() {
+			Expect(fakeBBS.DesireLRPCallCount()).To(Equal(0))
+			Expect(fakeBBS.UpdateDesiredLRPCallCount()).To(Equal(1))
+
+			_, processGuid, update := fakeBBS.UpdateDesiredLRPArgsForCall(0)
+			Expect(processGuid).To(Equal("some-guid"))
+			Expect(*update.Instances).To(BeEquivalentTo(2))
+			Expect(*update.Annotation).To(Equal("some-etag"))
+		})
+
+		It("responds with 202 Accepted", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+		})
+	})
+
+	Context("when CC no longer knows about the app", func() {
+		BeforeEach(func() {
+			desiredApps = []recipebuilder.DesireAppRequest{}
+		})
+
+		It("removes the desired LRP", func() {
+			Expect(fakeBBS.RemoveDesiredLRPCallCount()).To(Equal(1))
+			_, processGuid := fakeBBS.RemoveDesiredLRPArgsForCall(0)
+			Expect(processGuid).To(Equal("some-guid"))
+		})
+
+		It("responds with 202 Accepted", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusAccepted))
+		})
+
+		Context("when the BBS does not know about it either", func() {
+			BeforeEach(func() {
+				fakeBBS.RemoveDesiredLRPReturns(models.ErrResourceNotFound)
+			})
+
+			It("responds with 404 Not Found", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when removing the desired LRP fails", func() {
+			BeforeEach(func() {
+				fakeBBS.RemoveDesiredLRPReturns(errors.New("oh no"))
+			})
+
+			It("responds with 503 Service Unavailable", func() {
+				Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			})
+		})
+	})
+
+	Context("when fetching the app from CC fails", func() {
+		BeforeEach(func() {
+			fetchErr = errors.New("cc is down")
+		})
+
+		It("does not touch the BBS", func() {
+			Expect(fakeBBS.DesireLRPCallCount()).To(Equal(0))
+			Expect(fakeBBS.UpdateDesiredLRPCallCount()).To(Equal(0))
+			Expect(fakeBBS.RemoveDesiredLRPCallCount()).To(Equal(0))
+		})
+
+		It("responds with 503 Service Unavailable", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(errorResponse(responseRecorder).Message).To(Equal("cc is down"))
+		})
+	})
+
+	Context("when the process guid is missing", func() {
+		BeforeEach(func() {
+			request.Form.Del(":process_guid")
+		})
+
+		It("does not fetch from CC", func() {
+			Expect(fetcher.FetchDesiredAppsCallCount()).To(Equal(0))
+		})
+
+		It("responds with 400 Bad Request", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
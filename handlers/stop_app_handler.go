@@ -31,7 +31,7 @@ func (h *StopAppHandler) StopApp(resp http.ResponseWriter, req *http.Request) {
 
 	if processGuid == "" {
 		logger.Error("missing-process-guid", missingParameterErr)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeError(resp, http.StatusBadRequest, missingParameterErr)
 		return
 	}
 
@@ -45,11 +45,11 @@ func (h *StopAppHandler) StopApp(resp http.ResponseWriter, req *http.Request) {
 
 		bbsError := models.ConvertError(err)
 		if bbsError.Type == models.Error_ResourceNotFound {
-			resp.WriteHeader(http.StatusNotFound)
+			writeError(resp, http.StatusNotFound, err)
 			return
 		}
 
-		resp.WriteHeader(http.StatusServiceUnavailable)
+		writeError(resp, http.StatusServiceUnavailable, err)
 		return
 	}
 	logger.Debug("removed-desired-lrp")
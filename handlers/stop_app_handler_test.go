@@ -74,6 +74,7 @@ var _ = Describe("StopAppHandler", func() {
 
 		It("responds with 400 Bad Request", func() {
 			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorResponse(responseRecorder).Type).To(Equal(handlers.MissingParameter))
 		})
 	})
 
@@ -85,5 +86,12 @@ var _ = Describe("StopAppHandler", func() {
 		It("responds with a 404", func() {
 			Expect(responseRecorder.Code).To(Equal(http.StatusNotFound))
 		})
+
+		It("describes the BBS error in the body", func() {
+			Expect(errorResponse(responseRecorder)).To(Equal(handlers.Error{
+				Type:    models.ErrResourceNotFound.Type.String(),
+				Message: models.ErrResourceNotFound.Message,
+			}))
+		})
 	})
 })
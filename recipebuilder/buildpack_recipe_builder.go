@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	"time"
 
 	"code.cloudfoundry.org/bbs/models"
 	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
@@ -14,14 +13,16 @@ import (
 )
 
 type BuildpackRecipeBuilder struct {
-	logger lager.Logger
-	config Config
+	logger         lager.Logger
+	config         Config
+	recipeVersions map[string]string
 }
 
 func NewBuildpackRecipeBuilder(logger lager.Logger, config Config) *BuildpackRecipeBuilder {
 	return &BuildpackRecipeBuilder{
-		logger: logger,
-		config: config,
+		logger:         logger,
+		config:         config,
+		recipeVersions: recipeVersions("buildpack", config, true),
 	}
 }
 
@@ -111,7 +112,7 @@ func (b *BuildpackRecipeBuilder) BuildTask(task *cc_messages.TaskRequestFromCC)
 	return taskDefinition, nil
 }
 
-func (b *BuildpackRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error) {
+func (b *BuildpackRecipeBuilder) Build(desiredApp *DesireAppRequest) (*models.DesiredLRP, error) {
 	lrpGuid := desiredApp.ProcessGuid
 
 	buildLogger := b.logger.Session("message-builder")
@@ -159,17 +160,12 @@ func (b *BuildpackRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestF
 		CacheKey: fmt.Sprintf("%s-lifecycle", strings.Replace(lifecycle, "/", "-", 1)),
 	})
 
-	desiredAppPorts, err := b.ExtractExposedPorts(desiredApp)
+	desiredAppPorts, err := b.ExtractExposedPorts(&desiredApp.DesireAppRequestFromCC)
 	if err != nil {
 		return nil, err
 	}
 
-	switch desiredApp.HealthCheckType {
-	case cc_messages.PortHealthCheckType, cc_messages.UnspecifiedHealthCheckType:
-		monitor = models.Timeout(getParallelAction(desiredAppPorts, "vcap", ""), 10*time.Minute)
-	case cc_messages.HTTPHealthCheckType:
-		monitor = models.Timeout(getParallelAction(desiredAppPorts, "vcap", desiredApp.HealthCheckHTTPEndpoint), 10*time.Minute)
-	}
+	monitor = b.config.HealthCheck.monitor(desiredApp, desiredAppPorts, "vcap")
 
 	downloadAction := &models.DownloadAction{
 		From:     desiredApp.DropletUri,
@@ -250,6 +246,8 @@ func (b *BuildpackRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestF
 		desiredAppPorts = append(desiredAppPorts, DefaultSSHPort)
 	}
 
+	setRecipeVersion(desiredAppRoutingInfo, b.recipeVersions[lifecycle])
+
 	setupAction := models.Serial(setup...)
 	actionAction := models.Codependent(actions...)
 
@@ -330,3 +328,7 @@ func convertVolumeMounts(mounts []*cc_messages.VolumeMount) []*models.VolumeMoun
 func (b BuildpackRecipeBuilder) ExtractExposedPorts(desiredApp *cc_messages.DesireAppRequestFromCC) ([]uint32, error) {
 	return getDesiredAppPorts(desiredApp.Ports), nil
 }
+
+func (b *BuildpackRecipeBuilder) RecipeVersions() map[string]string {
+	return b.recipeVersions
+}
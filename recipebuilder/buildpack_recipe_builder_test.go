@@ -102,9 +102,11 @@ var _ = Describe("Buildpack Recipe Builder", func() {
 
 		cfRoutes := json.RawMessage([]byte(`[{"hostnames":["route1","route2"],"port":8080}]`))
 		tcpRoutes := json.RawMessage([]byte("[]"))
+		recipeVersion := json.RawMessage([]byte(`"` + builder.RecipeVersions()["buildpack/some-stack"] + `"`))
 		expectedRoutes = models.Routes{
-			cfroutes.CF_ROUTER:    &cfRoutes,
-			tcp_routes.TCP_ROUTER: &tcpRoutes,
+			cfroutes.CF_ROUTER:                  &cfRoutes,
+			tcp_routes.TCP_ROUTER:               &tcpRoutes,
+			recipebuilder.RecipeVersionRouteKey: &recipeVersion,
 		}
 
 		desiredCCVolumeMounts = []*cc_messages.VolumeMount{{
@@ -130,7 +132,7 @@ var _ = Describe("Buildpack Recipe Builder", func() {
 		var desiredLRP *models.DesiredLRP
 
 		JustBeforeEach(func() {
-			desiredLRP, err = builder.Build(&desiredAppReq)
+			desiredLRP, err = builder.Build(&recipebuilder.DesireAppRequest{DesireAppRequestFromCC: desiredAppReq})
 		})
 
 		Describe("when no droplet hash is set", func() {
@@ -514,11 +516,13 @@ var _ = Describe("Buildpack Recipe Builder", func() {
 					cfRouteMessage := json.RawMessage(cfRoutePayload)
 					tcpRouteMessage := json.RawMessage([]byte("[]"))
 					sshRouteMessage := json.RawMessage(sshRoutePayload)
+					recipeVersionMessage := json.RawMessage([]byte(`"` + builder.RecipeVersions()["buildpack/some-stack"] + `"`))
 
 					Expect(desiredLRP.Routes).To(Equal(&models.Routes{
-						cfroutes.CF_ROUTER:    &cfRouteMessage,
-						tcp_routes.TCP_ROUTER: &tcpRouteMessage,
-						routes.DIEGO_SSH:      &sshRouteMessage,
+						cfroutes.CF_ROUTER:                  &cfRouteMessage,
+						tcp_routes.TCP_ROUTER:               &tcpRouteMessage,
+						routes.DIEGO_SSH:                    &sshRouteMessage,
+						recipebuilder.RecipeVersionRouteKey: &recipeVersionMessage,
 					}))
 				})
 
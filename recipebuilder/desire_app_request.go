@@ -0,0 +1,22 @@
+package recipebuilder
+
+import "code.cloudfoundry.org/runtimeschema/cc_messages"
+
+// DesireAppRequest is CC's desire message for an app together with the
+// fields CC sends alongside it that cc_messages does not carry.
+type DesireAppRequest struct {
+	cc_messages.DesireAppRequestFromCC
+	AppHealthCheck
+
+	// PinnedImage is the pin recorded on the app's existing LRP. Build keeps
+	// its digest while CC still desires the same image, rather than resolving
+	// the tag again.
+	PinnedImage *PinnedImage `json:"-"`
+}
+
+// AppHealthCheck tunes the health check of a single app. Unset fields fall
+// back to the builder's HealthCheckConfig.
+type AppHealthCheck struct {
+	HealthCheckIntervalInSeconds          uint `json:"health_check_interval_in_seconds,omitempty"`
+	HealthCheckInvocationTimeoutInSeconds uint `json:"health_check_invocation_timeout_in_seconds,omitempty"`
+}
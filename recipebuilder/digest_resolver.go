@@ -0,0 +1,338 @@
+package recipebuilder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	DockerHubRegistryHost = "registry-1.docker.io"
+	DefaultDockerTag      = "latest"
+)
+
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// RegistryImage is a tagged image on a registry. An empty Host means the
+// default registry.
+type RegistryImage struct {
+	Host       string
+	Repository string
+	Tag        string
+}
+
+// DigestResolver looks up the digest that an image tag currently points at.
+type DigestResolver interface {
+	ResolveDigest(logger lager.Logger, image RegistryImage, username, password string) (string, error)
+}
+
+// RegistryDigestResolver resolves digests against the Docker Registry v2 API.
+// Registries listed as insecure are contacted over plain http.
+type RegistryDigestResolver struct {
+	httpClient         *http.Client
+	insecureRegistries map[string]bool
+}
+
+func NewRegistryDigestResolver(httpClient *http.Client, insecureRegistries []string) *RegistryDigestResolver {
+	insecure := make(map[string]bool, len(insecureRegistries))
+	for _, registry := range insecureRegistries {
+		insecure[registry] = true
+	}
+
+	return &RegistryDigestResolver{
+		httpClient:         httpClient,
+		insecureRegistries: insecure,
+	}
+}
+
+func (r *RegistryDigestResolver) ResolveDigest(logger lager.Logger, image RegistryImage, username, password string) (string, error) {
+	logger = logger.Session("resolve-digest", lager.Data{
+		"host":       image.Host,
+		"repository": image.Repository,
+		"tag":        image.Tag,
+	})
+
+	manifestURL := r.manifestURL(image)
+
+	resp, err := r.headManifest(manifestURL, "")
+	if err != nil {
+		logger.Error("failed-to-request-manifest", err)
+		return "", err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err := r.authorize(logger, resp.Header.Get("WWW-Authenticate"), image, username, password)
+		if err != nil {
+			logger.Error("failed-to-authorize", err)
+			return "", err
+		}
+
+		resp, err = r.headManifest(manifestURL, authorization)
+		if err != nil {
+			logger.Error("failed-to-request-manifest", err)
+			return "", err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("registry responded to manifest request with status %d", resp.StatusCode)
+		logger.Error("failed-to-fetch-manifest", err)
+		return "", err
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if reason := invalidDockerDigestReason(digest); reason != "" {
+		err := fmt.Errorf("registry returned %s [%s]", reason, digest)
+		logger.Error("invalid-digest", err)
+		return "", err
+	}
+
+	logger.Debug("resolved-digest", lager.Data{"digest": digest})
+	return digest, nil
+}
+
+type cachedDigest struct {
+	digest    string
+	expiresAt time.Time
+}
+
+type digestCacheKey struct {
+	image    RegistryImage
+	username string
+}
+
+// CachingDigestResolver remembers the digests another resolver returns for ttl,
+// so that desiring many apps from the same image asks the registry once.
+// Failed resolutions are not cached.
+type CachingDigestResolver struct {
+	resolver DigestResolver
+	ttl      time.Duration
+	clock    clock.Clock
+
+	lock    sync.Mutex
+	digests map[digestCacheKey]cachedDigest
+}
+
+func NewCachingDigestResolver(resolver DigestResolver, ttl time.Duration, clock clock.Clock) *CachingDigestResolver {
+	return &CachingDigestResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		clock:    clock,
+		digests:  map[digestCacheKey]cachedDigest{},
+	}
+}
+
+func (r *CachingDigestResolver) ResolveDigest(logger lager.Logger, image RegistryImage, username, password string) (string, error) {
+	key := digestCacheKey{image: image, username: username}
+
+	r.lock.Lock()
+	cached, ok := r.digests[key]
+	if ok && r.clock.Now().After(cached.expiresAt) {
+		delete(r.digests, key)
+		ok = false
+	}
+	r.lock.Unlock()
+
+	if ok {
+		return cached.digest, nil
+	}
+
+	digest, err := r.resolver.ResolveDigest(logger, image, username, password)
+	if err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	r.digests[key] = cachedDigest{digest: digest, expiresAt: r.clock.Now().Add(r.ttl)}
+	r.lock.Unlock()
+
+	return digest, nil
+}
+
+func (r *RegistryDigestResolver) manifestURL(image RegistryImage) string {
+	host := image.Host
+	if host == "" || host == DockerIndexServer {
+		host = DockerHubRegistryHost
+	}
+
+	scheme := "https"
+	if r.insecureRegistries[host] {
+		scheme = "http"
+	}
+
+	tag := image.Tag
+	if tag == "" {
+		tag = DefaultDockerTag
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, host, image.Repository, tag)
+}
+
+func (r *RegistryDigestResolver) headManifest(manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// authorize answers the registry's challenge, fetching a bearer token from the
+// advertised realm when the registry uses token auth.
+func (r *RegistryDigestResolver) authorize(logger lager.Logger, challenge string, image RegistryImage, username, password string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", errors.New("registry requires credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+
+	case "bearer":
+		token, err := r.fetchToken(logger, params, image, username, password)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+
+	default:
+		return "", fmt.Errorf("unsupported registry auth challenge [%s]", challenge)
+	}
+}
+
+type registryTokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func (r *RegistryDigestResolver) fetchToken(logger lager.Logger, params map[string]string, image RegistryImage, username, password string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("registry auth challenge has no realm")
+	}
+
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", image.Repository)
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+
+	query := tokenURL.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	logger.Debug("fetching-token", lager.Data{"realm": realm, "scope": scope})
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("invalid response code %d from token endpoint", resp.StatusCode)
+	}
+
+	var response registryTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", err
+	}
+
+	token := response.Token
+	if token == "" {
+		token = response.AccessToken
+	}
+	if token == "" {
+		return "", errors.New("token endpoint returned an empty token")
+	}
+
+	return token, nil
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",scope="repository:a:pull,push"`
+// into its scheme and parameters.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	challenge = strings.TrimSpace(challenge)
+	i := strings.IndexByte(challenge, ' ')
+	if i < 0 {
+		return challenge, params
+	}
+
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+
+		params[key] = strings.TrimSpace(value)
+	}
+
+	return scheme, params
+}
@@ -0,0 +1,275 @@
+package recipebuilder_test
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("RegistryDigestResolver", func() {
+	var (
+		logger   *lagertest.TestLogger
+		registry *ghttp.Server
+		resolver *recipebuilder.RegistryDigestResolver
+		image    recipebuilder.RegistryImage
+		username string
+		password string
+
+		digest      string
+		resolved    string
+		resolveErr  error
+		manifestURL = "/v2/user/image/manifests/tag"
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		registry = ghttp.NewServer()
+		resolver = recipebuilder.NewRegistryDigestResolver(http.DefaultClient, []string{registry.Addr()})
+
+		image = recipebuilder.RegistryImage{
+			Host:       registry.Addr(),
+			Repository: "user/image",
+			Tag:        "tag",
+		}
+		username = ""
+		password = ""
+
+		digest = "sha256:" + strings.Repeat("a", 64)
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	JustBeforeEach(func() {
+		resolved, resolveErr = resolver.ResolveDigest(logger, image, username, password)
+	})
+
+	Context("when the registry allows anonymous access", func() {
+		BeforeEach(func() {
+			registry.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("HEAD", manifestURL),
+					ghttp.VerifyHeaderKV("Accept",
+						"application/vnd.docker.distribution.manifest.list.v2+json, "+
+							"application/vnd.docker.distribution.manifest.v2+json, "+
+							"application/vnd.oci.image.index.v1+json, "+
+							"application/vnd.oci.image.manifest.v1+json",
+					),
+					ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {digest}}),
+				),
+			)
+		})
+
+		It("returns the digest of the tagged manifest", func() {
+			Expect(resolveErr).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal(digest))
+		})
+	})
+
+	Context("when the image has no tag", func() {
+		BeforeEach(func() {
+			image.Tag = ""
+
+			registry.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("HEAD", "/v2/user/image/manifests/latest"),
+					ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {digest}}),
+				),
+			)
+		})
+
+		It("resolves the latest tag", func() {
+			Expect(resolveErr).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal(digest))
+		})
+	})
+
+	Context("when the registry requires a bearer token", func() {
+		BeforeEach(func() {
+			username = "some-user"
+			password = "some-password"
+
+			challenge := `Bearer realm="` + registry.URL() + `/token",service="registry.example.com",scope="repository:user/image:pull"`
+
+			registry.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("HEAD", manifestURL),
+					ghttp.RespondWith(http.StatusUnauthorized, "", http.Header{"Www-Authenticate": {challenge}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/token", "scope=repository%3Auser%2Fimage%3Apull&service=registry.example.com"),
+					ghttp.VerifyBasicAuth("some-user", "some-password"),
+					ghttp.RespondWith(http.StatusOK, `{"token":"the-token"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("HEAD", manifestURL),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer the-token"),
+					ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {digest}}),
+				),
+			)
+		})
+
+		It("fetches a token with the docker credentials and retries", func() {
+			Expect(resolveErr).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal(digest))
+			Expect(registry.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		Context("when the token endpoint rejects the credentials", func() {
+			BeforeEach(func() {
+				registry.SetHandler(1, ghttp.RespondWith(http.StatusUnauthorized, ""))
+			})
+
+			It("errors", func() {
+				Expect(resolveErr).To(HaveOccurred())
+				Expect(registry.ReceivedRequests()).To(HaveLen(2))
+			})
+		})
+	})
+
+	Context("when the registry requires basic auth", func() {
+		BeforeEach(func() {
+			username = "some-user"
+			password = "some-password"
+
+			registry.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("HEAD", manifestURL),
+					ghttp.RespondWith(http.StatusUnauthorized, "", http.Header{"Www-Authenticate": {`Basic realm="registry"`}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("HEAD", manifestURL),
+					ghttp.VerifyBasicAuth("some-user", "some-password"),
+					ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {digest}}),
+				),
+			)
+		})
+
+		It("retries with the docker credentials", func() {
+			Expect(resolveErr).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal(digest))
+		})
+	})
+
+	Context("when the tag does not exist", func() {
+		BeforeEach(func() {
+			registry.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, ""))
+		})
+
+		It("errors", func() {
+			Expect(resolveErr).To(HaveOccurred())
+		})
+	})
+
+	Context("when the registry does not return a valid digest", func() {
+		BeforeEach(func() {
+			registry.AppendHandlers(ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {"sha256:abc"}}))
+		})
+
+		It("errors", func() {
+			Expect(resolveErr).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("CachingDigestResolver", func() {
+	var (
+		logger    *lagertest.TestLogger
+		registry  *ghttp.Server
+		fakeClock *fakeclock.FakeClock
+		resolver  *recipebuilder.CachingDigestResolver
+		image     recipebuilder.RegistryImage
+		digest    string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		registry = ghttp.NewServer()
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		resolver = recipebuilder.NewCachingDigestResolver(
+			recipebuilder.NewRegistryDigestResolver(http.DefaultClient, []string{registry.Addr()}),
+			time.Minute,
+			fakeClock,
+		)
+
+		image = recipebuilder.RegistryImage{
+			Host:       registry.Addr(),
+			Repository: "user/image",
+			Tag:        "tag",
+		}
+		digest = "sha256:" + strings.Repeat("a", 64)
+
+		registry.RouteToHandler("HEAD", "/v2/user/image/manifests/tag", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Docker-Content-Digest", digest)
+		})
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	It("asks the registry once per image within the ttl", func() {
+		resolved, err := resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(digest))
+
+		fakeClock.Increment(59 * time.Second)
+
+		resolved, err = resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(digest))
+		Expect(registry.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("resolves the image again once the ttl has passed", func() {
+		_, err := resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		digest = "sha256:" + strings.Repeat("b", 64)
+		fakeClock.Increment(61 * time.Second)
+
+		resolved, err := resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(digest))
+		Expect(registry.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("caches each image separately", func() {
+		otherImage := image
+		otherImage.Tag = "other-tag"
+		registry.RouteToHandler("HEAD", "/v2/user/image/manifests/other-tag", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("c", 64))
+		})
+
+		_, err := resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		resolved, err := resolver.ResolveDigest(logger, otherImage, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal("sha256:" + strings.Repeat("c", 64)))
+		Expect(registry.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("does not cache failures", func() {
+		registry.RouteToHandler("HEAD", "/v2/user/image/manifests/tag", ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+
+		_, err := resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).To(HaveOccurred())
+
+		registry.RouteToHandler("HEAD", "/v2/user/image/manifests/tag", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Docker-Content-Digest", digest)
+		})
+
+		resolved, err := resolver.ResolveDigest(logger, image, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(digest))
+	})
+})
@@ -2,11 +2,8 @@ package recipebuilder
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"net/url"
 	"strings"
-	"time"
 
 	"code.cloudfoundry.org/bbs/models"
 	ssh_routes "code.cloudfoundry.org/diego-ssh/routes"
@@ -21,14 +18,16 @@ const (
 )
 
 type DockerRecipeBuilder struct {
-	logger lager.Logger
-	config Config
+	logger         lager.Logger
+	config         Config
+	recipeVersions map[string]string
 }
 
 func NewDockerRecipeBuilder(logger lager.Logger, config Config) *DockerRecipeBuilder {
 	return &DockerRecipeBuilder{
-		logger: logger,
-		config: config,
+		logger:         logger,
+		config:         config,
+		recipeVersions: recipeVersions("docker", config, false),
 	}
 }
 
@@ -73,8 +72,15 @@ func (b *DockerRecipeBuilder) BuildTask(task *cc_messages.TaskRequestFromCC) (*m
 		return nil, ErrMultipleAppSources
 	}
 
-	rootFSPath, err := convertDockerURI(task.DockerPath)
+	ref, err := parseDockerReference(task.DockerPath)
 	if err != nil {
+		logger.Error("invalid-docker-path", err, lager.Data{"docker-path": task.DockerPath})
+		return nil, err
+	}
+
+	err = b.config.ImagePolicy.check(ref, task.IsolationSegment)
+	if err != nil {
+		logger.Error("docker-image-not-allowed", err, lager.Data{"docker-path": task.DockerPath})
 		return nil, err
 	}
 
@@ -93,7 +99,7 @@ func (b *DockerRecipeBuilder) BuildTask(task *cc_messages.TaskRequestFromCC) (*m
 		CompletionCallbackUrl: task.CompletionCallbackUrl,
 		CachedDependencies:    cachedDependencies,
 		Action:                action,
-		RootFs:                rootFSPath,
+		RootFs:                ref.rootFSPath(),
 		TrustedSystemCertificatesPath: TrustedSystemCertificatesPath,
 		LogSource:                     task.LogSource,
 		VolumeMounts:                  convertVolumeMounts(task.VolumeMounts),
@@ -105,7 +111,7 @@ func (b *DockerRecipeBuilder) BuildTask(task *cc_messages.TaskRequestFromCC) (*m
 	return taskDefinition, nil
 }
 
-func (b *DockerRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error) {
+func (b *DockerRecipeBuilder) Build(desiredApp *DesireAppRequest) (*models.DesiredLRP, error) {
 	lrpGuid := desiredApp.ProcessGuid
 
 	buildLogger := b.logger.Session("message-builder")
@@ -132,9 +138,7 @@ func (b *DockerRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFrom
 
 	lifecycleURL := lifecycleDownloadURL(lifecyclePath, b.config.FileServerURL)
 
-	rootFSPath := ""
-	var err error
-	rootFSPath, err = convertDockerURI(desiredApp.DockerImageUrl)
+	rootFSPath, pinned, err := b.rootFSPath(buildLogger, desiredApp)
 	if err != nil {
 		return nil, err
 	}
@@ -169,17 +173,12 @@ func (b *DockerRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFrom
 		CacheKey: fmt.Sprintf("%s-lifecycle", strings.Replace(lifecycle, "/", "-", 1)),
 	})
 
-	desiredAppPorts, err := b.ExtractExposedPorts(desiredApp)
+	desiredAppPorts, err := b.ExtractExposedPorts(&desiredApp.DesireAppRequestFromCC)
 	if err != nil {
 		return nil, err
 	}
 
-	switch desiredApp.HealthCheckType {
-	case cc_messages.PortHealthCheckType, cc_messages.UnspecifiedHealthCheckType:
-		monitor = models.Timeout(getParallelAction(desiredAppPorts, user, ""), 10*time.Minute)
-	case cc_messages.HTTPHealthCheckType:
-		monitor = models.Timeout(getParallelAction(desiredAppPorts, user, desiredApp.HealthCheckHTTPEndpoint), 10*time.Minute)
-	}
+	monitor = b.config.HealthCheck.monitor(desiredApp, desiredAppPorts, user)
 
 	actions = append(actions, &models.RunAction{
 		User: user,
@@ -247,6 +246,11 @@ func (b *DockerRecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFrom
 		desiredAppPorts = append(desiredAppPorts, DefaultSSHPort)
 	}
 
+	setRecipeVersion(desiredAppRoutingInfo, b.recipeVersions[lifecycle])
+	if pinned != nil {
+		setPinnedImage(desiredAppRoutingInfo, *pinned)
+	}
+
 	actionAction := models.Codependent(actions...)
 
 	placementTags := []string{}
@@ -343,66 +347,41 @@ func extractUser(executionMetadata DockerExecutionMetadata) (string, error) {
 	}
 }
 
-func convertDockerURI(dockerURI string) (string, error) {
-	if strings.Contains(dockerURI, "://") {
-		return "", errors.New("docker URI [" + dockerURI + "] should not contain scheme")
+func (b *DockerRecipeBuilder) rootFSPath(logger lager.Logger, desiredApp *DesireAppRequest) (string, *PinnedImage, error) {
+	ref, err := parseDockerReference(desiredApp.DockerImageUrl)
+	if err != nil {
+		logger.Error("invalid-docker-image", err, lager.Data{"docker-image": desiredApp.DockerImageUrl})
+		return "", nil, err
 	}
 
-	indexName, remoteName, tag := parseDockerRepoUrl(dockerURI)
-
-	return (&url.URL{
-		Scheme:   DockerScheme,
-		Path:     indexName + "/" + remoteName,
-		Fragment: tag,
-	}).String(), nil
-}
-
-// via https://github.com/docker/docker/blob/a271eaeba224652e3a12af0287afbae6f82a9333/registry/config.go#L295
-func parseDockerRepoUrl(dockerURI string) (indexName, remoteName, tag string) {
-	nameParts := strings.SplitN(dockerURI, "/", 2)
+	err = b.config.ImagePolicy.check(ref, desiredApp.IsolationSegment)
+	if err != nil {
+		logger.Error("docker-image-not-allowed", err, lager.Data{"docker-image": desiredApp.DockerImageUrl})
+		return "", nil, err
+	}
 
-	if officialRegistry(nameParts) {
-		// URI without host
-		indexName = ""
-		remoteName = dockerURI
+	if b.config.DigestResolver == nil || ref.digest != "" {
+		return ref.rootFSPath(), nil, nil
+	}
 
-		// URI has format docker.io/<path>
-		if nameParts[0] == DockerIndexServer {
-			indexName = DockerIndexServer
-			remoteName = nameParts[1]
+	pinned := desiredApp.PinnedImage
+	if pinned != nil && pinned.Image == desiredApp.DockerImageUrl {
+		logger.Debug("kept-pinned-docker-image", lager.Data{"docker-image": desiredApp.DockerImageUrl, "digest": pinned.Digest})
+	} else {
+		digest, err := b.config.DigestResolver.ResolveDigest(logger, ref.registryImage(), desiredApp.DockerUser, desiredApp.DockerPassword)
+		if err != nil {
+			logger.Error("failed-to-resolve-docker-digest", err, lager.Data{"docker-image": desiredApp.DockerImageUrl})
+			return "", nil, err
 		}
 
-		// Remote name contain no '/' - prefix it with "library/"
-		// via https://github.com/docker/docker/blob/a271eaeba224652e3a12af0287afbae6f82a9333/registry/config.go#L343
-		if strings.IndexRune(remoteName, '/') == -1 {
-			remoteName = "library/" + remoteName
-		}
-	} else {
-		indexName = nameParts[0]
-		remoteName = nameParts[1]
+		logger.Info("pinned-docker-image", lager.Data{"docker-image": desiredApp.DockerImageUrl, "digest": digest})
+		pinned = &PinnedImage{Image: desiredApp.DockerImageUrl, Digest: digest}
 	}
 
-	remoteName, tag = parseDockerRepositoryTag(remoteName)
-
-	return indexName, remoteName, tag
-}
-
-func officialRegistry(nameParts []string) bool {
-	return len(nameParts) == 1 ||
-		nameParts[0] == DockerIndexServer ||
-		(!strings.Contains(nameParts[0], ".") &&
-			!strings.Contains(nameParts[0], ":") &&
-			nameParts[0] != "localhost")
+	ref.digest = pinned.Digest
+	return ref.rootFSPath(), pinned, nil
 }
 
-// via https://github.com/docker/docker/blob/4398108/pkg/parsers/parsers.go#L72
-func parseDockerRepositoryTag(remoteName string) (string, string) {
-	n := strings.LastIndex(remoteName, ":")
-	if n < 0 {
-		return remoteName, ""
-	}
-	if tag := remoteName[n+1:]; !strings.Contains(tag, "/") {
-		return remoteName[:n], tag
-	}
-	return remoteName, ""
+func (b *DockerRecipeBuilder) RecipeVersions() map[string]string {
+	return b.recipeVersions
 }
@@ -3,6 +3,8 @@ package recipebuilder_test
 import (
 	"encoding/json"
 	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/bbs/models"
@@ -18,6 +20,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
 )
 
 var _ = Describe("Docker Recipe Builder", func() {
@@ -89,11 +92,14 @@ var _ = Describe("Docker Recipe Builder", func() {
 		var (
 			err            error
 			desiredAppReq  cc_messages.DesireAppRequestFromCC
+			pinnedImage    *recipebuilder.PinnedImage
 			desiredLRP     *models.DesiredLRP
 			expectedRoutes models.Routes
 		)
 
 		BeforeEach(func() {
+			pinnedImage = nil
+
 			routingInfo, err := cc_messages.CCHTTPRoutes{
 				{Hostname: "route1"},
 				{Hostname: "route2"},
@@ -128,14 +134,19 @@ var _ = Describe("Docker Recipe Builder", func() {
 
 			cfRoutes := json.RawMessage([]byte(`[{"hostnames":["route1","route2"],"port":8080}]`))
 			tcpRoutes := json.RawMessage([]byte("[]"))
+			recipeVersion := json.RawMessage([]byte(`"` + builder.RecipeVersions()["docker"] + `"`))
 			expectedRoutes = models.Routes{
-				cfroutes.CF_ROUTER:    &cfRoutes,
-				tcp_routes.TCP_ROUTER: &tcpRoutes,
+				cfroutes.CF_ROUTER:                  &cfRoutes,
+				tcp_routes.TCP_ROUTER:               &tcpRoutes,
+				recipebuilder.RecipeVersionRouteKey: &recipeVersion,
 			}
 		})
 
 		JustBeforeEach(func() {
-			desiredLRP, err = builder.Build(&desiredAppReq)
+			desiredLRP, err = builder.Build(&recipebuilder.DesireAppRequest{
+				DesireAppRequestFromCC: desiredAppReq,
+				PinnedImage:            pinnedImage,
+			})
 		})
 
 		Describe("CPU weight calculation", func() {
@@ -501,11 +512,13 @@ var _ = Describe("Docker Recipe Builder", func() {
 					cfRouteMessage := json.RawMessage(cfRoutePayload)
 					tcpRouteMessage := json.RawMessage([]byte("[]"))
 					sshRouteMessage := json.RawMessage(sshRoutePayload)
+					recipeVersionMessage := json.RawMessage([]byte(`"` + builder.RecipeVersions()["docker"] + `"`))
 
 					Expect(desiredLRP.Routes).To(Equal(&models.Routes{
-						cfroutes.CF_ROUTER:    &cfRouteMessage,
-						tcp_routes.TCP_ROUTER: &tcpRouteMessage,
-						routes.DIEGO_SSH:      &sshRouteMessage,
+						cfroutes.CF_ROUTER:                  &cfRouteMessage,
+						tcp_routes.TCP_ROUTER:               &tcpRouteMessage,
+						routes.DIEGO_SSH:                    &sshRouteMessage,
+						recipebuilder.RecipeVersionRouteKey: &recipeVersionMessage,
 					}))
 				})
 
@@ -843,18 +856,49 @@ var _ = Describe("Docker Recipe Builder", func() {
 				Context("and user/image", testRootFSPath("docker.io/user/image", "docker://docker.io/user/image"))
 				Context("and image with tag", testRootFSPath("docker.io/image:tag", "docker://docker.io/library/image#tag"))
 				Context("and a user/image with tag", testRootFSPath("docker.io/user/image:tag", "docker://docker.io/user/image#tag"))
+				Context("and no path", testRootFSPath("docker.io", "docker:///library/docker.io"))
+				Context("and no path with tag", testRootFSPath("docker.io:tag", "docker:///library/docker.io#tag"))
 			})
 
-			Context("and the docker image url has scheme", func() {
-				BeforeEach(func() {
-					desiredAppReq.DockerImageUrl = "https://docker.io/repo"
-				})
+			Context("and the docker image url has a nested path", func() {
+				Context("and no host", testRootFSPath("org/team/image:tag", "docker:///org/team/image#tag"))
+				Context("and a host", testRootFSPath("registry.example.com/org/team/image:tag", "docker://registry.example.com/org/team/image#tag"))
+			})
 
-				It("errors", func() {
-					Expect(err).To(HaveOccurred())
-				})
+			Context("and the docker image url has a digest", func() {
+				digest := "sha256:" + strings.Repeat("a", 64)
+
+				Context("and image only", testRootFSPath("image@"+digest, "docker:///library/image#"+digest))
+				Context("and host:port", testRootFSPath("10.244.2.6:8080/user/image@"+digest, "docker://10.244.2.6:8080/user/image#"+digest))
+				Context("and localhost", testRootFSPath("localhost/image@"+digest, "docker://localhost/image#"+digest))
+				// the digest pins the image, so the tag is dropped
+				Context("and a tag", testRootFSPath("docker.io/user/image:tag@"+digest, "docker://docker.io/user/image#"+digest))
 			})
 
+			testInvalidReference := func(imageUrl string) func() {
+				return func() {
+					BeforeEach(func() {
+						desiredAppReq.DockerImageUrl = imageUrl
+					})
+
+					It("errors with an invalid reference error", func() {
+						Expect(err).To(HaveOccurred())
+						recipeErr, ok := err.(recipebuilder.Error)
+						Expect(ok).To(BeTrue())
+						Expect(recipeErr.Type).To(Equal(recipebuilder.InvalidDockerReference))
+					})
+				}
+			}
+
+			Context("and the docker image url has scheme", testInvalidReference("https://docker.io/repo"))
+			Context("and the docker image url has upper case characters", testInvalidReference("User/Image"))
+			Context("and the docker image url has an invalid tag", testInvalidReference("user/image:-tag"))
+			Context("and the docker image url has a truncated digest", testInvalidReference("user/image@sha256:abcdef"))
+			Context("and the docker image url has a malformed digest", testInvalidReference("user/image@sha256"))
+			Context("and the docker image url has an invalid host", testInvalidReference("-registry.example.com/image"))
+			Context("and the docker image url has no repository", testInvalidReference(":tag"))
+			Context("and the docker image url has an empty path component", testInvalidReference("registry.example.com/user//image"))
+
 			It("does not set the container's LANG", func() {
 				Expect(desiredLRP.EnvironmentVariables).To(BeEmpty())
 			})
@@ -880,6 +924,167 @@ var _ = Describe("Docker Recipe Builder", func() {
 			})
 		})
 
+		Context("when a digest resolver is configured", func() {
+			var (
+				registry *ghttp.Server
+				digest   string
+			)
+
+			BeforeEach(func() {
+				registry = ghttp.NewServer()
+				digest = "sha256:" + strings.Repeat("b", 64)
+
+				builder = recipebuilder.NewDockerRecipeBuilder(logger, recipebuilder.Config{
+					Lifecycles:     lifecycles,
+					FileServerURL:  "http://file-server.com",
+					KeyFactory:     fakeKeyFactory,
+					DigestResolver: recipebuilder.NewRegistryDigestResolver(http.DefaultClient, []string{registry.Addr()}),
+				})
+
+				desiredAppReq.DockerImageUrl = registry.Addr() + "/user/repo:tag"
+				desiredAppReq.DockerUser = "someuser"
+				desiredAppReq.DockerPassword = "apassword"
+			})
+
+			AfterEach(func() {
+				registry.Close()
+			})
+
+			Context("and the registry resolves the tag", func() {
+				BeforeEach(func() {
+					registry.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("HEAD", "/v2/user/repo/manifests/tag"),
+							ghttp.RespondWith(http.StatusUnauthorized, "", http.Header{
+								"Www-Authenticate": {`Bearer realm="` + registry.URL() + `/token",service="registry"`},
+							}),
+						),
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("GET", "/token"),
+							ghttp.VerifyBasicAuth("someuser", "apassword"),
+							ghttp.RespondWith(http.StatusOK, `{"token":"the-token"}`),
+						),
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("HEAD", "/v2/user/repo/manifests/tag"),
+							ghttp.VerifyHeaderKV("Authorization", "Bearer the-token"),
+							ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {digest}}),
+						),
+					)
+				})
+
+				It("pins the rootfs to the resolved digest", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(desiredLRP.RootFs).To(Equal("docker://" + registry.Addr() + "/user/repo#" + digest))
+				})
+
+				It("records the pin in the routes", func() {
+					Expect(err).NotTo(HaveOccurred())
+					pinned, ok := recipebuilder.PinnedImageFromRoutes(*desiredLRP.Routes)
+					Expect(ok).To(BeTrue())
+					Expect(*pinned).To(Equal(recipebuilder.PinnedImage{
+						Image:  registry.Addr() + "/user/repo:tag",
+						Digest: digest,
+					}))
+				})
+			})
+
+			Context("and the existing LRP is pinned for the same image", func() {
+				var pinnedDigest string
+
+				BeforeEach(func() {
+					pinnedDigest = "sha256:" + strings.Repeat("c", 64)
+					pinnedImage = &recipebuilder.PinnedImage{
+						Image:  desiredAppReq.DockerImageUrl,
+						Digest: pinnedDigest,
+					}
+				})
+
+				It("keeps the pinned digest without contacting the registry", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(desiredLRP.RootFs).To(Equal("docker://" + registry.Addr() + "/user/repo#" + pinnedDigest))
+					Expect(registry.ReceivedRequests()).To(BeEmpty())
+
+					pinned, ok := recipebuilder.PinnedImageFromRoutes(*desiredLRP.Routes)
+					Expect(ok).To(BeTrue())
+					Expect(pinned.Digest).To(Equal(pinnedDigest))
+				})
+			})
+
+			Context("and the existing LRP is pinned for another image", func() {
+				BeforeEach(func() {
+					pinnedImage = &recipebuilder.PinnedImage{
+						Image:  registry.Addr() + "/user/repo:old-tag",
+						Digest: "sha256:" + strings.Repeat("c", 64),
+					}
+
+					registry.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("HEAD", "/v2/user/repo/manifests/tag"),
+							ghttp.RespondWith(http.StatusOK, "", http.Header{"Docker-Content-Digest": {digest}}),
+						),
+					)
+				})
+
+				It("resolves the new image", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(desiredLRP.RootFs).To(Equal("docker://" + registry.Addr() + "/user/repo#" + digest))
+				})
+			})
+
+			Context("and the image is already pinned", func() {
+				BeforeEach(func() {
+					desiredAppReq.DockerImageUrl = registry.Addr() + "/user/repo@" + digest
+				})
+
+				It("does not contact the registry", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(desiredLRP.RootFs).To(Equal("docker://" + registry.Addr() + "/user/repo#" + digest))
+					Expect(registry.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+
+			Context("and the registry cannot resolve the tag", func() {
+				BeforeEach(func() {
+					registry.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, ""))
+				})
+
+				It("errors", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(desiredLRP).To(BeNil())
+				})
+			})
+		})
+
+		Context("when an image policy is configured", func() {
+			BeforeEach(func() {
+				builder = recipebuilder.NewDockerRecipeBuilder(logger, recipebuilder.Config{
+					Lifecycles:    lifecycles,
+					FileServerURL: "http://file-server.com",
+					KeyFactory:    fakeKeyFactory,
+					ImagePolicy: recipebuilder.ImagePolicy{
+						Default: recipebuilder.ImageRules{Deny: []string{"docker.io/user/*"}},
+					},
+				})
+			})
+
+			It("rejects images the policy does not allow", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(err.(recipebuilder.Error).Type).To(Equal(recipebuilder.ImageNotAllowed))
+				Expect(desiredLRP).To(BeNil())
+			})
+
+			Context("and the image is allowed", func() {
+				BeforeEach(func() {
+					desiredAppReq.DockerImageUrl = "other/repo:tag"
+				})
+
+				It("builds the desired LRP", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(desiredLRP.RootFs).To(Equal("docker:///other/repo#tag"))
+				})
+			})
+		})
+
 		Context("when there is a docker image url AND a droplet uri", func() {
 			BeforeEach(func() {
 				desiredAppReq.DockerImageUrl = "user/repo:tag"
@@ -1091,6 +1296,17 @@ var _ = Describe("Docker Recipe Builder", func() {
 			})
 		})
 
+		Context("with a docker path pinned by digest", func() {
+			BeforeEach(func() {
+				newTaskReq.DockerPath = "cloudfoundry/diego-docker-app@sha256:" + strings.Repeat("0", 64)
+			})
+
+			It("carries the digest into the rootfs", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(taskDefinition.RootFs).To(Equal("docker:///cloudfoundry/diego-docker-app#sha256:" + strings.Repeat("0", 64)))
+			})
+		})
+
 		Context("when a droplet uri is specified", func() {
 			BeforeEach(func() {
 				newTaskReq.DropletUri = "https://utako.utako.com"
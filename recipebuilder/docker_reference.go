@@ -0,0 +1,151 @@
+package recipebuilder
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	InvalidDockerReference = "ErrInvalidDockerReference"
+
+	dockerNameTotalLengthMax = 255
+)
+
+// The grammar follows the distribution reference format:
+// https://github.com/docker/distribution/blob/v2.6.0/reference/reference.go
+var (
+	dockerDomainPattern        = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	dockerPathComponentPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	dockerTagPattern           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	dockerDigestPattern        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+var dockerDigestLengths = map[string]int{
+	"sha256": 64,
+	"sha384": 96,
+	"sha512": 128,
+}
+
+// dockerReference is a parsed image reference. indexName is empty for images
+// on the default registry that were referenced without a host.
+type dockerReference struct {
+	indexName  string
+	remoteName string
+	tag        string
+	digest     string
+}
+
+func newInvalidDockerReferenceError(reference, reason string) Error {
+	return Error{
+		Type:    InvalidDockerReference,
+		Message: fmt.Sprintf("invalid docker image reference [%s]: %s", reference, reason),
+	}
+}
+
+func parseDockerReference(reference string) (dockerReference, error) {
+	if strings.Contains(reference, "://") {
+		return dockerReference{}, newInvalidDockerReferenceError(reference, "should not contain scheme")
+	}
+
+	name := reference
+	ref := dockerReference{}
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.digest = name[:i], name[i+1:]
+		if reason := invalidDockerDigestReason(ref.digest); reason != "" {
+			return dockerReference{}, newInvalidDockerReferenceError(reference, reason)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.tag = name[:i], name[i+1:]
+		if !dockerTagPattern.MatchString(ref.tag) {
+			return dockerReference{}, newInvalidDockerReferenceError(reference, "invalid tag")
+		}
+	}
+
+	if name == "" {
+		return dockerReference{}, newInvalidDockerReferenceError(reference, "missing repository name")
+	}
+	if len(name) > dockerNameTotalLengthMax {
+		return dockerReference{}, newInvalidDockerReferenceError(reference, fmt.Sprintf("repository name longer than %d characters", dockerNameTotalLengthMax))
+	}
+
+	nameParts := strings.SplitN(name, "/", 2)
+	if officialRegistry(nameParts) {
+		ref.remoteName = name
+
+		// URI has format docker.io/<path>; a bare docker.io is an image name
+		if len(nameParts) == 2 && nameParts[0] == DockerIndexServer {
+			ref.indexName = DockerIndexServer
+			ref.remoteName = nameParts[1]
+		}
+
+		// Remote name contain no '/' - prefix it with "library/"
+		// via https://github.com/docker/docker/blob/a271eaeba224652e3a12af0287afbae6f82a9333/registry/config.go#L343
+		if !strings.Contains(ref.remoteName, "/") {
+			ref.remoteName = "library/" + ref.remoteName
+		}
+	} else {
+		ref.indexName = nameParts[0]
+		ref.remoteName = nameParts[1]
+
+		if !dockerDomainPattern.MatchString(ref.indexName) {
+			return dockerReference{}, newInvalidDockerReferenceError(reference, "invalid registry host")
+		}
+	}
+
+	for _, component := range strings.Split(ref.remoteName, "/") {
+		if !dockerPathComponentPattern.MatchString(component) {
+			return dockerReference{}, newInvalidDockerReferenceError(reference, "invalid repository name")
+		}
+	}
+
+	return ref, nil
+}
+
+func invalidDockerDigestReason(digest string) string {
+	if !dockerDigestPattern.MatchString(digest) {
+		return "invalid digest"
+	}
+
+	parts := strings.SplitN(digest, ":", 2)
+	if length, ok := dockerDigestLengths[parts[0]]; ok && len(parts[1]) != length {
+		return fmt.Sprintf("%s digest must be %d hex characters", parts[0], length)
+	}
+
+	return ""
+}
+
+func officialRegistry(nameParts []string) bool {
+	return len(nameParts) == 1 ||
+		nameParts[0] == DockerIndexServer ||
+		(!strings.Contains(nameParts[0], ".") &&
+			!strings.Contains(nameParts[0], ":") &&
+			nameParts[0] != "localhost")
+}
+
+// rootFSPath renders the reference as a docker:// rootfs. A digest pins the
+// image, so it takes the place of the tag in the fragment.
+func (r dockerReference) rootFSPath() string {
+	fragment := r.tag
+	if r.digest != "" {
+		fragment = r.digest
+	}
+
+	return (&url.URL{
+		Scheme:   DockerScheme,
+		Path:     r.indexName + "/" + r.remoteName,
+		Fragment: fragment,
+	}).String()
+}
+
+func (r dockerReference) registryImage() RegistryImage {
+	return RegistryImage{
+		Host:       r.indexName,
+		Repository: r.remoteName,
+		Tag:        r.tag,
+	}
+}
@@ -0,0 +1,121 @@
+package recipebuilder
+
+import (
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+)
+
+// ProcessHealthCheckType considers an instance healthy for as long as its
+// process runs, so the LRP gets no monitor.
+const ProcessHealthCheckType = cc_messages.HealthCheckType("process")
+
+const (
+	DefaultMonitorTimeout = 10 * time.Minute
+
+	healthCheckPath = "/tmp/lifecycle/healthcheck"
+)
+
+// HealthCheckConfig tunes the healthcheck processes in an LRP's monitor. Apps
+// can override Interval and Timeout with their AppHealthCheck. Zero values
+// keep the healthcheck binary's own defaults.
+//
+// Diego runs the monitor until it exits successfully to mark an instance
+// healthy, and then keeps re-running it to check the instance stays healthy.
+// Each run polls the app every Interval, gives each check Timeout to answer,
+// and is bounded by MonitorTimeout.
+//
+// There is no separate liveness mode. The healthcheck binary's liveness
+// checks never exit while the app answers, so a run bounded by MonitorTimeout
+// would fail and crash every healthy instance, and an unbounded run would let
+// a hung check hold the monitor forever. Diego's re-runs of the startup check
+// are what keep checking a running instance.
+type HealthCheckConfig struct {
+	Interval       time.Duration
+	Timeout        time.Duration
+	MonitorTimeout time.Duration
+}
+
+func (c HealthCheckConfig) Validate() error {
+	if c.Interval < 0 || c.Timeout < 0 || c.MonitorTimeout < 0 {
+		return fmt.Errorf("health check durations must not be negative")
+	}
+
+	return nil
+}
+
+func (c HealthCheckConfig) isDefault() bool {
+	return c.Interval == 0 &&
+		c.Timeout == 0 &&
+		(c.MonitorTimeout == 0 || c.MonitorTimeout == DefaultMonitorTimeout)
+}
+
+func (c HealthCheckConfig) forApp(app AppHealthCheck) HealthCheckConfig {
+	if app.HealthCheckIntervalInSeconds > 0 {
+		c.Interval = time.Duration(app.HealthCheckIntervalInSeconds) * time.Second
+	}
+	if app.HealthCheckInvocationTimeoutInSeconds > 0 {
+		c.Timeout = time.Duration(app.HealthCheckInvocationTimeoutInSeconds) * time.Second
+	}
+	return c
+}
+
+// monitor returns no action for the none and process types, and for types
+// it does not know.
+func (c HealthCheckConfig) monitor(desiredApp *DesireAppRequest, ports []uint32, user string) models.ActionInterface {
+	c = c.forApp(desiredApp.AppHealthCheck)
+
+	switch desiredApp.HealthCheckType {
+	case cc_messages.PortHealthCheckType, cc_messages.UnspecifiedHealthCheckType:
+		return c.healthCheckAction(ports, user, "")
+	case cc_messages.HTTPHealthCheckType:
+		return c.healthCheckAction(ports, user, desiredApp.HealthCheckHTTPEndpoint)
+	default:
+		return nil
+	}
+}
+
+func (c HealthCheckConfig) healthCheckAction(ports []uint32, user string, uri string) models.ActionInterface {
+	fileDescriptorLimit := DefaultFileDescriptorLimit
+	parallelAction := &models.ParallelAction{}
+	for _, port := range ports {
+		parallelAction.Actions = append(parallelAction.Actions,
+			&models.Action{
+				RunAction: &models.RunAction{
+					User:      user,
+					Path:      healthCheckPath,
+					Args:      c.args(port, uri),
+					LogSource: HealthLogSource,
+					ResourceLimits: &models.ResourceLimits{
+						Nofile: &fileDescriptorLimit,
+					},
+					SuppressLogOutput: true,
+				},
+			})
+	}
+
+	monitorTimeout := c.MonitorTimeout
+	if monitorTimeout == 0 {
+		monitorTimeout = DefaultMonitorTimeout
+	}
+
+	return models.Timeout(parallelAction, monitorTimeout)
+}
+
+func (c HealthCheckConfig) args(port uint32, uri string) []string {
+	args := []string{fmt.Sprintf("-port=%d", port)}
+	if uri != "" {
+		args = append(args, fmt.Sprintf("-uri=%s", uri))
+	}
+	if c.Timeout > 0 {
+		args = append(args, fmt.Sprintf("-timeout=%s", c.Timeout))
+	}
+
+	if c.Interval > 0 {
+		args = append(args, fmt.Sprintf("-startup-interval=%s", c.Interval))
+	}
+
+	return args
+}
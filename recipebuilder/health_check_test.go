@@ -0,0 +1,155 @@
+package recipebuilder_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HealthCheckConfig", func() {
+	var healthCheck recipebuilder.HealthCheckConfig
+
+	BeforeEach(func() {
+		healthCheck = recipebuilder.HealthCheckConfig{}
+	})
+
+	Describe("building the monitor", func() {
+		var (
+			desiredAppReq  cc_messages.DesireAppRequestFromCC
+			appHealthCheck recipebuilder.AppHealthCheck
+			monitor        *models.Action
+			buildErr       error
+		)
+
+		defaultNofile := recipebuilder.DefaultFileDescriptorLimit
+
+		healthCheckAction := func(args ...string) *models.ParallelAction {
+			return &models.ParallelAction{
+				Actions: []*models.Action{
+					&models.Action{
+						RunAction: &models.RunAction{
+							User:      "vcap",
+							Path:      "/tmp/lifecycle/healthcheck",
+							Args:      args,
+							LogSource: "HEALTH",
+							ResourceLimits: &models.ResourceLimits{
+								Nofile: &defaultNofile,
+							},
+							SuppressLogOutput: true,
+						},
+					},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			desiredAppReq = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:     "the-app-guid-the-app-version",
+				DropletUri:      "http://the-droplet.uri.com",
+				Stack:           "some-stack",
+				StartCommand:    "the-start-command",
+				MemoryMB:        128,
+				DiskMB:          512,
+				NumInstances:    1,
+				LogGuid:         "the-log-id",
+				HealthCheckType: cc_messages.PortHealthCheckType,
+			}
+			appHealthCheck = recipebuilder.AppHealthCheck{}
+		})
+
+		JustBeforeEach(func() {
+			builder := recipebuilder.NewBuildpackRecipeBuilder(lagertest.NewTestLogger("test"), recipebuilder.Config{
+				Lifecycles:    map[string]string{"buildpack/some-stack": "some-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+				HealthCheck:   healthCheck,
+			})
+
+			var desiredLRP *models.DesiredLRP
+			desiredLRP, buildErr = builder.Build(&recipebuilder.DesireAppRequest{
+				DesireAppRequestFromCC: desiredAppReq,
+				AppHealthCheck:         appHealthCheck,
+			})
+			if buildErr == nil {
+				monitor = desiredLRP.Monitor
+			}
+		})
+
+		Context("when the health checks are tuned", func() {
+			BeforeEach(func() {
+				healthCheck = recipebuilder.HealthCheckConfig{
+					Interval:       2 * time.Second,
+					Timeout:        3 * time.Second,
+					MonitorTimeout: 5 * time.Minute,
+				}
+			})
+
+			It("passes the timeout and interval to the healthcheck, bounded by the monitor timeout", func() {
+				Expect(buildErr).NotTo(HaveOccurred())
+				Expect(monitor.GetValue()).To(Equal(models.Timeout(
+					healthCheckAction("-port=8080", "-timeout=3s", "-startup-interval=2s"),
+					5*time.Minute,
+				)))
+			})
+		})
+
+		Context("when the app tunes its own health check", func() {
+			BeforeEach(func() {
+				healthCheck = recipebuilder.HealthCheckConfig{
+					Interval: 2 * time.Second,
+					Timeout:  3 * time.Second,
+				}
+				appHealthCheck = recipebuilder.AppHealthCheck{
+					HealthCheckInvocationTimeoutInSeconds: 5,
+				}
+				desiredAppReq.HealthCheckType = cc_messages.HTTPHealthCheckType
+				desiredAppReq.HealthCheckHTTPEndpoint = "/healthz"
+			})
+
+			It("overrides the configured values it sets", func() {
+				Expect(buildErr).NotTo(HaveOccurred())
+				Expect(monitor.GetValue()).To(Equal(models.Timeout(
+					healthCheckAction("-port=8080", "-uri=/healthz", "-timeout=5s", "-startup-interval=2s"),
+					10*time.Minute,
+				)))
+			})
+		})
+
+		Context("when the 'process' health check is specified", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckType = recipebuilder.ProcessHealthCheckType
+			})
+
+			It("does not populate the monitor action", func() {
+				Expect(buildErr).NotTo(HaveOccurred())
+				Expect(monitor).To(BeNil())
+			})
+		})
+
+		Context("when an unknown health check is specified", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckType = cc_messages.HealthCheckType("telepathy")
+			})
+
+			It("does not populate the monitor action", func() {
+				Expect(buildErr).NotTo(HaveOccurred())
+				Expect(monitor).To(BeNil())
+			})
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts the defaults", func() {
+			Expect(healthCheck.Validate()).To(Succeed())
+		})
+
+		It("rejects negative durations", func() {
+			healthCheck.Timeout = -time.Second
+			Expect(healthCheck.Validate()).To(HaveOccurred())
+		})
+	})
+})
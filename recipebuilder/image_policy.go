@@ -0,0 +1,118 @@
+package recipebuilder
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const ImageNotAllowed = "ErrImageNotAllowed"
+
+// ImageRules are globs over "<registry>/<repository>", e.g.
+// "docker.io/library/*" or "registry.example.com/team/**". A "*" matches
+// within one path segment and "**" matches any number of segments. Images
+// from the default registry are matched as "docker.io/...".
+type ImageRules struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ImagePolicy restricts the images docker apps and tasks may run. Deny rules
+// always apply; an image must also match an allow rule whenever allow rules
+// are configured. An isolation segment's allow rules replace the default ones,
+// while its deny rules add to them.
+type ImagePolicy struct {
+	Default           ImageRules            `json:"default"`
+	IsolationSegments map[string]ImageRules `json:"isolation_segments,omitempty"`
+}
+
+func (p ImagePolicy) Validate() error {
+	rules := []ImageRules{p.Default}
+	for _, segmentRules := range p.IsolationSegments {
+		rules = append(rules, segmentRules)
+	}
+
+	for _, r := range rules {
+		for _, pattern := range append(append([]string{}, r.Allow...), r.Deny...) {
+			for _, segment := range strings.Split(pattern, "/") {
+				if _, err := path.Match(segment, ""); err != nil {
+					return fmt.Errorf("invalid image policy pattern [%s]: %s", pattern, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func newImageNotAllowedError(image, reason string) Error {
+	return Error{
+		Type:    ImageNotAllowed,
+		Message: fmt.Sprintf("docker image [%s] is not allowed: %s", image, reason),
+	}
+}
+
+func (p ImagePolicy) check(ref dockerReference, isolationSegment string) error {
+	indexName := ref.indexName
+	if indexName == "" {
+		indexName = DockerIndexServer
+	}
+	name := indexName + "/" + ref.remoteName
+
+	allow := p.Default.Allow
+	deny := p.Default.Deny
+	if segmentRules, ok := p.IsolationSegments[isolationSegment]; ok {
+		if len(segmentRules.Allow) > 0 {
+			allow = segmentRules.Allow
+		}
+		deny = append(append([]string{}, deny...), segmentRules.Deny...)
+	}
+
+	for _, pattern := range deny {
+		if matchImagePattern(pattern, name) {
+			return newImageNotAllowedError(name, "denied by "+pattern)
+		}
+	}
+
+	if len(allow) == 0 {
+		return nil
+	}
+
+	for _, pattern := range allow {
+		if matchImagePattern(pattern, name) {
+			return nil
+		}
+	}
+
+	return newImageNotAllowedError(name, "no allow rule matches")
+}
+
+func matchImagePattern(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(patterns, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+
+	if patterns[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(patterns[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	matched, err := path.Match(patterns[0], segments[0])
+	if err != nil || !matched {
+		return false
+	}
+
+	return matchSegments(patterns[1:], segments[1:])
+}
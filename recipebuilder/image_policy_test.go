@@ -0,0 +1,106 @@
+package recipebuilder_test
+
+import (
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ImagePolicy", func() {
+	var policy recipebuilder.ImagePolicy
+
+	BeforeEach(func() {
+		policy = recipebuilder.ImagePolicy{
+			Default: recipebuilder.ImageRules{
+				Allow: []string{"docker.io/**", "registry.example.com/*/*"},
+				Deny:  []string{"docker.io/untrusted/*"},
+			},
+			IsolationSegments: map[string]recipebuilder.ImageRules{
+				"secure": {
+					Allow: []string{"registry.example.com/secure/**"},
+					Deny:  []string{"registry.example.com/secure/legacy"},
+				},
+			},
+		}
+	})
+
+	Describe("evaluating images", func() {
+		buildTask := func(dockerPath, isolationSegment string) error {
+			builder := recipebuilder.NewDockerRecipeBuilder(lagertest.NewTestLogger("test"), recipebuilder.Config{
+				Lifecycles:    map[string]string{"docker": "the/docker/lifecycle/path.tgz"},
+				FileServerURL: "http://file-server.com",
+				ImagePolicy:   policy,
+			})
+
+			_, err := builder.BuildTask(&cc_messages.TaskRequestFromCC{
+				DockerPath:       dockerPath,
+				IsolationSegment: isolationSegment,
+			})
+			return err
+		}
+
+		expectNotAllowed := func(err error) {
+			Expect(err).To(HaveOccurred())
+			recipeErr, ok := err.(recipebuilder.Error)
+			Expect(ok).To(BeTrue())
+			Expect(recipeErr.Type).To(Equal(recipebuilder.ImageNotAllowed))
+		}
+
+		It("allows images matching an allow rule", func() {
+			Expect(buildTask("ubuntu:trusty", "")).To(Succeed())
+			Expect(buildTask("docker.io/user/image", "")).To(Succeed())
+			Expect(buildTask("registry.example.com/team/image:tag", "")).To(Succeed())
+		})
+
+		It("rejects images matching no allow rule", func() {
+			expectNotAllowed(buildTask("other.example.com/team/image", ""))
+		})
+
+		It("only lets a single star match within one path segment", func() {
+			expectNotAllowed(buildTask("registry.example.com/team/nested/image", ""))
+		})
+
+		It("rejects denied images even when an allow rule matches", func() {
+			expectNotAllowed(buildTask("untrusted/image", ""))
+		})
+
+		Context("when the isolation segment has its own rules", func() {
+			It("uses the segment's allow rules instead of the default ones", func() {
+				Expect(buildTask("registry.example.com/secure/team/image", "secure")).To(Succeed())
+				expectNotAllowed(buildTask("docker.io/user/image", "secure"))
+			})
+
+			It("applies both the default and the segment's deny rules", func() {
+				expectNotAllowed(buildTask("registry.example.com/secure/legacy", "secure"))
+				Expect(buildTask("registry.example.com/secure/legacy", "")).To(Succeed())
+			})
+		})
+
+		It("falls back to the default rules for other isolation segments", func() {
+			Expect(buildTask("docker.io/user/image", "other")).To(Succeed())
+		})
+
+		Context("when no rules are configured", func() {
+			BeforeEach(func() {
+				policy = recipebuilder.ImagePolicy{}
+			})
+
+			It("allows every image", func() {
+				Expect(buildTask("anywhere.example.com/any/image", "")).To(Succeed())
+			})
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts well formed patterns", func() {
+			Expect(policy.Validate()).To(Succeed())
+		})
+
+		It("rejects malformed patterns", func() {
+			policy.IsolationSegments["broken"] = recipebuilder.ImageRules{Deny: []string{"registry.example.com/[team"}}
+			Expect(policy.Validate()).To(HaveOccurred())
+		})
+	})
+})
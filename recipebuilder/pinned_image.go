@@ -0,0 +1,41 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// PinnedImageRouteKey is the key under which Build records the digest a docker
+// image was pinned to in the LRP's routes.
+const PinnedImageRouteKey = "nsync_pinned_image"
+
+// PinnedImage is a docker image reference as CC desired it and the digest its
+// tag pointed at when the LRP was built.
+type PinnedImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+func setPinnedImage(routes models.Routes, pinned PinnedImage) {
+	payload, _ := json.Marshal(pinned)
+	message := json.RawMessage(payload)
+	routes[PinnedImageRouteKey] = &message
+}
+
+// PinnedImageFromRoutes returns the pinned image recorded in an LRP's routes,
+// if any.
+func PinnedImageFromRoutes(routes models.Routes) (*PinnedImage, bool) {
+	message, ok := routes[PinnedImageRouteKey]
+	if !ok || message == nil {
+		return nil, false
+	}
+
+	var pinned PinnedImage
+	err := json.Unmarshal(*message, &pinned)
+	if err != nil || invalidDockerDigestReason(pinned.Digest) != "" {
+		return nil, false
+	}
+
+	return &pinned, true
+}
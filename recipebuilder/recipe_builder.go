@@ -42,13 +42,22 @@ type Config struct {
 	FileServerURL        string
 	KeyFactory           keys.SSHKeyFactory
 	PrivilegedContainers bool
+
+	// DigestResolver, when set, pins docker images to the digest their tag
+	// points at when the app is desired.
+	DigestResolver DigestResolver
+
+	ImagePolicy ImagePolicy
+
+	HealthCheck HealthCheckConfig
 }
 
 //go:generate counterfeiter -o ../bulk/fakes/fake_recipe_builder.go . RecipeBuilder
 type RecipeBuilder interface {
-	Build(*cc_messages.DesireAppRequestFromCC) (*models.DesiredLRP, error)
+	Build(*DesireAppRequest) (*models.DesiredLRP, error)
 	BuildTask(*cc_messages.TaskRequestFromCC) (*models.TaskDefinition, error)
 	ExtractExposedPorts(*cc_messages.DesireAppRequestFromCC) ([]uint32, error)
+	RecipeVersions() map[string]string
 }
 
 type Error struct {
@@ -94,32 +103,6 @@ func createLrpEnv(env []*models.EnvironmentVariable, exposedPorts []uint32, incl
 	return env
 }
 
-func getParallelAction(ports []uint32, user string, uri string) *models.ParallelAction {
-	fileDescriptorLimit := DefaultFileDescriptorLimit
-	parallelAction := &models.ParallelAction{}
-	for _, port := range ports {
-		args := []string{fmt.Sprintf("-port=%d", port)}
-		if uri != "" {
-			args = append(args, fmt.Sprintf("-uri=%s", uri))
-		}
-
-		parallelAction.Actions = append(parallelAction.Actions,
-			&models.Action{
-				RunAction: &models.RunAction{
-					User:      user,
-					Path:      "/tmp/lifecycle/healthcheck",
-					Args:      args,
-					LogSource: HealthLogSource,
-					ResourceLimits: &models.ResourceLimits{
-						Nofile: &fileDescriptorLimit,
-					},
-					SuppressLogOutput: true,
-				},
-			})
-	}
-	return parallelAction
-}
-
 func getDesiredAppPorts(ports []uint32) []uint32 {
 	desiredAppPorts := ports
 
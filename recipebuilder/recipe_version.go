@@ -0,0 +1,75 @@
+package recipebuilder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// RecipeVersionRouteKey is the key under which Build records the recipe
+// version in the LRP's routes. Routes are part of the scheduling info, so the
+// bulker can compare versions without fetching every full DesiredLRP.
+const RecipeVersionRouteKey = "nsync_recipe_version"
+
+// recipeSchemaVersion must be bumped whenever a change to the builders alters
+// the LRPs they produce for the same input, so that existing LRPs are
+// recreated with the new recipe.
+const recipeSchemaVersion = 1
+
+// recipeVersions returns the version of each lifecycle of the given kind,
+// keyed by lifecycle. A version only hashes its own lifecycle, so that a new
+// lifecycle for one stack does not recreate the apps running on the others.
+func recipeVersions(kind string, config Config, includePrivileged bool) map[string]string {
+	versions := map[string]string{}
+	for lifecycle, path := range config.Lifecycles {
+		if lifecycle == kind || strings.HasPrefix(lifecycle, kind+"/") {
+			versions[lifecycle] = recipeVersion(kind, lifecycle, path, config, includePrivileged)
+		}
+	}
+	return versions
+}
+
+func recipeVersion(kind, lifecycle, path string, config Config, includePrivileged bool) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "schema=%d\n", recipeSchemaVersion)
+	fmt.Fprintf(hash, "file-server-url=%s\n", config.FileServerURL)
+	fmt.Fprintf(hash, "file-descriptors=%d\n", DefaultFileDescriptorLimit)
+	fmt.Fprintf(hash, "trusted-certs=%s\n", TrustedSystemCertificatesPath)
+	fmt.Fprintf(hash, "lang=%s\n", DefaultLANG)
+	fmt.Fprintf(hash, "lifecycle=%s:%s\n", lifecycle, path)
+	if includePrivileged {
+		fmt.Fprintf(hash, "privileged=%t\n", config.PrivilegedContainers)
+	}
+	// Only hashed when tuned, so that the defaults keep existing versions.
+	if !config.HealthCheck.isDefault() {
+		fmt.Fprintf(hash, "health-check=%+v\n", config.HealthCheck)
+	}
+
+	return kind + "-" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func setRecipeVersion(routes models.Routes, version string) {
+	payload, _ := json.Marshal(version)
+	message := json.RawMessage(payload)
+	routes[RecipeVersionRouteKey] = &message
+}
+
+// RecipeVersion returns the recipe version recorded in an LRP's routes, if any.
+func RecipeVersion(routes models.Routes) (string, bool) {
+	message, ok := routes[RecipeVersionRouteKey]
+	if !ok || message == nil {
+		return "", false
+	}
+
+	var version string
+	err := json.Unmarshal(*message, &version)
+	if err != nil {
+		return "", false
+	}
+
+	return version, true
+}
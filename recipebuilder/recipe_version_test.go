@@ -0,0 +1,130 @@
+package recipebuilder_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RecipeVersion", func() {
+	var (
+		logger *lagertest.TestLogger
+		config recipebuilder.Config
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		config = recipebuilder.Config{
+			Lifecycles: map[string]string{
+				"buildpack/some-stack": "some-lifecycle.tgz",
+				"docker":               "the/docker/lifecycle/path.tgz",
+			},
+			FileServerURL: "http://file-server.com",
+		}
+	})
+
+	buildpackVersion := func() string {
+		return recipebuilder.NewBuildpackRecipeBuilder(logger, config).RecipeVersions()["buildpack/some-stack"]
+	}
+
+	dockerVersion := func() string {
+		return recipebuilder.NewDockerRecipeBuilder(logger, config).RecipeVersions()["docker"]
+	}
+
+	It("is stable for the same configuration", func() {
+		Expect(buildpackVersion()).To(Equal(buildpackVersion()))
+	})
+
+	It("is prefixed by the lifecycle", func() {
+		Expect(buildpackVersion()).To(HavePrefix("buildpack-"))
+		Expect(dockerVersion()).To(HavePrefix("docker-"))
+	})
+
+	It("has a version for each lifecycle the builder uses", func() {
+		config.Lifecycles["buildpack/other-stack"] = "other-lifecycle.tgz"
+
+		Expect(recipebuilder.NewBuildpackRecipeBuilder(logger, config).RecipeVersions()).To(HaveLen(2))
+		Expect(recipebuilder.NewDockerRecipeBuilder(logger, config).RecipeVersions()).To(HaveLen(1))
+	})
+
+	It("changes when the app's lifecycle changes", func() {
+		before := buildpackVersion()
+
+		config.Lifecycles = map[string]string{
+			"buildpack/some-stack": "some-other-lifecycle.tgz",
+			"docker":               "the/docker/lifecycle/path.tgz",
+		}
+
+		Expect(buildpackVersion()).NotTo(Equal(before))
+	})
+
+	It("does not change when another lifecycle changes", func() {
+		config.Lifecycles["buildpack/other-stack"] = "other-lifecycle.tgz"
+		buildpackBefore := buildpackVersion()
+		dockerBefore := dockerVersion()
+
+		config.Lifecycles["buildpack/other-stack"] = "newer-lifecycle.tgz"
+
+		Expect(buildpackVersion()).To(Equal(buildpackBefore))
+		Expect(dockerVersion()).To(Equal(dockerBefore))
+	})
+
+	It("changes when the file server changes", func() {
+		before := dockerVersion()
+
+		config.FileServerURL = "http://other-file-server.com"
+
+		Expect(dockerVersion()).NotTo(Equal(before))
+	})
+
+	It("changes the buildpack version when privileged containers are toggled", func() {
+		buildpackBefore := buildpackVersion()
+		dockerBefore := dockerVersion()
+
+		config.PrivilegedContainers = true
+
+		Expect(buildpackVersion()).NotTo(Equal(buildpackBefore))
+		Expect(dockerVersion()).To(Equal(dockerBefore))
+	})
+
+	It("changes when the health checks are tuned", func() {
+		before := buildpackVersion()
+
+		config.HealthCheck = recipebuilder.HealthCheckConfig{
+			MonitorTimeout: recipebuilder.DefaultMonitorTimeout,
+		}
+		Expect(buildpackVersion()).To(Equal(before))
+
+		config.HealthCheck.Interval = 2 * time.Second
+		Expect(buildpackVersion()).NotTo(Equal(before))
+	})
+
+	Describe("reading it back from the routes", func() {
+		It("returns the recorded version", func() {
+			version := json.RawMessage(`"buildpack-abc"`)
+			routes := models.Routes{recipebuilder.RecipeVersionRouteKey: &version}
+
+			recorded, ok := recipebuilder.RecipeVersion(routes)
+			Expect(ok).To(BeTrue())
+			Expect(recorded).To(Equal("buildpack-abc"))
+		})
+
+		It("reports when no version was recorded", func() {
+			_, ok := recipebuilder.RecipeVersion(models.Routes{})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("reports when the recorded version is malformed", func() {
+			version := json.RawMessage(`{"not":"a string"}`)
+			routes := models.Routes{recipebuilder.RecipeVersionRouteKey: &version}
+
+			_, ok := recipebuilder.RecipeVersion(routes)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,90 @@
+package recipebuilder
+
+import "code.cloudfoundry.org/runtimeschema/cc_messages"
+
+var ErrNoLifecycleMatched = Error{Type: "ErrNoLifecycleMatched", Message: "no registered lifecycle can build the desired app"}
+
+// AppMatcher reports whether a lifecycle is responsible for a desired app.
+type AppMatcher func(*cc_messages.DesireAppRequestFromCC) bool
+
+// HasDockerImage matches apps that run from a docker image.
+func HasDockerImage(desiredApp *cc_messages.DesireAppRequestFromCC) bool {
+	return desiredApp.DockerImageUrl != ""
+}
+
+type registeredLifecycle struct {
+	name    string
+	builder RecipeBuilder
+	matches AppMatcher
+}
+
+// Registry resolves the recipe builder for a desired app or task. Apps are
+// offered to the lifecycles in registration order and built by the first one
+// that matches, falling back to the default lifecycle; tasks name their
+// lifecycle explicitly.
+type Registry struct {
+	defaultLifecycle string
+	lifecycles       []registeredLifecycle
+}
+
+func NewRegistry(defaultLifecycle string) *Registry {
+	return &Registry{defaultLifecycle: defaultLifecycle}
+}
+
+// NewDefaultRegistry registers the buildpack and docker lifecycles, with
+// buildpack as the default for apps without a docker image.
+func NewDefaultRegistry(buildpackBuilder, dockerBuilder RecipeBuilder) *Registry {
+	registry := NewRegistry("buildpack")
+	registry.Register("buildpack", buildpackBuilder, nil)
+	registry.Register("docker", dockerBuilder, HasDockerImage)
+	return registry
+}
+
+// Register adds a lifecycle. A nil matcher means apps only reach the lifecycle
+// when it is the default. Registering a name again replaces the earlier
+// builder but keeps its position.
+func (r *Registry) Register(name string, builder RecipeBuilder, matches AppMatcher) {
+	lifecycle := registeredLifecycle{name: name, builder: builder, matches: matches}
+
+	for i := range r.lifecycles {
+		if r.lifecycles[i].name == name {
+			r.lifecycles[i] = lifecycle
+			return
+		}
+	}
+
+	r.lifecycles = append(r.lifecycles, lifecycle)
+}
+
+func (r *Registry) BuilderForApp(desiredApp *cc_messages.DesireAppRequestFromCC) (RecipeBuilder, error) {
+	for _, lifecycle := range r.lifecycles {
+		if lifecycle.matches != nil && lifecycle.matches(desiredApp) {
+			return lifecycle.builder, nil
+		}
+	}
+
+	if builder, ok := r.BuilderForLifecycle(r.defaultLifecycle); ok {
+		return builder, nil
+	}
+
+	return nil, ErrNoLifecycleMatched
+}
+
+func (r *Registry) BuilderForLifecycle(name string) (RecipeBuilder, bool) {
+	for _, lifecycle := range r.lifecycles {
+		if lifecycle.name == name {
+			return lifecycle.builder, true
+		}
+	}
+
+	return nil, false
+}
+
+// Builders returns the registered builders in registration order.
+func (r *Registry) Builders() []RecipeBuilder {
+	builders := make([]RecipeBuilder, len(r.lifecycles))
+	for i, lifecycle := range r.lifecycles {
+		builders[i] = lifecycle.builder
+	}
+	return builders
+}
@@ -0,0 +1,95 @@
+package recipebuilder_test
+
+import (
+	"code.cloudfoundry.org/nsync/bulk/fakes"
+	"code.cloudfoundry.org/nsync/recipebuilder"
+	"code.cloudfoundry.org/runtimeschema/cc_messages"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		buildpackBuilder *fakes.FakeRecipeBuilder
+		dockerBuilder    *fakes.FakeRecipeBuilder
+		registry         *recipebuilder.Registry
+	)
+
+	BeforeEach(func() {
+		buildpackBuilder = new(fakes.FakeRecipeBuilder)
+		dockerBuilder = new(fakes.FakeRecipeBuilder)
+		registry = recipebuilder.NewDefaultRegistry(buildpackBuilder, dockerBuilder)
+	})
+
+	Describe("BuilderForApp", func() {
+		It("builds apps with a docker image with the docker lifecycle", func() {
+			builder, err := registry.BuilderForApp(&cc_messages.DesireAppRequestFromCC{DockerImageUrl: "docker:///user/repo"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder).To(BeIdenticalTo(dockerBuilder))
+		})
+
+		It("falls back to the default lifecycle", func() {
+			builder, err := registry.BuilderForApp(&cc_messages.DesireAppRequestFromCC{DropletUri: "http://the-droplet.uri.com"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder).To(BeIdenticalTo(buildpackBuilder))
+		})
+
+		Context("when another lifecycle is registered", func() {
+			var windowsBuilder *fakes.FakeRecipeBuilder
+
+			BeforeEach(func() {
+				windowsBuilder = new(fakes.FakeRecipeBuilder)
+				registry.Register("windows", windowsBuilder, func(app *cc_messages.DesireAppRequestFromCC) bool {
+					return app.Stack == "windows2012R2"
+				})
+			})
+
+			It("builds the apps it matches", func() {
+				builder, err := registry.BuilderForApp(&cc_messages.DesireAppRequestFromCC{Stack: "windows2012R2"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(builder).To(BeIdenticalTo(windowsBuilder))
+			})
+
+			It("leaves other apps to the existing lifecycles", func() {
+				builder, err := registry.BuilderForApp(&cc_messages.DesireAppRequestFromCC{Stack: "cflinuxfs2"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(builder).To(BeIdenticalTo(buildpackBuilder))
+			})
+		})
+
+		Context("when the default lifecycle is not registered", func() {
+			BeforeEach(func() {
+				registry = recipebuilder.NewRegistry("buildpack")
+				registry.Register("docker", dockerBuilder, recipebuilder.HasDockerImage)
+			})
+
+			It("returns an error for apps no lifecycle matches", func() {
+				_, err := registry.BuilderForApp(&cc_messages.DesireAppRequestFromCC{DropletUri: "http://the-droplet.uri.com"})
+				Expect(err).To(Equal(recipebuilder.ErrNoLifecycleMatched))
+			})
+		})
+	})
+
+	Describe("BuilderForLifecycle", func() {
+		It("finds builders by lifecycle name", func() {
+			builder, ok := registry.BuilderForLifecycle("docker")
+			Expect(ok).To(BeTrue())
+			Expect(builder).To(BeIdenticalTo(dockerBuilder))
+		})
+
+		It("reports unknown lifecycles", func() {
+			_, ok := registry.BuilderForLifecycle("unknown")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("replaces a lifecycle registered twice", func() {
+			replacement := new(fakes.FakeRecipeBuilder)
+			registry.Register("docker", replacement, recipebuilder.HasDockerImage)
+
+			builder, ok := registry.BuilderForLifecycle("docker")
+			Expect(ok).To(BeTrue())
+			Expect(builder).To(BeIdenticalTo(replacement))
+			Expect(registry.Builders()).To(HaveLen(2))
+		})
+	})
+})
@@ -3,19 +3,39 @@ package nsync
 import "github.com/tedsuo/rata"
 
 const (
-	DesireAppRoute = "Desire"
-	StopAppRoute   = "StopApp"
-	KillIndexRoute = "KillIndex"
+	DesireAppRoute   = "Desire"
+	DesireAppsRoute  = "DesireApps"
+	StopAppRoute     = "StopApp"
+	KillIndexRoute   = "KillIndex"
+	KillIndicesRoute = "KillIndices"
+	ResyncAppRoute   = "ResyncApp"
+	RestartAppRoute  = "RestartApp"
+
+	GetRestartJobRoute = "GetRestartJob"
+
+	GetAppRoute          = "GetApp"
+	GetAppInstancesRoute = "GetAppInstances"
 
 	TasksRoute      = "Task"
 	CancelTaskRoute = "CancelTask"
+	GetTaskRoute    = "GetTask"
+	ListTasksRoute  = "ListTasks"
 )
 
 var Routes = rata.Routes{
 	{Path: "/v1/apps/:process_guid", Method: "PUT", Name: DesireAppRoute},
+	{Path: "/v1/apps", Method: "PUT", Name: DesireAppsRoute},
 	{Path: "/v1/apps/:process_guid", Method: "DELETE", Name: StopAppRoute},
 	{Path: "/v1/apps/:process_guid/index/:index", Method: "DELETE", Name: KillIndexRoute},
+	{Path: "/v1/apps/:process_guid/index", Method: "DELETE", Name: KillIndicesRoute},
+	{Path: "/v1/apps/:process_guid/resync", Method: "POST", Name: ResyncAppRoute},
+	{Path: "/v1/apps/:process_guid/restart", Method: "POST", Name: RestartAppRoute},
+	{Path: "/v1/restarts/:job_guid", Method: "GET", Name: GetRestartJobRoute},
+	{Path: "/v1/apps/:process_guid", Method: "GET", Name: GetAppRoute},
+	{Path: "/v1/apps/:process_guid/instances", Method: "GET", Name: GetAppInstancesRoute},
 
 	{Path: "/v1/tasks", Method: "POST", Name: TasksRoute},
 	{Path: "/v1/tasks/:task_guid", Method: "DELETE", Name: CancelTaskRoute},
+	{Path: "/v1/tasks/:task_guid", Method: "GET", Name: GetTaskRoute},
+	{Path: "/v1/tasks", Method: "GET", Name: ListTasksRoute},
 }